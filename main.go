@@ -20,6 +20,7 @@ import (
 	"context"
 	"flag"
 	"github.com/SENERGY-Platform/timescale-usage/pkg"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/cli"
 	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
 	"log"
 	"os"
@@ -37,6 +38,14 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if flag.NArg() > 0 {
+		err = cli.Run(config, flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	wg, err := pkg.Start(ctx, config)
@@ -0,0 +1,78 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package accounting
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/signing"
+)
+
+// Client posts the per user usage the worker puts into the outbox after each run to accounting_url
+type Client struct {
+	client *http.Client
+	url    string
+	signer *signing.Signer
+}
+
+func New(config configuration.Config) (*Client, error) {
+	signer, err := signing.New(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{client: &http.Client{Timeout: time.Minute}, url: config.AccountingUrl, signer: signer}, nil
+}
+
+// Deliver posts the payload of the entry with an Idempotency-Key header, which stays the same for every attempt and
+// identifies the run and user
+func (c *Client) Deliver(ctx context.Context, entry model.OutboxEntry) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(entry.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	key := entry.IdempotencyKey
+	if key == "" {
+		key = "outbox/" + strconv.FormatInt(entry.Id, 10)
+	}
+	req.Header.Set("Idempotency-Key", "timescale-usage-"+key)
+	signature, err := c.signer.SignDetached(entry.Payload)
+	if err != nil {
+		return err
+	}
+	if signature != "" {
+		req.Header.Set(signing.Header, signature)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %v: %v", resp.StatusCode, string(body))
+	}
+	return nil
+}
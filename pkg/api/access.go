@@ -0,0 +1,145 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// access restricts the results of a request to the tables of the calling user, unless the caller is an admin
+type access struct {
+	admin   bool
+	subject string
+	tables  map[string]bool
+}
+
+// getAccess derives the access of a request from its token. Without api_admin_role nobody is an admin, unless
+// api_insecure_no_auth explicitly opens the api to every caller.
+func (a *Api) getAccess(w http.ResponseWriter, r *http.Request) (acc access, ok bool) {
+	if a.config.ApiInsecureNoAuth {
+		return access{admin: true}, true
+	}
+	c, err := getClaims(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return acc, false
+	}
+	acc.subject = c.Subject
+	if a.config.ApiAdminRole != "" && slices.Contains(c.RealmAccess.Roles, a.config.ApiAdminRole) {
+		acc.admin = true
+		return acc, true
+	}
+	acc.tables, err = a.traced(r).TablesOfUser(c.Subject)
+	if err != nil {
+		writeError(w, err)
+		return acc, false
+	}
+	return acc, true
+}
+
+// requireAdmin is used for endpoints revealing or changing data of all tenants
+func (a *Api) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return false
+	}
+	if !acc.admin {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (acc access) allowsTable(table string) bool {
+	return acc.admin || acc.tables[table]
+}
+
+// subject checks access to quotas and violations, which are either bound to a user or a table
+func (acc access) allowsSubject(kind string, subject string) bool {
+	if kind == model.QuotaKindUser {
+		return acc.admin || subject == acc.subject
+	}
+	return acc.allowsTable(subject)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// audit records every request with its caller in usage_api_access, since usage data is billing relevant. Requests
+// answered from the cache or with 304 Not Modified are recorded as well.
+func (a *Api) audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		accessedAt := time.Now()
+		next.ServeHTTP(recorder, r)
+		c, _ := getClaims(r)
+		err := a.traced(r).RecordApiAccess(model.ApiAccess{
+			Subject:    c.Subject,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Status:     recorder.status,
+			RemoteAddr: r.RemoteAddr,
+			AccessedAt: accessedAt,
+		})
+		if err != nil {
+			log.Println("ERROR: unable to record api access", err)
+		}
+	})
+}
+
+// listApiAccess lists the audited requests of [from, to), by default of the last day
+func (a *Api) listApiAccess(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	to := time.Now()
+	from := to.AddDate(0, 0, -1)
+	var err error
+	if r.URL.Query().Has("from") {
+		from, err = model.ParseDate(r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if r.URL.Query().Has("to") {
+		to, err = model.ParseDate(r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	result, err := a.traced(r).ListApiAccess(from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, result)
+}
@@ -0,0 +1,106 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func (a *Api) listAnnotations(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	if !acc.allowsTable(r.PathValue("table")) {
+		writeError(w, database.ErrNotFound)
+		return
+	}
+	annotations, err := a.traced(r).ListAnnotations(r.PathValue("table"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, annotations)
+}
+
+func (a *Api) addAnnotation(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	c, _ := getClaims(r)
+	annotation := model.Annotation{}
+	err := json.NewDecoder(r.Body).Decode(&annotation)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if annotation.Note == "" && len(annotation.Tags) == 0 {
+		http.Error(w, "note or tags required", http.StatusBadRequest)
+		return
+	}
+	annotation.Table = r.PathValue("table")
+	annotation.CreatedBy = c.Subject
+	annotation, err = a.traced(r).AddAnnotation(annotation)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, annotation)
+}
+
+func (a *Api) deleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	err = a.traced(r).DeleteAnnotation(r.PathValue("table"), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) putLegalHold(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	c, _ := getClaims(r)
+	hold := model.LegalHold{}
+	err := json.NewDecoder(r.Body).Decode(&hold)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	hold.Table = r.PathValue("table")
+	hold.SetBy = c.Subject
+	hold, err = a.traced(r).SetLegalHold(hold)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, hold)
+}
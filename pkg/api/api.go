@@ -0,0 +1,184 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/signing"
+)
+
+type Api struct {
+	db     *database.DB
+	config configuration.Config
+	signer *signing.Signer
+	jobs   chan queuedJob
+}
+
+func Start(ctx context.Context, wg *sync.WaitGroup, config configuration.Config) error {
+	var cacheTtl time.Duration
+	if config.ApiCacheTtl != "" {
+		var err error
+		cacheTtl, err = time.ParseDuration(config.ApiCacheTtl)
+		if err != nil {
+			return err
+		}
+	}
+	if config.ApiInsecureNoAuth {
+		log.Println("WARNING: api_insecure_no_auth is set, every caller of the api is an admin")
+	} else if config.ApiAdminRole == "" {
+		log.Println("WARNING: api_admin_role is not set, admin endpoints are forbidden")
+	}
+	signer, err := signing.New(config)
+	if err != nil {
+		return err
+	}
+	db, err := database.New(config, "api")
+	if err != nil {
+		return err
+	}
+	a := &Api{db: db, config: config, signer: signer, jobs: make(chan queuedJob, config.ApiJobQueue)}
+	err = db.FailInterruptedJobs()
+	if err != nil {
+		log.Println("WARNING: unable to fail interrupted jobs", err)
+	}
+	jobWorkers := &sync.WaitGroup{}
+	a.startJobWorkers(ctx, jobWorkers)
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /ui", a.getUi)
+	router.HandleFunc("GET /status", a.getStatus)
+	router.HandleFunc("GET /runs", a.getRuns)
+	router.HandleFunc("GET /debug", a.getDebug)
+	router.HandleFunc("PUT /debug", a.putDebug)
+	router.HandleFunc("GET /summary", a.signed(a.getSummary))
+	router.HandleFunc("GET /federation", a.signed(a.getFederation))
+	router.HandleFunc("GET /federation/tables", a.signed(a.getFederationTables))
+	router.HandleFunc("GET /usage", a.listUsage)
+	router.HandleFunc("GET /usage/diff", a.signed(a.getDiff))
+	router.HandleFunc("POST /usage/query", a.queryUsage)
+	router.HandleFunc("GET /usage/{table}/forecast", a.getForecast)
+	router.HandleFunc("GET /usage/{table}/months", a.getUsageByMonth)
+	router.HandleFunc("GET /usage/{table}/partitions", a.getUsageByPartition)
+	router.HandleFunc("GET /usage/{table}/columns", a.getColumnSizes)
+	router.HandleFunc("GET /usage/{table}/devices", a.getDeviceUsage)
+	router.HandleFunc("GET /usage/{table}/annotations", a.listAnnotations)
+	router.HandleFunc("POST /usage/{table}/annotations", a.addAnnotation)
+	router.HandleFunc("DELETE /usage/{table}/annotations/{id}", a.deleteAnnotation)
+	router.HandleFunc("PUT /usage/{table}/legal-hold", a.putLegalHold)
+	router.HandleFunc("GET /usage/{table}/retention-simulation", a.simulateRetention)
+	router.HandleFunc("POST /usage/{table}/retention/confirmation", a.confirmRetention)
+	router.HandleFunc("POST /usage/{table}/retention", a.applyRetention)
+	router.HandleFunc("GET /lifecycle", a.listLifecycles)
+	router.HandleFunc("GET /quotas", a.listQuotas)
+	router.HandleFunc("GET /quotas/{kind}/{subject}", a.getQuota)
+	router.HandleFunc("PUT /quotas/{kind}/{subject}", a.putQuota)
+	router.HandleFunc("DELETE /quotas/{kind}/{subject}", a.deleteQuota)
+	router.HandleFunc("GET /violations", a.listViolations)
+	router.HandleFunc("GET /costs", a.signed(a.getCosts))
+	router.HandleFunc("GET /invoices", a.signed(a.getInvoices))
+	router.HandleFunc("GET /.well-known/jwks.json", a.getJwks)
+	router.HandleFunc("GET /billing/exports", a.listBillingExports)
+	router.HandleFunc("GET /outbox", a.listOutbox)
+	router.HandleFunc("POST /deletions", a.createDeletion)
+	router.HandleFunc("GET /access", a.listApiAccess)
+	router.HandleFunc("GET /prices", a.listPriceLists)
+	router.HandleFunc("POST /prices", a.addPriceList)
+	router.HandleFunc("DELETE /prices/{id}", a.deletePriceList)
+	router.HandleFunc("GET /discounts", a.listDiscounts)
+	router.HandleFunc("PUT /discounts/{user}", a.putDiscount)
+	router.HandleFunc("DELETE /discounts/{user}", a.deleteDiscount)
+	router.HandleFunc("GET /retention", a.listRetentions)
+	router.HandleFunc("PUT /retention/{kind}", a.putRetention)
+	router.HandleFunc("DELETE /retention/{kind}", a.deleteRetention)
+	router.HandleFunc("POST /jobs", a.createJob)
+	router.HandleFunc("GET /jobs/{id}", a.getJob)
+	router.HandleFunc("POST /violations/{id}/ack", a.ackViolation)
+	router.HandleFunc("POST /violations/{id}/override", a.overrideViolation)
+
+	handler := a.tag(router)
+	if config.ApiCacheTtl != "" {
+		handler = newCache(cacheTtl).middleware(handler)
+	}
+	handler = conditional(handler)
+	if config.ApiAccessAudit {
+		handler = a.audit(handler)
+	}
+
+	server := &http.Server{Addr: ":" + strconv.Itoa(config.ApiPort), Handler: handler}
+	log.Println("Starting api server on port " + strconv.Itoa(config.ApiPort))
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("ERROR: api server", err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Println("ERROR: api shutdown", err)
+		}
+		jobWorkers.Wait()
+		db.Close()
+	}()
+	return nil
+}
+
+func writeJson(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Println("ERROR: unable to encode response", err)
+	}
+}
+
+// traced tags the queries of the request with its traceparent header
+func (a *Api) traced(r *http.Request) *database.DB {
+	return a.db.Traced(r.Header.Get("traceparent"))
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, database.ErrLegalHold) || errors.Is(err, database.ErrTableExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, database.ErrInvalidInterval) || errors.Is(err, database.ErrInvalidDeletion) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Println("ERROR:", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
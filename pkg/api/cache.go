@@ -0,0 +1,146 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// cache keeps successful GET responses for a short time, since usage data only changes once per run. Responses are
+// cached per token, because results depend on the access of the caller. Any modifying request clears the cache,
+// unless it was rejected.
+type cache struct {
+	ttl     time.Duration
+	mux     sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	created time.Time
+	header  http.Header
+	body    []byte
+}
+
+// lookups with a request body that don't modify data
+var readOnlyPosts = map[string]bool{"/usage/query": true}
+
+// mutating reports whether the request may modify data, HEAD and OPTIONS never do
+func mutating(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost:
+		return !readOnlyPosts[r.URL.Path]
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+func (c *cache) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			if !mutating(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			recorder := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			// rejected requests didn't change anything, failed ones may have partially
+			if recorder.status < 400 || recorder.status >= 500 {
+				c.clear()
+			}
+			return
+		}
+		key := r.Header.Get("Authorization") + " " + r.URL.String()
+		entry, ok := c.get(key)
+		if !ok {
+			recorder := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			if recorder.status != http.StatusOK {
+				recorder.writeTo(w)
+				return
+			}
+			entry = cacheEntry{created: time.Now(), header: recorder.header, body: recorder.body.Bytes()}
+			c.set(key, entry)
+		}
+		for k, v := range entry.header {
+			w.Header()[k] = v
+		}
+		w.Write(entry.body)
+	})
+}
+
+func (c *cache) get(key string) (entry cacheEntry, ok bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	entry, ok = c.entries[key]
+	if ok && time.Since(entry.created) > c.ttl {
+		delete(c.entries, key)
+		return entry, false
+	}
+	return entry, ok
+}
+
+func (c *cache) set(key string, entry cacheEntry) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for k, e := range c.entries {
+		if time.Since(e.created) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry
+}
+
+func (c *cache) clear() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.entries = map[string]cacheEntry{}
+}
+
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *responseRecorder) writeTo(w http.ResponseWriter) {
+	for k, v := range r.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(r.status)
+	w.Write(r.body.Bytes())
+}
@@ -0,0 +1,44 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMutating(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected bool
+	}{
+		{"GET", "/usage", false},
+		{"HEAD", "/usage", false},
+		{"OPTIONS", "/usage", false},
+		{"POST", "/usage/query", false},
+		{"POST", "/deletions", true},
+		{"PUT", "/quotas/user/a", true},
+		{"PATCH", "/debug", true},
+		{"DELETE", "/quotas/user/a", true},
+	}
+	for _, test := range tests {
+		if result := mutating(httptest.NewRequest(test.method, test.path, nil)); result != test.expected {
+			t.Errorf("mutating(%v %v) = %v, expected %v", test.method, test.path, result, test.expected)
+		}
+	}
+}
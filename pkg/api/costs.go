@@ -0,0 +1,143 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func (a *Api) getCosts(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	estimates, err := a.traced(r).EstimateCosts()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result := []model.CostEstimate{}
+	for _, e := range estimates {
+		if acc.allowsSubject(model.QuotaKindUser, e.UserId) {
+			result = append(result, e)
+		}
+	}
+	writeJson(w, result)
+}
+
+func (a *Api) listPriceLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := a.traced(r).ListPriceLists()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, lists)
+}
+
+func (a *Api) addPriceList(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	p := model.PriceList{}
+	err := json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(p.Tiers) == 0 {
+		http.Error(w, "at least one tier required", http.StatusBadRequest)
+		return
+	}
+	if p.ValidUntil != nil && !p.ValidUntil.After(p.ValidFrom) {
+		http.Error(w, "valid_until must be after valid_from", http.StatusBadRequest)
+		return
+	}
+	p, err = a.traced(r).AddPriceList(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, p)
+}
+
+func (a *Api) deletePriceList(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	err = a.traced(r).DeletePriceList(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) listDiscounts(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	discounts, err := a.traced(r).ListDiscounts()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, discounts)
+}
+
+func (a *Api) putDiscount(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	d := model.Discount{}
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if d.Factor < 0 {
+		http.Error(w, "factor must not be negative", http.StatusBadRequest)
+		return
+	}
+	d.UserId = r.PathValue("user")
+	d, err = a.traced(r).SetDiscount(d)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, d)
+}
+
+func (a *Api) deleteDiscount(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	err := a.traced(r).DeleteDiscount(r.PathValue("user"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,40 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+)
+
+func (a *Api) getDeviceUsage(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	if !acc.allowsTable(r.PathValue("table")) {
+		writeError(w, database.ErrNotFound)
+		return
+	}
+	devices, err := a.traced(r).DeviceUsage(r.PathValue("table"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, devices)
+}
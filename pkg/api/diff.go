@@ -0,0 +1,72 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func (a *Api) getDiff(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	from, err := model.ParseDate(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := model.ParseDate(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "to is before from", http.StatusBadRequest)
+		return
+	}
+	diff, err := a.traced(r).Diff(from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !acc.admin {
+		diff = filterDiff(diff, acc)
+	}
+	writeJson(w, diff)
+}
+
+// tables of deleted mappings are still attributed to the user by the diff itself
+func filterDiff(diff model.Diff, acc access) model.Diff {
+	tables := []model.TableDiff{}
+	for _, entry := range diff.Tables {
+		if entry.UserId == acc.subject || acc.allowsTable(entry.Table) {
+			tables = append(tables, entry)
+		}
+	}
+	users := []model.UserDiff{}
+	for _, user := range diff.Users {
+		if user.UserId == acc.subject {
+			users = append(users, user)
+		}
+	}
+	diff.Tables = tables
+	diff.Users = users
+	return diff
+}
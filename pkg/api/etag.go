@@ -0,0 +1,113 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// tag sets ETag of successful GET responses, and Last-Modified of responses built from run results only, see
+// runResult. Tags are set before responses are cached, so that conditional requests answered from the cache don't
+// need the database either.
+func (a *Api) tag(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		recorder := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == http.StatusOK {
+			hash := sha256.Sum256(recorder.body.Bytes())
+			recorder.header.Set("ETag", "\""+hex.EncodeToString(hash[:16])+"\"")
+			if runResult(r.URL.Path) {
+				lastModified, err := a.traced(r).LastUpdated()
+				if err != nil {
+					log.Println("WARNING: unable to read last update", err)
+				} else if !lastModified.IsZero() {
+					recorder.header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+				}
+			}
+		}
+		recorder.writeTo(w)
+	})
+}
+
+// runResults are the responses only changed by runs, other responses also change through the api, e.g. usage with
+// its annotations and legal holds, quotas which may be deleted or jobs
+var runResults = map[string]bool{"/summary": true, "/status": true, "/runs": true, "/lifecycle": true, "/usage/diff": true}
+
+// per table run results below /usage/{table}/
+var tableRunResults = map[string]bool{"forecast": true, "months": true, "partitions": true, "columns": true, "devices": true}
+
+// runResult reports whether the response of path is covered by LastUpdated
+func runResult(path string) bool {
+	if runResults[path] {
+		return true
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	return len(segments) == 3 && segments[0] == "usage" && tableRunResults[segments[2]]
+}
+
+// conditional answers requests with 304 Not Modified if the client already has the current version of the response
+func conditional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || (r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == "") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		recorder := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == http.StatusOK && notModified(r, recorder.header) {
+			for _, k := range []string{"ETag", "Last-Modified"} {
+				if v := recorder.header.Get(k); v != "" {
+					w.Header().Set(k, v)
+				}
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		recorder.writeTo(w)
+	})
+}
+
+// If-Modified-Since is only evaluated without If-None-Match, as required by RFC 9110
+func notModified(r *http.Request, header http.Header) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := header.Get("ETag")
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || (etag != "" && candidate == etag) {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
+}
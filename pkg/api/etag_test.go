@@ -0,0 +1,44 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import "testing"
+
+func TestRunResult(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/summary", true},
+		{"/status", true},
+		{"/usage/diff", true},
+		{"/usage/a/forecast", true},
+		{"/usage/a/months", true},
+		{"/usage", false},
+		{"/usage/a", false},
+		{"/usage/a/annotations", false},
+		{"/quotas", false},
+		{"/violations", false},
+		{"/jobs/1", false},
+		{"/prices", false},
+	}
+	for _, test := range tests {
+		if result := runResult(test.path); result != test.expected {
+			t.Errorf("runResult(%v) = %v, expected %v", test.path, result, test.expected)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/billing"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// getInvoices returns the invoice line items of [from, to), by default of the last closed month,
+// as JSON or as CSV with format=csv
+func (a *Api) getInvoices(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	current, _ := model.InvoicePeriodOf(time.Now())
+	from, to := model.InvoicePeriodOf(current.AddDate(0, 0, -1))
+	var err error
+	if r.URL.Query().Has("from") {
+		from, err = model.ParseDate(r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if r.URL.Query().Has("to") {
+		to, err = model.ParseDate(r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+	items, err := a.traced(r).InvoiceLineItems(from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result := []model.InvoiceLineItem{}
+	for _, item := range items {
+		if acc.allowsSubject(model.QuotaKindUser, item.UserId) {
+			result = append(result, item)
+		}
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJson(w, result)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		err = billing.WriteCsv(w, result)
+		if err != nil {
+			log.Println("ERROR: unable to write csv", err)
+		}
+	default:
+		http.Error(w, "unknown format", http.StatusBadRequest)
+	}
+}
+
+func (a *Api) listBillingExports(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	exports, err := a.traced(r).ListBillingExports()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, exports)
+}
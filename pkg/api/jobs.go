@@ -0,0 +1,191 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+type jobRequest struct {
+	Kind   string          `json:"kind"`
+	Params model.JobParams `json:"params"`
+}
+
+// createJob starts a report in the background, the result is polled with getJob
+func (a *Api) createJob(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	request := jobRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Kind != model.JobKindDiff && request.Kind != model.JobKindUserSummary {
+		http.Error(w, "kind must be diff or user_summary", http.StatusBadRequest)
+		return
+	}
+	from, err := model.ParseDate(request.Params.From)
+	if err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := model.ParseDate(request.Params.To)
+	if err != nil {
+		http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "to is before from", http.StatusBadRequest)
+		return
+	}
+	job, err := a.traced(r).CreateJob(request.Kind, request.Params, acc.subject)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	select {
+	case a.jobs <- queuedJob{db: a.traced(r), job: job}:
+	default:
+		err = a.db.FinishJob(job.Id, nil, errJobQueueFull)
+		if err != nil {
+			log.Println("ERROR: unable to fail job", job.Id, err)
+		}
+		http.Error(w, errJobQueueFull.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	writeJson(w, job)
+}
+
+var errJobQueueFull = errors.New("too many pending jobs")
+
+type queuedJob struct {
+	db  *database.DB
+	job model.Job
+}
+
+// startJobWorkers runs api_job_workers jobs at a time. On shutdown, the running jobs are finished, queued jobs stay
+// pending and are failed as interrupted by the next start.
+func (a *Api) startJobWorkers(ctx context.Context, workers *sync.WaitGroup) {
+	for range max(a.config.ApiJobWorkers, 1) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case j := <-a.jobs:
+					a.runJob(j.db, j.job)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+// runJob runs in the background, with the queries still tagged by the traceparent of the creating request
+func (a *Api) runJob(db *database.DB, job model.Job) {
+	err := db.StartJob(job.Id)
+	if err != nil {
+		log.Println("ERROR: unable to start job", job.Id, err)
+		return
+	}
+	from, _ := model.ParseDate(job.Params.From)
+	to, _ := model.ParseDate(job.Params.To)
+	var result interface{}
+	switch job.Kind {
+	case model.JobKindDiff:
+		result, err = db.Diff(from, to)
+	case model.JobKindUserSummary:
+		result, err = db.UserSummary(from, to)
+	default:
+		err = errors.New("unknown job kind " + job.Kind)
+	}
+	err = db.FinishJob(job.Id, result, err)
+	if err != nil {
+		log.Println("ERROR: unable to store result of job", job.Id, err)
+	}
+}
+
+// getJob returns jobs only to their creator and admins. Results are filtered like the synchronous endpoints.
+func (a *Api) getJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	job, err := a.traced(r).GetJob(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !acc.admin && job.CreatedBy != acc.subject {
+		writeError(w, database.ErrNotFound)
+		return
+	}
+	if !acc.admin && job.Result != nil {
+		job.Result, err = filterJobResult(job, acc)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	writeJson(w, job)
+}
+
+func filterJobResult(job model.Job, acc access) (json.RawMessage, error) {
+	switch job.Kind {
+	case model.JobKindDiff:
+		diff := model.Diff{}
+		err := json.Unmarshal(job.Result, &diff)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(filterDiff(diff, acc))
+	case model.JobKindUserSummary:
+		summaries := []model.UserSummary{}
+		err := json.Unmarshal(job.Result, &summaries)
+		if err != nil {
+			return nil, err
+		}
+		result := []model.UserSummary{}
+		for _, summary := range summaries {
+			if summary.UserId == acc.subject {
+				result = append(result, summary)
+			}
+		}
+		return json.Marshal(result)
+	}
+	return nil, errors.New("unknown job kind " + job.Kind)
+}
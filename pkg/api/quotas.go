@@ -0,0 +1,106 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func validQuotaKind(kind string) bool {
+	return kind == model.QuotaKindUser || kind == model.QuotaKindTable
+}
+
+func (a *Api) listQuotas(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	quotas, err := a.traced(r).ListQuotas()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result := []model.Quota{}
+	for _, quota := range quotas {
+		if acc.allowsSubject(quota.Kind, quota.Subject) {
+			result = append(result, quota)
+		}
+	}
+	writeJson(w, result)
+}
+
+func (a *Api) getQuota(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	if !acc.allowsSubject(r.PathValue("kind"), r.PathValue("subject")) {
+		writeError(w, database.ErrNotFound)
+		return
+	}
+	quota, err := a.traced(r).GetQuota(r.PathValue("kind"), r.PathValue("subject"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, quota)
+}
+
+func (a *Api) putQuota(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	kind := r.PathValue("kind")
+	if !validQuotaKind(kind) {
+		http.Error(w, "kind must be user or table", http.StatusBadRequest)
+		return
+	}
+	quota := model.Quota{}
+	err := json.NewDecoder(r.Body).Decode(&quota)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if quota.Bytes < 0 {
+		http.Error(w, "bytes must not be negative", http.StatusBadRequest)
+		return
+	}
+	quota.Kind = kind
+	quota.Subject = r.PathValue("subject")
+	quota, err = a.traced(r).SetQuota(quota)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, quota)
+}
+
+func (a *Api) deleteQuota(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	err := a.traced(r).DeleteQuota(r.PathValue("kind"), r.PathValue("subject"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
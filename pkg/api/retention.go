@@ -0,0 +1,182 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func (a *Api) listRetentions(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	retentions, err := a.traced(r).ListRetentions()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, retentions)
+}
+
+func (a *Api) putRetention(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	kind := r.PathValue("kind")
+	if !slices.Contains(model.RetentionKinds, kind) {
+		http.Error(w, "kind must be history, aggregates or audit", http.StatusBadRequest)
+		return
+	}
+	retention := model.Retention{}
+	err := json.NewDecoder(r.Body).Decode(&retention)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	retention, err = a.traced(r).SetRetention(kind, retention.Interval)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, retention)
+}
+
+func (a *Api) deleteRetention(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	err := a.traced(r).DeleteRetention(r.PathValue("kind"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const retentionTokenValidity = 10 * time.Minute
+
+// retentionToken binds a confirmation to the table, cutoff and caller, so it can't be replayed for other drops
+func (a *Api) retentionToken(table string, before time.Time, subject string, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, []byte(a.config.RetentionTokenSecret))
+	mac.Write([]byte(strings.Join([]string{table, before.UTC().Format(time.RFC3339Nano), subject, strconv.FormatInt(expiresAt.Unix(), 10)}, "\n")))
+	return strconv.FormatInt(expiresAt.Unix(), 10) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *Api) validRetentionToken(token string, table string, before time.Time, subject string) bool {
+	expires, _, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return false
+	}
+	expiresAt := time.Unix(unix, 0)
+	if time.Now().After(expiresAt) {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(a.retentionToken(table, before, subject, expiresAt)))
+}
+
+// retentionRequest checks access to the table and parses the request, applying retention is disabled without secret
+func (a *Api) retentionRequest(w http.ResponseWriter, r *http.Request) (acc access, request model.RetentionRequest, before time.Time, ok bool) {
+	if a.config.RetentionTokenSecret == "" || a.config.SourceReadOnly {
+		http.Error(w, "applying retention is disabled", http.StatusForbidden)
+		return acc, request, before, false
+	}
+	acc, ok = a.getAccess(w, r)
+	if !ok {
+		return acc, request, before, false
+	}
+	if !acc.allowsTable(r.PathValue("table")) {
+		writeError(w, database.ErrNotFound)
+		return acc, request, before, false
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return acc, request, before, false
+	}
+	before, err = model.ParseDate(request.Before)
+	if err != nil {
+		http.Error(w, "invalid before: "+err.Error(), http.StatusBadRequest)
+		return acc, request, before, false
+	}
+	return acc, request, before, true
+}
+
+// confirmRetention estimates the effect of a drop and returns the token required to apply it
+func (a *Api) confirmRetention(w http.ResponseWriter, r *http.Request) {
+	acc, _, before, ok := a.retentionRequest(w, r)
+	if !ok {
+		return
+	}
+	simulation, err := a.traced(r).SimulateDrop(r.PathValue("table"), before)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	expiresAt := time.Now().Add(retentionTokenValidity)
+	writeJson(w, model.RetentionConfirmation{
+		RetentionSimulation: simulation,
+		Token:               a.retentionToken(simulation.Table, before, acc.subject, expiresAt),
+		ExpiresAt:           expiresAt,
+	})
+}
+
+// applyRetention drops all chunks of the table ending before the confirmed date
+func (a *Api) applyRetention(w http.ResponseWriter, r *http.Request) {
+	acc, request, before, ok := a.retentionRequest(w, r)
+	if !ok {
+		return
+	}
+	table := r.PathValue("table")
+	if !a.validRetentionToken(request.Token, table, before, acc.subject) {
+		http.Error(w, "invalid or expired confirmation token", http.StatusForbidden)
+		return
+	}
+	by := acc.subject
+	if by == "" {
+		by = "api"
+	}
+	tags, err := a.traced(r).TableTags(table)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if slices.Contains(tags, model.AnnotationTagKeep) {
+		http.Error(w, "table is annotated with "+model.AnnotationTagKeep, http.StatusConflict)
+		return
+	}
+	chunks, err := a.traced(r).DropChunks(table, before, by)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, model.RetentionResult{Table: table, Before: before, DroppedChunks: chunks})
+}
@@ -0,0 +1,52 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/signing"
+)
+
+// signed adds a detached JWS of the body to successful responses of usage and billing documents,
+// so consumers can verify that the figures originate from this service
+func (a *Api) signed(next http.HandlerFunc) http.HandlerFunc {
+	if a.signer == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+		next(recorder, r)
+		if recorder.status == http.StatusOK {
+			signature, err := a.signer.SignDetached(recorder.body.Bytes())
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			recorder.header.Set(signing.Header, signature)
+		}
+		recorder.writeTo(w)
+	}
+}
+
+func (a *Api) getJwks(w http.ResponseWriter, r *http.Request) {
+	if a.signer == nil {
+		http.Error(w, "signing disabled", http.StatusNotFound)
+		return
+	}
+	writeJson(w, a.signer.Jwks())
+}
@@ -0,0 +1,107 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/debug"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func (a *Api) getStatus(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	status, err := a.traced(r).ListRunStatus()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, status)
+}
+
+// getRuns lists the runs started in [from, to), by default of the last 30 days
+func (a *Api) getRuns(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	var err error
+	if r.URL.Query().Has("from") {
+		from, err = model.ParseDate(r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if r.URL.Query().Has("to") {
+		to, err = model.ParseDate(r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	runs, err := a.traced(r).ListRuns(from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, runs)
+}
+
+// listOutbox lists the events not delivered yet
+func (a *Api) listOutbox(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	entries, err := a.traced(r).ListOutboxEntries()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, entries)
+}
+
+type debugState struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (a *Api) getDebug(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	writeJson(w, debugState{Enabled: debug.Enabled()})
+}
+
+// putDebug toggles verbose debug logging at runtime, like SIGUSR1
+func (a *Api) putDebug(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	state := debugState{}
+	err := json.NewDecoder(r.Body).Decode(&state)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	debug.Set(state.Enabled)
+	writeJson(w, state)
+}
@@ -0,0 +1,58 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+)
+
+func (a *Api) getSummary(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	summary, err := a.traced(r).GetSummary()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, summary)
+}
+
+func (a *Api) getFederation(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	federation, err := a.traced(r).GetFederation()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, federation)
+}
+
+// getFederationTables lists the tables of all federated clusters, labeled with their cluster
+func (a *Api) getFederationTables(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	usages, err := a.traced(r).GetFederationTables()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, usages)
+}
@@ -0,0 +1,164 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+//go:embed ui.html
+var uiHtml string
+
+var uiTemplate = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"int64": func(f float64) int64 { return int64(f) },
+}).Parse(uiHtml))
+
+const (
+	uiTables      = 25
+	uiHistoryDays = 30
+	uiChartWidth  = 200
+	uiChartHeight = 30
+)
+
+type uiPage struct {
+	Summary     *model.Summary
+	Stale       bool
+	StaleAfter  time.Duration
+	Tables      []uiTable
+	Violations  []model.Violation
+	Quotas      []model.Quota
+	HistoryDays int
+	ChartWidth  int
+	ChartHeight int
+}
+
+type uiTable struct {
+	Usage  model.Usage
+	Points string
+}
+
+// getUi renders an overview for operators without a dashboard
+func (a *Api) getUi(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	page := uiPage{HistoryDays: uiHistoryDays, ChartWidth: uiChartWidth, ChartHeight: uiChartHeight}
+
+	summary, err := a.traced(r).GetSummary()
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		writeError(w, err)
+		return
+	}
+	if err == nil {
+		page.Summary = &summary
+		interval, err := time.ParseDuration(a.config.Duration)
+		if err == nil {
+			page.StaleAfter = 2 * interval
+			page.Stale = time.Since(summary.UpdatedAt) > page.StaleAfter
+		}
+	}
+
+	usages, err := a.traced(r).LargestTables(uiTables)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	tables := []string{}
+	for _, usage := range usages {
+		tables = append(tables, usage.Table)
+	}
+	history, err := a.traced(r).HistoryOfTables(tables, time.Now().AddDate(0, 0, -uiHistoryDays))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	historyOfTable := map[string][]model.HistoryEntry{}
+	for _, entry := range history {
+		historyOfTable[entry.Table] = append(historyOfTable[entry.Table], entry)
+	}
+	for _, usage := range usages {
+		page.Tables = append(page.Tables, uiTable{Usage: usage, Points: sparkline(historyOfTable[usage.Table])})
+	}
+
+	page.Violations, err = a.traced(r).ListViolations(false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page.Quotas, err = a.traced(r).ListQuotas()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = uiTemplate.Execute(w, page)
+	if err != nil {
+		log.Println("ERROR: unable to render ui", err)
+	}
+}
+
+// sparkline scales the history to the points of an svg polyline, time on the x-axis and bytes on the y-axis
+func sparkline(entries []model.HistoryEntry) string {
+	if len(entries) < 2 {
+		return ""
+	}
+	first, last := entries[0].Time, entries[len(entries)-1].Time
+	minBytes, maxBytes := entries[0].Bytes, entries[0].Bytes
+	for _, entry := range entries {
+		minBytes = min(minBytes, entry.Bytes)
+		maxBytes = max(maxBytes, entry.Bytes)
+	}
+	duration := last.Sub(first).Seconds()
+	points := []string{}
+	for _, entry := range entries {
+		x := 0.0
+		if duration > 0 {
+			x = entry.Time.Sub(first).Seconds() / duration * uiChartWidth
+		}
+		y := float64(uiChartHeight) / 2
+		if maxBytes > minBytes {
+			y = uiChartHeight - float64(entry.Bytes-minBytes)/float64(maxBytes-minBytes)*uiChartHeight
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	return strings.Join(points, " ")
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit && b > -unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	value, exp := float64(b), 0
+	for value >= unit*unit || value <= -unit*unit {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value/unit, "KMGTPE"[exp])
+}
@@ -0,0 +1,69 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+const maxUsageQueryTables = 10000
+
+// listUsage returns the usage of all tables, e.g. for federating instances
+func (a *Api) listUsage(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	usages, err := a.traced(r).ListUsages()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, usages)
+}
+
+func (a *Api) queryUsage(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	query := model.UsageQuery{}
+	err := json.NewDecoder(r.Body).Decode(&query)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(query.Tables) > maxUsageQueryTables {
+		http.Error(w, "at most "+strconv.Itoa(maxUsageQueryTables)+" tables per query", http.StatusBadRequest)
+		return
+	}
+	tables := []string{}
+	for _, table := range query.Tables {
+		if acc.allowsTable(table) {
+			tables = append(tables, table)
+		}
+	}
+	usages, err := a.traced(r).GetUsages(tables)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, usages)
+}
@@ -0,0 +1,118 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func (a *Api) listViolations(w http.ResponseWriter, r *http.Request) {
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	violations, err := a.traced(r).ListViolations(r.URL.Query().Get("resolved") == "true")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result := []model.Violation{}
+	for _, violation := range violations {
+		if acc.allowsSubject(violation.Kind, violation.Subject) {
+			result = append(result, violation)
+		}
+	}
+	writeJson(w, result)
+}
+
+func (a *Api) ackViolation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	c, err := getClaims(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	acc, ok := a.getAccess(w, r)
+	if !ok {
+		return
+	}
+	violation, err := a.traced(r).GetViolation(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !acc.allowsSubject(violation.Kind, violation.Subject) {
+		writeError(w, database.ErrNotFound)
+		return
+	}
+	ack := model.ViolationAck{}
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(&ack)
+		if err != nil {
+			http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	violation, err = a.traced(r).AcknowledgeViolation(id, c.Subject, ack.Comment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, violation)
+}
+
+func (a *Api) overrideViolation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	c, err := getClaims(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	override := model.ViolationOverride{}
+	err = json.NewDecoder(r.Body).Decode(&override)
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !override.Until.After(time.Now()) {
+		http.Error(w, "until must be in the future", http.StatusBadRequest)
+		return
+	}
+	violation, err := a.traced(r).OverrideViolation(id, c.Subject, override.Until, override.Comment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, violation)
+}
@@ -0,0 +1,231 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package billing
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/signing"
+)
+
+// BillingExporter delivers the invoice line items of a closed period to a billing or ERP system.
+// The idempotency key is the same for every attempt of a period, so a system receiving a retried
+// delivery can avoid booking it twice.
+type BillingExporter interface {
+	Name() string
+	Export(ctx context.Context, idempotencyKey string, items []model.InvoiceLineItem) error
+}
+
+// New creates the exporters listed in config.BillingExporters.
+func New(config configuration.Config) ([]BillingExporter, error) {
+	signer, err := signing.New(config)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: time.Minute}
+	exporters := []BillingExporter{}
+	for _, name := range config.BillingExporters {
+		switch name {
+		case "http":
+			exporters = append(exporters, &httpExporter{client: client, url: config.InvoicePushUrl, signer: signer})
+		default:
+			return nil, fmt.Errorf("unknown billing exporter %v", name)
+		}
+	}
+	return exporters, nil
+}
+
+type Pusher struct {
+	db        *database.DB
+	config    configuration.Config
+	exporters []BillingExporter
+	backoff   time.Duration
+}
+
+// Start exports the invoice line items of every closed month with all configured billing exporters, checking hourly
+// for closed months that have not been exported successfully yet. The state of each export is kept in usage_billing_exports.
+func Start(ctx context.Context, wg *sync.WaitGroup, config configuration.Config) error {
+	backoff, err := time.ParseDuration(config.BillingExportRetryBackoff)
+	if err != nil {
+		return err
+	}
+	exporters, err := New(config)
+	if err != nil {
+		return err
+	}
+	db, err := database.New(config, "billing")
+	if err != nil {
+		return err
+	}
+	p := &Pusher{db: db, config: config, exporters: exporters, backoff: backoff}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer db.Close()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			err := p.push(ctx)
+			if err != nil {
+				log.Println("ERROR: billing export", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *Pusher) push(ctx context.Context) error {
+	current, _ := model.InvoicePeriodOf(time.Now())
+	last, _ := model.InvoicePeriodOf(current.AddDate(0, 0, -1))
+	exports, err := p.db.ListBillingExports()
+	if err != nil {
+		return err
+	}
+	items := map[time.Time][]model.InvoiceLineItem{}
+	errs := []error{}
+	for _, exporter := range p.exporters {
+		for _, state := range pendingExports(exporter.Name(), exports, last) {
+			start, end := model.InvoicePeriodOf(state.PeriodStart)
+			if items[start] == nil {
+				items[start], err = p.db.InvoiceLineItems(start, end)
+				if err != nil {
+					return err
+				}
+			}
+			err = p.export(ctx, exporter, &state, items[start])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v %v: %w", exporter.Name(), start.Format("2006-01"), err))
+				continue
+			}
+			log.Println("Exported invoice line items of", start.Format("2006-01"), "with", exporter.Name())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pendingExports lists the closed periods up to last that the exporter has not exported successfully yet, oldest
+// first. Periods are retried from the first period the exporter has a record of, an exporter without records
+// starts with the last closed period.
+func pendingExports(exporter string, exports []model.BillingExport, last time.Time) (pending []model.BillingExport) {
+	states := map[time.Time]model.BillingExport{}
+	first := last
+	for _, e := range exports {
+		if e.Exporter != exporter {
+			continue
+		}
+		start, _ := model.InvoicePeriodOf(e.PeriodStart)
+		states[start] = e
+		if start.Before(first) {
+			first = start
+		}
+	}
+	for start := first; !start.After(last); start = start.AddDate(0, 1, 0) {
+		state, ok := states[start]
+		if !ok {
+			state = model.BillingExport{Exporter: exporter, PeriodStart: start, IdempotencyKey: idempotencyKey(exporter, start)}
+		}
+		if state.Status != model.BillingExportStatusSucceeded {
+			pending = append(pending, state)
+		}
+	}
+	return pending
+}
+
+// export tries billing_export_retries + 1 times with doubling backoff, recording every attempt
+func (p *Pusher) export(ctx context.Context, exporter BillingExporter, state *model.BillingExport, items []model.InvoiceLineItem) (err error) {
+	backoff := p.backoff
+	for i := 0; i <= p.config.BillingExportRetries; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+		err = exporter.Export(ctx, state.IdempotencyKey, items)
+		state.Attempts++
+		state.UpdatedAt = time.Now()
+		state.Status = model.BillingExportStatusSucceeded
+		state.LastError = ""
+		if err != nil {
+			state.Status = model.BillingExportStatusFailed
+			state.LastError = err.Error()
+		}
+		dbErr := p.db.SetBillingExport(*state)
+		if dbErr != nil {
+			return dbErr
+		}
+		if err == nil {
+			return nil
+		}
+		log.Println("WARNING: billing export attempt", state.Attempts, "with", exporter.Name(), "failed", err)
+	}
+	return err
+}
+
+func idempotencyKey(exporter string, periodStart time.Time) string {
+	return "timescale-usage-" + exporter + "-" + periodStart.Format("2006-01")
+}
+
+var csvHeader = []string{"user_id", "period_start", "period_end", "gb_days", "unit_price", "discount_factor", "total", "currency", "derived_gb_days", "derived_included"}
+
+// WriteCsv writes the line items as CSV with a header row
+func WriteCsv(w io.Writer, items []model.InvoiceLineItem) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		err = writer.Write([]string{
+			item.UserId,
+			item.PeriodStart.Format(time.RFC3339),
+			item.PeriodEnd.Format(time.RFC3339),
+			strconv.FormatFloat(item.GbDays, 'f', -1, 64),
+			strconv.FormatFloat(item.UnitPrice, 'f', -1, 64),
+			strconv.FormatFloat(item.DiscountFactor, 'f', -1, 64),
+			strconv.FormatFloat(item.Total, 'f', -1, 64),
+			item.Currency,
+			strconv.FormatFloat(item.DerivedGbDays, 'f', -1, 64),
+			strconv.FormatBool(item.DerivedIncluded),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,112 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package billing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		exporter    string
+		periodStart time.Time
+		expected    string
+	}{
+		{"http", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), "timescale-usage-http-2024-04"},
+		{"http", time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), "timescale-usage-http-2024-12"},
+		{"csv", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), "timescale-usage-csv-2024-04"},
+	}
+	for _, test := range tests {
+		if key := idempotencyKey(test.exporter, test.periodStart); key != test.expected {
+			t.Errorf("idempotencyKey(%v, %v) = %v, expected %v", test.exporter, test.periodStart, key, test.expected)
+		}
+	}
+}
+
+func TestWriteCsv(t *testing.T) {
+	start := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		items    []model.InvoiceLineItem
+		expected string
+	}{
+		{
+			name:     "no items",
+			expected: "user_id,period_start,period_end,gb_days,unit_price,discount_factor,total,currency,derived_gb_days,derived_included\n",
+		},
+		{
+			name: "exact decimals",
+			items: []model.InvoiceLineItem{
+				{UserId: "a", PeriodStart: start, PeriodEnd: start.AddDate(0, 1, 0), GbDays: 1.5, UnitPrice: 0.1, DiscountFactor: 1, Total: 0.15, Currency: "EUR"},
+				{UserId: "b,c", PeriodStart: start, PeriodEnd: start.AddDate(0, 1, 0), GbDays: 2, UnitPrice: 0.5, DiscountFactor: 0.5, Total: 1, Currency: "EUR", DerivedGbDays: 3, DerivedIncluded: true},
+			},
+			expected: "user_id,period_start,period_end,gb_days,unit_price,discount_factor,total,currency,derived_gb_days,derived_included\n" +
+				"a,2024-04-01T00:00:00Z,2024-05-01T00:00:00Z,1.5,0.1,1,0.15,EUR,0,false\n" +
+				"\"b,c\",2024-04-01T00:00:00Z,2024-05-01T00:00:00Z,2,0.5,0.5,1,EUR,3,true\n",
+		},
+	}
+	for _, test := range tests {
+		b := strings.Builder{}
+		if err := WriteCsv(&b, test.items); err != nil {
+			t.Error(test.name, err)
+			continue
+		}
+		if b.String() != test.expected {
+			t.Errorf("%v: got\n%v\nexpected\n%v", test.name, b.String(), test.expected)
+		}
+	}
+}
+
+func TestPendingExports(t *testing.T) {
+	month := func(m time.Month) time.Time {
+		return time.Date(2024, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	export := func(exporter string, m time.Month, status string) model.BillingExport {
+		return model.BillingExport{Exporter: exporter, PeriodStart: month(m).In(time.FixedZone("CET", 3600)), IdempotencyKey: idempotencyKey(exporter, month(m)), Status: status}
+	}
+	tests := []struct {
+		name     string
+		exports  []model.BillingExport
+		expected []time.Month
+	}{
+		{"no exports", nil, []time.Month{4}},
+		{"last period succeeded", []model.BillingExport{export("http", 4, model.BillingExportStatusSucceeded)}, nil},
+		{"other exporter", []model.BillingExport{export("csv", 1, model.BillingExportStatusSucceeded)}, []time.Month{4}},
+		{"pusher was down", []model.BillingExport{export("http", 1, model.BillingExportStatusSucceeded)}, []time.Month{2, 3, 4}},
+		{"older period failed", []model.BillingExport{
+			export("http", 2, model.BillingExportStatusFailed),
+			export("http", 3, model.BillingExportStatusSucceeded),
+			export("http", 4, model.BillingExportStatusFailed),
+		}, []time.Month{2, 4}},
+	}
+	for _, test := range tests {
+		pending := pendingExports("http", test.exports, month(4))
+		if len(pending) != len(test.expected) {
+			t.Errorf("%v: got %v pending exports, expected %v", test.name, len(pending), len(test.expected))
+			continue
+		}
+		for i, state := range pending {
+			if !state.PeriodStart.Equal(month(test.expected[i])) || state.Exporter != "http" || state.IdempotencyKey != idempotencyKey("http", month(test.expected[i])) {
+				t.Errorf("%v: unexpected pending export %v, expected period %v", test.name, state, test.expected[i])
+			}
+		}
+	}
+}
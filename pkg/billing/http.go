@@ -0,0 +1,70 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package billing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/signing"
+)
+
+// httpExporter posts the line items as JSON array to invoice_push_url with an Idempotency-Key header
+type httpExporter struct {
+	client *http.Client
+	url    string
+	signer *signing.Signer
+}
+
+func (h *httpExporter) Name() string {
+	return "http"
+}
+
+func (h *httpExporter) Export(ctx context.Context, idempotencyKey string, items []model.InvoiceLineItem) error {
+	payload, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	signature, err := h.signer.SignDetached(payload)
+	if err != nil {
+		return err
+	}
+	if signature != "" {
+		req.Header.Set(signing.Header, signature)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %v: %v", resp.StatusCode, string(body))
+	}
+	return nil
+}
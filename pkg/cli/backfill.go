@@ -0,0 +1,44 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package cli
+
+import (
+	"flag"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+)
+
+func backfill(config configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report the snapshots that would be created")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.New(config, "backfill")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	result, err := db.Backfill(*dryRun)
+	if err != nil {
+		return err
+	}
+	return printJson(result)
+}
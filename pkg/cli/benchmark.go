@@ -0,0 +1,53 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package cli
+
+import (
+	"context"
+	"flag"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/worker"
+)
+
+// generate fills the benchmark_schema with synthetic hypertables for bench
+func generate(config configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	tables := flags.Int("tables", 100, "number of hypertables, 0 drops the generated tables")
+	chunks := flags.Int("chunks", 30, "number of daily chunks per hypertable")
+	rows := flags.Int("rows", 100, "number of rows per chunk")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	return worker.Generate(context.Background(), config, *tables, *chunks, *rows)
+}
+
+// bench times consecutive collection runs, to catch performance regressions before they reach large databases
+func bench(config configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := flags.Int("runs", 3, "number of runs")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	report, err := worker.Benchmark(context.Background(), config, *runs)
+	if err != nil {
+		return err
+	}
+	return printJson(report)
+}
@@ -0,0 +1,95 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package cli
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/worker"
+)
+
+// dump writes the usage schema as JSON lines bundle, to stdout unless a file is given
+func dump(config configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	file := flags.String("file", "", "bundle to write, stdout if empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	db, err := database.New(config, "dump")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	counts, err := db.Dump(out)
+	if err != nil {
+		return err
+	}
+	for table, count := range counts {
+		log.Println("dumped", count, "rows of", table)
+	}
+	return nil
+}
+
+// restore migrates the usage schema and inserts a bundle written by dump, read from stdin unless a file is given
+func restore(config configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	file := flags.String("file", "", "bundle to read, stdin if empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	var in io.Reader = os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	err = worker.Migrate(config)
+	if err != nil {
+		return err
+	}
+	db, err := database.New(config, "restore")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	counts, err := db.Restore(in)
+	if err != nil {
+		return err
+	}
+	return printJson(counts)
+}
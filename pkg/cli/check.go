@@ -0,0 +1,38 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package cli
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/worker"
+)
+
+// check prints the report of worker.Check and fails if any check failed, for use in deployment pipelines
+func check(config configuration.Config, args []string) error {
+	report := worker.Check(context.Background(), config)
+	err := printJson(report)
+	if err != nil {
+		return err
+	}
+	if !report.Ok {
+		return errors.New("check failed")
+	}
+	return nil
+}
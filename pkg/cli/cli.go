@@ -0,0 +1,58 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+)
+
+type command func(config configuration.Config, args []string) error
+
+var commands = map[string]command{
+	"diff":     diff,
+	"backfill": backfill,
+	"dump":     dump,
+	"restore":  restore,
+	"invoices": invoices,
+	"check":    check,
+	"purge":    purge,
+	"generate": generate,
+	"bench":    bench,
+}
+
+// Run executes the command named by args[0] and prints its result to stdout.
+func Run(config configuration.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing command")
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %v", args[0])
+	}
+	return cmd(config, args[1:])
+}
+
+func printJson(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(value)
+}
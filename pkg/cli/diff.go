@@ -0,0 +1,58 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package cli
+
+import (
+	"errors"
+	"flag"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func diff(config configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	fromStr := flags.String("from", "", "start of the report, RFC3339 or YYYY-MM-DD")
+	toStr := flags.String("to", "", "end of the report, RFC3339 or YYYY-MM-DD")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	from, err := model.ParseDate(*fromStr)
+	if err != nil {
+		return err
+	}
+	to, err := model.ParseDate(*toStr)
+	if err != nil {
+		return err
+	}
+	if to.Before(from) {
+		return errors.New("to is before from")
+	}
+
+	db, err := database.New(config, "diff")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	result, err := db.Diff(from, to)
+	if err != nil {
+		return err
+	}
+	return printJson(result)
+}
@@ -0,0 +1,65 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/billing"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func invoices(config configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("invoices", flag.ExitOnError)
+	monthStr := flags.String("month", "", "month to bill, YYYY-MM, defaults to the last closed month")
+	format := flags.String("format", "json", "output format, json or csv")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	current, _ := model.InvoicePeriodOf(time.Now())
+	from, to := model.InvoicePeriodOf(current.AddDate(0, 0, -1))
+	if *monthStr != "" {
+		month, err := time.Parse("2006-01", *monthStr)
+		if err != nil {
+			return err
+		}
+		from, to = model.InvoicePeriodOf(month)
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown format %v", *format)
+	}
+
+	db, err := database.New(config, "invoices")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	items, err := db.InvoiceLineItems(from, to)
+	if err != nil {
+		return err
+	}
+	if *format == "csv" {
+		return billing.WriteCsv(os.Stdout, items)
+	}
+	return printJson(items)
+}
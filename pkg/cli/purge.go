@@ -0,0 +1,55 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package cli
+
+import (
+	"errors"
+	"flag"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// purge deletes all records of a user or table and prints the deletion report
+func purge(config configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	user := flags.String("user", "", "user whose tables and records are purged")
+	table := flags.String("table", "", "table whose records are purged")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if (*user == "") == (*table == "") {
+		return errors.New("either -user or -table is required")
+	}
+	request := model.DeletionRequest{Kind: model.DeletionKindUser, Subject: *user}
+	if *table != "" {
+		request = model.DeletionRequest{Kind: model.DeletionKindTable, Subject: *table}
+	}
+
+	db, err := database.New(config, "purge")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	report, err := db.Purge(request)
+	if err != nil {
+		return err
+	}
+	return printJson(report)
+}
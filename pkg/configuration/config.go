@@ -28,15 +28,142 @@ import (
 )
 
 type ConfigStruct struct {
-	PostgresHost         string `json:"postgres_host"`
-	PostgresPort         uint16 `json:"postgres_port"`
-	PostgresUser         string `json:"postgres_user"`
-	PostgresDb           string `json:"postgres_db"`
-	PostgresPw           string `json:"postgres_pw"`
-	PostgresSourceSchema string `json:"postgres_source_schema"`
-	PostgresUsageSchema  string `json:"postgres_usage_schema"`
-	Duration             string `json:"duration"`
-	MetricsPort          int    `json:"metrics_port"`
+	PostgresHost              string            `json:"postgres_host"`
+	PostgresPort              uint16            `json:"postgres_port"`
+	PostgresUser              string            `json:"postgres_user"`
+	PostgresDb                string            `json:"postgres_db"`
+	PostgresPw                string            `json:"postgres_pw"`
+	PostgresSourceUser        string            `json:"postgres_source_user"` // reads the source tables, postgres_user if empty
+	PostgresSourcePw          string            `json:"postgres_source_pw"`
+	PostgresSourceSchema      string            `json:"postgres_source_schema"`
+	Dialect                   string            `json:"dialect"`
+	PostgresUsageSchema       string            `json:"postgres_usage_schema"`
+	SourceReadOnly            bool              `json:"source_read_only"`
+	ApplicationName           string            `json:"application_name"`
+	SearchPath                string            `json:"search_path"`
+	SessionSettings           map[string]string `json:"session_settings"` // e.g. work_mem, max_parallel_workers_per_gather or statement_timeout
+	Duration                  string            `json:"duration"`
+	RunOverlap                string            `json:"run_overlap"`
+	MaxRunDuration            string            `json:"max_run_duration"`
+	ShutdownGracePeriod       string            `json:"shutdown_grace_period"` // time a run gets to finish its table on shutdown before its queries are cancelled, waits if empty
+	ShardCount                int               `json:"shard_count"`
+	ShardIndex                int               `json:"shard_index"`
+	ShardIndexFromHostname    bool              `json:"shard_index_from_hostname"`
+	ShardTimeout              string            `json:"shard_timeout"`
+	LockTimeout               string            `json:"lock_timeout"`
+	HealthCheckInterval       string            `json:"health_check_interval"`
+	MetricsPort               int               `json:"metrics_port"`
+	MetricsNamespace          string            `json:"metrics_namespace"`
+	MetricsConstLabels        map[string]string `json:"metrics_const_labels"`
+	MetricsTopK               int               `json:"metrics_top_k"`
+	RuntimeMetrics            bool              `json:"runtime_metrics"`
+	Pprof                     bool              `json:"pprof"`
+	PprofToken                string            `json:"pprof_token"`
+	Debug                     bool              `json:"debug"`
+	LogTableNames             string            `json:"log_table_names"`
+	ApiPort                   int               `json:"api_port"`
+	ApiAdminRole              string            `json:"api_admin_role"`
+	ApiInsecureNoAuth         bool              `json:"api_insecure_no_auth"` // every caller is an admin, for local development only
+	ApiCacheTtl               string            `json:"api_cache_ttl"`
+	ApiAccessAudit            bool              `json:"api_access_audit"`
+	ApiJobWorkers             int               `json:"api_job_workers"` // jobs run at the same time
+	ApiJobQueue               int               `json:"api_job_queue"`   // jobs waiting for a worker, further jobs are rejected
+	RetentionTokenSecret      string            `json:"retention_token_secret"`
+	GrowthModelSnapshots      int64             `json:"growth_model_snapshots"`
+	HistoryRetention          string            `json:"history_retention"`
+	HistoryAggregateRetention string            `json:"history_aggregate_retention"`
+	AuditRetention            string            `json:"audit_retention"`
+	HistoryDownsampleAfter    string            `json:"history_downsample_after"`
+	SeasonalForecast          bool              `json:"seasonal_forecast"`
+	SeasonalForecastDays      int64             `json:"seasonal_forecast_days"`
+	SeasonalAlpha             float64           `json:"seasonal_alpha"`
+	SeasonalBeta              float64           `json:"seasonal_beta"`
+	SeasonalGamma             float64           `json:"seasonal_gamma"`
+	TieredSizeQuery           string            `json:"tiered_size_query"`
+	TablespaceSizes           bool              `json:"tablespace_sizes"`
+	SmoothingFactor           float64           `json:"smoothing_factor"`
+	MaterializedViews         bool              `json:"materialized_views"`
+	PartitionedTables         bool              `json:"partitioned_tables"`
+	CaggSourceAttribution     bool              `json:"cagg_source_attribution"`
+	CaggTotals                string            `json:"cagg_totals"`
+	QueryStats                bool              `json:"query_stats"`
+	TenantSchemaPattern       string            `json:"tenant_schema_pattern"`
+	ExportIdPattern           string            `json:"export_id_pattern"`
+	SizeComparison            bool              `json:"size_comparison"`
+	SizeByMonth               bool              `json:"size_by_month"`
+	SizeByPartition           bool              `json:"size_by_partition"`
+	PartitionKeysLimit        int               `json:"partition_keys_limit"` // keys stored per space partition, 0 to skip reading them
+	ColumnSizesTables         int               `json:"column_sizes_tables"`
+	ColumnSizesSampleRows     int               `json:"column_sizes_sample_rows"`
+	DeviceUsageTables         int               `json:"device_usage_tables"` // biggest hypertables to estimate the usage per device of, 0 disables
+	DeviceColumn              string            `json:"device_column"`
+	TinyChunkMinCount         int64             `json:"tiny_chunk_min_count"`
+	TinyChunkBytes            int64             `json:"tiny_chunk_bytes"`
+	SamplingMinBytes          int64             `json:"sampling_min_bytes"`
+	SamplingChunks            int               `json:"sampling_chunks"`
+	DateBatchSize             int               `json:"date_batch_size"`       // tables per query of oldest and newest timestamps, 0 queries each table on its own
+	CollectionBatchSize       int               `json:"collection_batch_size"` // hypertables measured per query, 0 measures each table on its own
+	SnapshotTables            int               `json:"snapshot_tables"`       // tables measured per source transaction before it is renewed, 0 reads the whole run from one transaction
+	PrepareStatements         bool              `json:"prepare_statements"`
+	SlowTableDuration         string            `json:"slow_table_duration"` // collection time of a table above which the plan of its queries is stored, disabled if empty
+	BenchmarkSchema           string            `json:"benchmark_schema"`    // schema of the tables generated for bench, must differ from postgres_source_schema
+
+	CompressionSuggestionMinBytes    int64   `json:"compression_suggestion_min_bytes"`
+	CompressionSuggestionMinFraction float64 `json:"compression_suggestion_min_fraction"`
+	CompressionTypicalSavings        float64 `json:"compression_typical_savings"`
+	CompressionEnforce               bool    `json:"compression_enforce"`
+	CompressionEnforceMinBytes       int64   `json:"compression_enforce_min_bytes"`
+	CompressionEnforceTablePattern   string  `json:"compression_enforce_table_pattern"`
+	CompressionCompressAfter         string  `json:"compression_compress_after"`
+	ReorderSuggestionMinScans        int64   `json:"reorder_suggestion_min_scans"`
+	ReorderSuggestionMaxCorrelation  float64 `json:"reorder_suggestion_max_correlation"`
+	WideTableMinRowBytes             int64   `json:"wide_table_min_row_bytes"`
+	WideTableMinNullColumns          int64   `json:"wide_table_min_null_columns"`
+	ChunkMemoryBytes                 int64   `json:"chunk_memory_bytes"`
+	ChunkTargetBytes                 int64   `json:"chunk_target_bytes"`
+	ChunkIntervalEnforce             bool    `json:"chunk_interval_enforce"`
+
+	ParquetExportDuration    string `json:"parquet_export_duration"`
+	ParquetExportPath        string `json:"parquet_export_path"`
+	ParquetExportS3Endpoint  string `json:"parquet_export_s3_endpoint"`
+	ParquetExportS3Bucket    string `json:"parquet_export_s3_bucket"`
+	ParquetExportS3AccessKey string `json:"parquet_export_s3_access_key"`
+	ParquetExportS3SecretKey string `json:"parquet_export_s3_secret_key"`
+	ParquetExportS3UseSsl    bool   `json:"parquet_export_s3_use_ssl"`
+
+	ThresholdBytes       int64    `json:"threshold_bytes"`
+	Notifiers            []string `json:"notifiers"`
+	NotificationTemplate string   `json:"notification_template"`
+	SlackWebhookUrl      string   `json:"slack_webhook_url"`
+	TeamsWebhookUrl      string   `json:"teams_webhook_url"`
+	MatrixHomeserverUrl  string   `json:"matrix_homeserver_url"`
+	MatrixRoomId         string   `json:"matrix_room_id"`
+	MatrixAccessToken    string   `json:"matrix_access_token"`
+	AlertmanagerUrl      string   `json:"alertmanager_url"`
+
+	QuotaWarningRatio float64  `json:"quota_warning_ratio"`
+	QuotaGracePeriod  string   `json:"quota_grace_period"`
+	QuotaEnforcement  string   `json:"quota_enforcement"`
+	QuotaWriterRoles  []string `json:"quota_writer_roles"`
+
+	CostCurrency  string `json:"cost_currency"`
+	CostPrecision int    `json:"cost_precision"`
+	CostRounding  string `json:"cost_rounding"`
+
+	InvoicePushUrl            string   `json:"invoice_push_url"`
+	BillingExporters          []string `json:"billing_exporters"`
+	BillingExportRetries      int      `json:"billing_export_retries"`
+	BillingExportRetryBackoff string   `json:"billing_export_retry_backoff"`
+
+	SigningKeyFile string `json:"signing_key_file"`
+	SigningKeyId   string `json:"signing_key_id"`
+
+	FederationClusters map[string]string `json:"federation_clusters"` // cluster name to api url of its instance
+	FederationToken    string            `json:"federation_token"`
+	FederationInterval string            `json:"federation_interval"`
+
+	AccountingUrl      string `json:"accounting_url"`
+	OutboxRetryBackoff string `json:"outbox_retry_backoff"`
 }
 
 type Config = *ConfigStruct
@@ -82,7 +209,7 @@ func HandleEnvironmentVars(config Config) {
 		envValue := os.Getenv(envName)
 		if envValue != "" {
 			fmt.Println("use environment variable: ", envName, " = ", envValue)
-			if configValue.FieldByName(fieldName).Kind() == reflect.Int64 {
+			if configValue.FieldByName(fieldName).Kind() == reflect.Int64 || configValue.FieldByName(fieldName).Kind() == reflect.Int {
 				i, _ := strconv.ParseInt(envValue, 10, 64)
 				configValue.FieldByName(fieldName).SetInt(i)
 			}
@@ -111,10 +238,12 @@ func HandleEnvironmentVars(config Config) {
 			if configValue.FieldByName(fieldName).Kind() == reflect.Map {
 				value := map[string]string{}
 				for _, element := range strings.Split(envValue, ",") {
-					keyVal := strings.Split(element, ":")
-					key := strings.TrimSpace(keyVal[0])
-					val := strings.TrimSpace(keyVal[1])
-					value[key] = val
+					key, val, ok := strings.Cut(element, ":")
+					if !ok {
+						log.Println("WARNING: ignore entry without ':' in", envName, element)
+						continue
+					}
+					value[strings.TrimSpace(key)] = strings.TrimSpace(val)
 				}
 				configValue.FieldByName(fieldName).Set(reflect.ValueOf(value))
 			}
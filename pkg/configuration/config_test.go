@@ -0,0 +1,64 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package configuration
+
+import "testing"
+
+func TestFieldNameToEnvName(t *testing.T) {
+	tests := []struct {
+		field    string
+		expected string
+	}{
+		{"PostgresHost", "POSTGRES_HOST"},
+		{"ApiPort", "API_PORT"},
+		{"Debug", "DEBUG"},
+		{"SourceReadOnly", "SOURCE_READ_ONLY"},
+		{"ParquetExportS3UseSsl", "PARQUET_EXPORT_S3_USE_SSL"},
+		{"ApiCacheTtl", "API_CACHE_TTL"},
+	}
+	for _, test := range tests {
+		if actual := fieldNameToEnvName(test.field); actual != test.expected {
+			t.Errorf("fieldNameToEnvName(%q) = %q, expected %q", test.field, actual, test.expected)
+		}
+	}
+}
+
+func TestHandleEnvironmentVarsMap(t *testing.T) {
+	tests := []struct {
+		env      string
+		expected map[string]string
+	}{
+		{"a:http://host:8080", map[string]string{"a": "http://host:8080"}},
+		{"a: http://a:8080 , b:http://b", map[string]string{"a": "http://a:8080", "b": "http://b"}},
+		{"a:http://a,invalid", map[string]string{"a": "http://a"}},
+		{"a:", map[string]string{"a": ""}},
+	}
+	for _, test := range tests {
+		t.Setenv("FEDERATION_CLUSTERS", test.env)
+		config := &ConfigStruct{}
+		HandleEnvironmentVars(config)
+		if len(config.FederationClusters) != len(test.expected) {
+			t.Errorf("%q: got %v, expected %v", test.env, config.FederationClusters, test.expected)
+			continue
+		}
+		for key, val := range test.expected {
+			if config.FederationClusters[key] != val {
+				t.Errorf("%q: got %v, expected %v", test.env, config.FederationClusters, test.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// TablesOfUser lists the tables attributed to the user by the mapping or the owning role, as well as the usage rows
+// of tenant schemas named after the user.
+func (db *DB) TablesOfUser(user string) (tables map[string]bool, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT \"table\" FROM %[1]v.usage_mapping WHERE user_id = $1 UNION SELECT u.\"table\" FROM %[1]v.usage u LEFT JOIN %[1]v.usage_mapping m ON m.\"table\" = u.\"table\" WHERE (m.user_id IS NULL AND coalesce(u.source_user, u.owner) = $1) OR u.tenant = $1;", db.config.PostgresUsageSchema), user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables = map[string]bool{}
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables[table] = true
+	}
+	return tables, rows.Err()
+}
+
+func (db *DB) RecordApiAccess(access model.ApiAccess) error {
+	_, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %v.usage_api_access (subject, method, path, query, status, remote_addr, accessed_at) VALUES ($1, $2, $3, $4, $5, $6, $7);", db.config.PostgresUsageSchema), access.Subject, access.Method, access.Path, access.Query, access.Status, access.RemoteAddr, access.AccessedAt)
+	return err
+}
+
+// ListApiAccess returns the api requests of [from, to), newest first
+func (db *DB) ListApiAccess(from time.Time, to time.Time) (result []model.ApiAccess, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT id, subject, method, path, query, status, remote_addr, accessed_at FROM %v.usage_api_access WHERE accessed_at >= $1 AND accessed_at < $2 ORDER BY accessed_at DESC, id DESC;", db.config.PostgresUsageSchema), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result = []model.ApiAccess{}
+	for rows.Next() {
+		access := model.ApiAccess{}
+		err = rows.Scan(&access.Id, &access.Subject, &access.Method, &access.Path, &access.Query, &access.Status, &access.RemoteAddr, &access.AccessedAt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, access)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,144 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func (db *DB) ListAnnotations(table string) (annotations []model.Annotation, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT id, \"table\", note, tags, created_by, created_at FROM %v.usage_annotations WHERE \"table\" = $1 ORDER BY id;", db.config.PostgresUsageSchema), table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	annotations = []model.Annotation{}
+	for rows.Next() {
+		a := model.Annotation{}
+		var tags pgtype.TextArray
+		var createdBy pgtype.Text
+		var createdAt pgtype.Timestamptz
+		err = rows.Scan(&a.Id, &a.Table, &a.Note, &tags, &createdBy, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		a.Tags = []string{}
+		if tags.Status == pgtype.Present {
+			err = tags.AssignTo(&a.Tags)
+			if err != nil {
+				return nil, err
+			}
+		}
+		a.CreatedBy = createdBy.String
+		a.CreatedAt = createdAt.Time
+		annotations = append(annotations, a)
+	}
+	return annotations, rows.Err()
+}
+
+func (db *DB) AddAnnotation(a model.Annotation) (model.Annotation, error) {
+	if a.Tags == nil {
+		a.Tags = []string{}
+	}
+	a.CreatedAt = time.Now()
+	err := db.conn.QueryRow(fmt.Sprintf("INSERT INTO %v.usage_annotations (\"table\", note, tags, created_by, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id;", db.config.PostgresUsageSchema), a.Table, a.Note, a.Tags, a.CreatedBy, a.CreatedAt).Scan(&a.Id)
+	return a, err
+}
+
+func (db *DB) DeleteAnnotation(table string, id int64) error {
+	tag, err := db.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage_annotations WHERE \"table\" = $1 AND id = $2;", db.config.PostgresUsageSchema), table, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TableTags lists the distinct tags of all annotations of a table
+func (db *DB) TableTags(table string) (tags []string, err error) {
+	annotations, err := db.ListAnnotations(table)
+	if err != nil {
+		return nil, err
+	}
+	tags = []string{}
+	for _, a := range annotations {
+		for _, tag := range a.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags, nil
+}
+
+var ErrLegalHold = errors.New("table is under legal hold")
+
+const (
+	ActionSetLegalHold     = "set_legal_hold"
+	ActionReleaseLegalHold = "release_legal_hold"
+)
+
+// SetLegalHold sets or releases the legal hold of a table, both are recorded in the audit table
+func (db *DB) SetLegalHold(hold model.LegalHold) (model.LegalHold, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return hold, err
+	}
+	defer tx.Rollback()
+	err = db.lockLegalHold(tx, hold.Table, false)
+	if err != nil {
+		return hold, err
+	}
+	action := ActionReleaseLegalHold
+	if hold.LegalHold {
+		action = ActionSetLegalHold
+		now := time.Now()
+		hold.SetAt = &now
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO %v.usage_legal_holds (\"table\", reason, set_by, set_at) VALUES ($1, $2, $3, $4) ON CONFLICT (\"table\") DO UPDATE SET reason = $2, set_by = $3, set_at = $4;", db.config.PostgresUsageSchema), hold.Table, hold.Reason, hold.SetBy, now)
+	} else {
+		hold.SetAt = nil
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %v.usage_legal_holds WHERE \"table\" = $1;", db.config.PostgresUsageSchema), hold.Table)
+	}
+	if err != nil {
+		return hold, err
+	}
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %v.usage_actions (\"table\", action, details, by, created_at) VALUES ($1, $2, $3, $4, now());", db.config.PostgresUsageSchema), hold.Table, action, hold.Reason, hold.SetBy)
+	if err != nil {
+		return hold, err
+	}
+	return hold, tx.Commit()
+}
+
+// lockLegalHold serializes setting a legal hold with drops checking for it, until the end of the transaction. Row locks
+// don't suffice, since a hold placed on a table without one inserts a new row.
+func (db *DB) lockLegalHold(tx *pgx.Tx, table string, shared bool) error {
+	lock := "pg_advisory_xact_lock"
+	if shared {
+		lock = "pg_advisory_xact_lock_shared"
+	}
+	_, err := tx.Exec("SELECT "+lock+"(hashtext($1));", db.config.PostgresUsageSchema+".usage_legal_holds."+table)
+	return err
+}
@@ -0,0 +1,121 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+const backfillChunksQuery = `SELECT h.hypertable_name, c.range_start, c.range_end, d.total_bytes
+FROM timescaledb_information.hypertables h
+CROSS JOIN LATERAL chunks_detailed_size(format('%I.%I', h.hypertable_schema, h.hypertable_name)::regclass) d
+JOIN timescaledb_information.chunks c ON c.chunk_schema = d.chunk_schema AND c.chunk_name = d.chunk_name
+WHERE h.hypertable_schema = $1 AND c.range_start IS NOT NULL
+ORDER BY 1, 2;`
+
+type backfillChunk struct {
+	start, end time.Time
+	bytes      int64
+}
+
+// Backfill reconstructs daily snapshots of every hypertable of the source schema from its chunks, for all days before
+// the first recorded snapshot of the table. A chunk is assumed to fill linearly over its time range. Chunks dropped by
+// retention policies are unknown, so the reconstructed history underestimates tables with retention.
+// Snapshots are taken at midnight UTC and share their run, so that Diff can compare backfilled days.
+func (db *DB) Backfill(dryRun bool) (results []model.BackfillResult, err error) {
+	rows, err := db.conn.Query(backfillChunksQuery, db.config.PostgresSourceSchema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	chunks := map[string][]backfillChunk{}
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		var bytes pgtype.Int8
+		chunk := backfillChunk{}
+		err = rows.Scan(&table, &chunk.start, &chunk.end, &bytes)
+		if err != nil {
+			return nil, err
+		}
+		chunk.bytes = bytes.Int
+		if _, ok := chunks[table]; !ok {
+			tables = append(tables, table)
+		}
+		chunks[table] = append(chunks[table], chunk)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	rows.Close()
+
+	// a failed backfill must not leave partial history, which would shift the first snapshot of a retry
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	results = []model.BackfillResult{}
+	for _, table := range tables {
+		var firstSnapshot pgtype.Timestamptz
+		err = tx.QueryRow(fmt.Sprintf("SELECT min(time) FROM %v.usage_history_all WHERE \"table\" = $1;", db.config.PostgresUsageSchema), table).Scan(&firstSnapshot)
+		if err != nil {
+			return nil, err
+		}
+		until := now
+		if firstSnapshot.Status == pgtype.Present {
+			until = firstSnapshot.Time
+		}
+		result := model.BackfillResult{Table: table}
+		for day := chunks[table][0].start.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1); day.Before(until); day = day.AddDate(0, 0, 1) {
+			bytes := backfillSize(chunks[table], day)
+			if !dryRun {
+				_, err = tx.Exec(fmt.Sprintf("INSERT INTO %v.usage_history (\"table\", bytes, time, run_started_at) VALUES ($1, $2, $3, $3);", db.config.PostgresUsageSchema), table, bytes, day)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if result.Snapshots == 0 {
+				result.From = day
+			}
+			result.To = day
+			result.Snapshots++
+		}
+		results = append(results, result)
+	}
+	return results, tx.Commit()
+}
+
+func backfillSize(chunks []backfillChunk, t time.Time) (bytes int64) {
+	for _, chunk := range chunks {
+		if !chunk.start.Before(t) {
+			continue
+		}
+		if !chunk.end.After(t) {
+			bytes += chunk.bytes
+			continue
+		}
+		bytes += int64(float64(chunk.bytes) * t.Sub(chunk.start).Seconds() / chunk.end.Sub(chunk.start).Seconds())
+	}
+	return bytes
+}
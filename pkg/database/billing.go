@@ -0,0 +1,65 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func scanBillingExport(row interface {
+	Scan(dest ...interface{}) error
+}) (e model.BillingExport, err error) {
+	var lastError pgtype.Text
+	err = row.Scan(&e.Exporter, &e.PeriodStart, &e.IdempotencyKey, &e.Status, &e.Attempts, &lastError, &e.UpdatedAt)
+	e.LastError = lastError.String
+	return e, err
+}
+
+func (db *DB) ListBillingExports() (exports []model.BillingExport, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT exporter, period_start, idempotency_key, status, attempts, last_error, updated_at FROM %v.usage_billing_exports ORDER BY period_start DESC, exporter;", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	exports = []model.BillingExport{}
+	for rows.Next() {
+		e, err := scanBillingExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, e)
+	}
+	return exports, rows.Err()
+}
+
+func (db *DB) GetBillingExport(exporter string, periodStart time.Time) (e model.BillingExport, err error) {
+	e, err = scanBillingExport(db.conn.QueryRow(fmt.Sprintf("SELECT exporter, period_start, idempotency_key, status, attempts, last_error, updated_at FROM %v.usage_billing_exports WHERE exporter = $1 AND period_start = $2;", db.config.PostgresUsageSchema), exporter, periodStart))
+	if err == pgx.ErrNoRows {
+		return e, ErrNotFound
+	}
+	return e, err
+}
+
+func (db *DB) SetBillingExport(e model.BillingExport) error {
+	_, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %v.usage_billing_exports (exporter, period_start, idempotency_key, status, attempts, last_error, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (exporter, period_start) DO UPDATE SET status = EXCLUDED.status, attempts = EXCLUDED.attempts, last_error = EXCLUDED.last_error, updated_at = EXCLUDED.updated_at;", db.config.PostgresUsageSchema), e.Exporter, e.PeriodStart, e.IdempotencyKey, e.Status, e.Attempts, e.LastError, e.UpdatedAt)
+	return err
+}
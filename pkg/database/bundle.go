@@ -0,0 +1,189 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx"
+)
+
+// BundleLine is one row of a usage schema bundle, which is written as JSON lines
+type BundleLine struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+const bundleBatchSize = 1000
+
+func (db *DB) usageTables(q interface {
+	Query(sql string, args ...interface{}) (*pgx.Rows, error)
+}) (tables []string, err error) {
+	rows, err := q.Query("SELECT tablename FROM pg_tables WHERE schemaname = $1 ORDER BY tablename;", db.config.PostgresUsageSchema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// Dump writes all rows of all tables of the usage schema to w, read from a single snapshot
+func (db *DB) Dump(w io.Writer) (counts map[string]int64, err error) {
+	tx, err := db.conn.BeginEx(context.Background(), &pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	tables, err := db.usageTables(tx)
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(w)
+	counts = map[string]int64{}
+	for _, table := range tables {
+		rows, err := tx.Query(fmt.Sprintf("SELECT row_to_json(t)::text FROM %v.%v t;", db.config.PostgresUsageSchema, pgx.Identifier{table}.Sanitize()))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var row string
+			err = rows.Scan(&row)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			err = encoder.Encode(BundleLine{Table: table, Row: json.RawMessage(row)})
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			counts[table]++
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+	}
+	return counts, nil
+}
+
+// Restore inserts all rows of a bundle into the usage schema, which must already be migrated. Rows conflicting with
+// existing rows are skipped, tables without unique constraints like the history should therefore be empty.
+// Sequences of id columns are advanced past the restored ids.
+func (db *DB) Restore(r io.Reader) (counts map[string]int64, err error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	tables, err := db.usageTables(tx)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, table := range tables {
+		known[table] = true
+	}
+
+	counts = map[string]int64{}
+	batches := map[string][]json.RawMessage{}
+	flush := func(table string) error {
+		if len(batches[table]) == 0 {
+			return nil
+		}
+		batch, err := json.Marshal(batches[table])
+		if err != nil {
+			return err
+		}
+		identifier := db.config.PostgresUsageSchema + "." + pgx.Identifier{table}.Sanitize()
+		tag, err := tx.Exec(fmt.Sprintf("INSERT INTO %[1]v SELECT * FROM json_populate_recordset(NULL::%[1]v, $1::json) ON CONFLICT DO NOTHING;", identifier), string(batch))
+		if err != nil {
+			return err
+		}
+		counts[table] += tag.RowsAffected()
+		batches[table] = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := BundleLine{}
+		err = json.Unmarshal(scanner.Bytes(), &line)
+		if err != nil {
+			return nil, err
+		}
+		if !known[line.Table] {
+			return nil, fmt.Errorf("unknown table %v in bundle", line.Table)
+		}
+		batches[line.Table] = append(batches[line.Table], line.Row)
+		if len(batches[line.Table]) >= bundleBatchSize {
+			err = flush(line.Table)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	for _, table := range tables {
+		err = flush(table)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.Query("SELECT table_name::text FROM information_schema.columns WHERE table_schema = $1 AND column_name = 'id' AND column_default LIKE 'nextval%';", db.config.PostgresUsageSchema)
+	if err != nil {
+		return nil, err
+	}
+	sequenced := []string{}
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sequenced = append(sequenced, table)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	for _, table := range sequenced {
+		identifier := db.config.PostgresUsageSchema + "." + pgx.Identifier{table}.Sanitize()
+		_, err = tx.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence($1, 'id'), max(id)) FROM %v HAVING max(id) IS NOT NULL;", identifier), identifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, tx.Commit()
+}
@@ -0,0 +1,50 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func (db *DB) ColumnSizes(table string) (result []model.ColumnSize, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT \"table\", \"column\", avg_bytes, share, estimated_bytes, updated_at FROM %v.usage_column_sizes WHERE \"table\" = $1 ORDER BY avg_bytes DESC;", db.config.PostgresUsageSchema), table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result = []model.ColumnSize{}
+	for rows.Next() {
+		c := model.ColumnSize{}
+		var share pgtype.Float8
+		var estimatedBytes pgtype.Int8
+		err = rows.Scan(&c.Table, &c.Column, &c.AvgBytes, &share, &estimatedBytes, &c.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if share.Status == pgtype.Present {
+			c.Share = &share.Float
+		}
+		if estimatedBytes.Status == pgtype.Present {
+			c.EstimatedBytes = &estimatedBytes.Int
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,189 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func scanPriceList(row interface {
+	Scan(dest ...interface{}) error
+}) (p model.PriceList, err error) {
+	var validFrom, validUntil pgtype.Timestamptz
+	var tiers pgtype.JSONB
+	err = row.Scan(&p.Id, &validFrom, &validUntil, &tiers)
+	if err != nil {
+		return p, err
+	}
+	p.ValidFrom = validFrom.Time
+	p.ValidUntil = timePtr(validUntil)
+	p.Tiers = []model.PriceTier{}
+	if tiers.Status == pgtype.Present {
+		err = json.Unmarshal(tiers.Bytes, &p.Tiers)
+	}
+	return p, err
+}
+
+func (db *DB) ListPriceLists() (lists []model.PriceList, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT id, valid_from, valid_until, tiers FROM %v.usage_price_lists ORDER BY valid_from;", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lists = []model.PriceList{}
+	for rows.Next() {
+		p, err := scanPriceList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, p)
+	}
+	return lists, rows.Err()
+}
+
+// PriceListAt returns the price list valid at the given time, the latest started one if several are valid
+func (db *DB) PriceListAt(t time.Time) (p model.PriceList, err error) {
+	p, err = scanPriceList(db.conn.QueryRow(fmt.Sprintf("SELECT id, valid_from, valid_until, tiers FROM %v.usage_price_lists WHERE valid_from <= $1 AND (valid_until IS NULL OR valid_until > $1) ORDER BY valid_from DESC LIMIT 1;", db.config.PostgresUsageSchema), t))
+	if err == pgx.ErrNoRows {
+		return p, ErrNotFound
+	}
+	return p, err
+}
+
+func (db *DB) AddPriceList(p model.PriceList) (model.PriceList, error) {
+	tiers, err := json.Marshal(p.Tiers)
+	if err != nil {
+		return p, err
+	}
+	err = db.conn.QueryRow(fmt.Sprintf("INSERT INTO %v.usage_price_lists (valid_from, valid_until, tiers, created_at) VALUES ($1, $2, $3, now()) RETURNING id;", db.config.PostgresUsageSchema), p.ValidFrom, p.ValidUntil, string(tiers)).Scan(&p.Id)
+	return p, err
+}
+
+func (db *DB) DeletePriceList(id int64) error {
+	tag, err := db.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage_price_lists WHERE id = $1;", db.config.PostgresUsageSchema), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *DB) ListDiscounts() (discounts []model.Discount, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT user_id, factor, updated_at FROM %v.usage_discounts ORDER BY user_id;", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	discounts = []model.Discount{}
+	for rows.Next() {
+		d := model.Discount{}
+		var updatedAt pgtype.Timestamptz
+		err = rows.Scan(&d.UserId, &d.Factor, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.UpdatedAt = updatedAt.Time
+		discounts = append(discounts, d)
+	}
+	return discounts, rows.Err()
+}
+
+func (db *DB) SetDiscount(d model.Discount) (model.Discount, error) {
+	d.UpdatedAt = time.Now()
+	_, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %v.usage_discounts (user_id, factor, updated_at) VALUES ($1, $2, $3) ON CONFLICT (user_id) DO UPDATE SET factor = $2, updated_at = $3;", db.config.PostgresUsageSchema), d.UserId, d.Factor, d.UpdatedAt)
+	return d, err
+}
+
+func (db *DB) DeleteDiscount(userId string) error {
+	tag, err := db.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage_discounts WHERE user_id = $1;", db.config.PostgresUsageSchema), userId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *DB) discountFactors() (factors map[string]float64, err error) {
+	discounts, err := db.ListDiscounts()
+	if err != nil {
+		return nil, err
+	}
+	factors = map[string]float64{}
+	for _, d := range discounts {
+		factors[d.UserId] = d.Factor
+	}
+	return factors, nil
+}
+
+// EstimateCosts prices the current storage of every user with the price list valid now. Tiers apply per user.
+func (db *DB) EstimateCosts() (estimates []model.CostEstimate, err error) {
+	now := time.Now()
+	prices, err := db.PriceListAt(now)
+	if err != nil {
+		return nil, err
+	}
+	factors, err := db.discountFactors()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT coalesce(m.user_id, u.source_user, u.owner) AS user_id, sum(u.bytes)::bigint, coalesce(sum(u.bytes) FILTER (WHERE u.kind = '"+model.KindContinuousAggregate+"'), 0)::bigint FROM %[1]v.usage u LEFT JOIN %[1]v.usage_mapping m ON m.\"table\" = u.\"table\" WHERE coalesce(m.user_id, u.source_user, u.owner) IS NOT NULL AND u.kind IS DISTINCT FROM '"+model.KindTenant+"' GROUP BY 1 ORDER BY 1;", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	estimates = []model.CostEstimate{}
+	for rows.Next() {
+		e := model.CostEstimate{Date: now, PriceListId: prices.Id, DiscountFactor: 1, Currency: db.config.CostCurrency, DerivedIncluded: db.derivedIncluded()}
+		err = rows.Scan(&e.UserId, &e.Bytes, &e.DerivedBytes)
+		if err != nil {
+			return nil, err
+		}
+		if !e.DerivedIncluded {
+			e.Bytes -= e.DerivedBytes
+		}
+		if factor, ok := factors[e.UserId]; ok {
+			e.DiscountFactor = factor
+		}
+		e.Gb = float64(e.Bytes) / model.BytesPerGb
+		e.CostPerMonth, err = db.roundCost(prices.Cost(e.Gb) * e.DiscountFactor)
+		if err != nil {
+			return nil, err
+		}
+		estimates = append(estimates, e)
+	}
+	return estimates, rows.Err()
+}
+
+// derivedIncluded reports whether continuous aggregates count towards the billed storage of a user, see cagg_totals
+func (db *DB) derivedIncluded() bool {
+	return db.config.CaggTotals != model.CaggTotalsSeparate
+}
+
+// roundCost applies the configured precision and rounding to a cost output
+func (db *DB) roundCost(cost float64) (float64, error) {
+	return model.RoundCost(cost, db.config.CostPrecision, db.config.CostRounding)
+}
@@ -0,0 +1,109 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"errors"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/debug"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+)
+
+// Connect opens a pool labeled with the component using it, see connect
+func Connect(config configuration.Config, component string) (*pgx.ConnPool, error) {
+	return connect(config, component, map[string]string{})
+}
+
+// ConnectSource connects for reading the source tables, as postgres_source_user if configured. With source_read_only,
+// every transaction of these connections defaults to read-only. Since any session can turn that off again, only a
+// postgres_source_user without write privileges keeps tenant data from being modified.
+func ConnectSource(config configuration.Config, component string) (*pgx.ConnPool, error) {
+	runtimeParams := map[string]string{}
+	if config.SourceReadOnly {
+		runtimeParams["default_transaction_read_only"] = "on"
+	}
+	if config.PostgresSourceUser != "" {
+		c := *config
+		c.PostgresUser, c.PostgresPw = config.PostgresSourceUser, config.PostgresSourcePw
+		config = &c
+	}
+	return connect(config, component+"-source", runtimeParams)
+}
+
+// postgres truncates longer application names
+const maxApplicationNameLength = 63
+
+// connect sets application_name to application_name and the component, e.g. timescale-usage-api, so that the sessions
+// of each component can be told apart in pg_stat_activity. search_path is only set if configured, since all queries
+// qualify their tables. session_settings, e.g. work_mem or max_parallel_workers_per_gather, apply to every session
+// to throttle this service on busy clusters, but can not override the settings of the component.
+func connect(config configuration.Config, component string, runtimeParams map[string]string) (*pgx.ConnPool, error) {
+	for name, value := range config.SessionSettings {
+		if _, ok := runtimeParams[name]; !ok {
+			runtimeParams[name] = value
+		}
+	}
+	if config.ApplicationName != "" {
+		name := config.ApplicationName + "-" + component
+		if len(name) > maxApplicationNameLength {
+			name = name[:maxApplicationNameLength]
+		}
+		runtimeParams["application_name"] = name
+	}
+	if config.SearchPath != "" {
+		runtimeParams["search_path"] = config.SearchPath
+	}
+	return pgx.NewConnPool(pgx.ConnPoolConfig{
+		ConnConfig: pgx.ConnConfig{
+			Host:          config.PostgresHost,
+			Port:          config.PostgresPort,
+			Database:      config.PostgresDb,
+			User:          config.PostgresUser,
+			Password:      config.PostgresPw,
+			RuntimeParams: runtimeParams,
+			Logger:        debug.PgxLogger{RedactStatements: config.LogTableNames != "" && config.LogTableNames != "plain"},
+			LogLevel:      pgx.LogLevelInfo,
+		},
+		MaxConnections: 10,
+		AcquireTimeout: 0})
+}
+
+type DB struct {
+	conn   pool
+	config configuration.Config
+}
+
+func New(config configuration.Config, component string) (*DB, error) {
+	_, err := model.RoundCost(0, config.CostPrecision, config.CostRounding)
+	if err != nil {
+		return nil, err
+	}
+	if config.CaggTotals != "" && config.CaggTotals != model.CaggTotalsAdd && config.CaggTotals != model.CaggTotalsSeparate {
+		return nil, errors.New("unknown cagg_totals " + config.CaggTotals)
+	}
+	conn, err := Connect(config, component)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{conn: conn, config: config}, nil
+}
+
+func (db *DB) Close() {
+	db.conn.Close()
+}
@@ -0,0 +1,210 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+var ErrInvalidDeletion = errors.New("kind must be user or table and subject must not be empty")
+
+var ErrTableExists = errors.New("table still exists in the source schema, drop it first")
+
+// tables keyed by the source table, all rows of the purged tables are deleted
+var deletionTableKeyed = []string{
+	"usage",
+	"usage_history",
+	"usage_history_daily",
+	"usage_forecast",
+	"usage_mapping",
+	"usage_tablespaces",
+	"usage_recommendations",
+	"usage_actions",
+	"usage_write_blocks",
+	"usage_writable",
+	"usage_size_comparison",
+	"usage_annotations",
+	"usage_lifecycle",
+	"usage_by_month",
+	"usage_by_partition",
+	"usage_column_sizes",
+	"usage_query_plans",
+	"usage_devices",
+	"usage_dropped",
+}
+
+// existingTablesQuery lists the purged tables still in the source schema, including the tables blocked for the user
+const existingTablesQuery = `SELECT coalesce(array_agg(t), '{}') FROM (SELECT unnest($1::text[]) UNION SELECT "table" FROM %[1]v.usage_write_blocks WHERE kind = 'user' AND subject = $2) s(t)
+WHERE to_regclass(format('%%I.%%I', $3::text, t)) IS NOT NULL;`
+
+// tables of the user are the tables attributed to the user as by TablesOfUser
+const deletionUserTablesQuery = `SELECT "table" FROM %[1]v.usage_mapping WHERE user_id = $1
+UNION SELECT u."table" FROM %[1]v.usage u LEFT JOIN %[1]v.usage_mapping m ON m."table" = u."table" WHERE (m.user_id IS NULL AND coalesce(u.source_user, u.owner) = $1) OR u.tenant = $1
+UNION SELECT "table" FROM %[1]v.usage_dropped WHERE coalesce(source_user, owner) = $1 OR tenant = $1 ORDER BY 1;`
+
+// Purge deletes all usage, history and audit records of a user or table in one transaction, to serve the deletion
+// request of a data subject. Tables under legal hold are not purged. Tables still existing in the source schema are
+// refused, the worker would measure them again on its next run and their write blocks could not be lifted anymore.
+// Invoices already pushed to billing exporters are accounting records of their own and kept there, usage of other
+// federation clusters is kept by these clusters.
+func (db *DB) Purge(request model.DeletionRequest) (report model.DeletionReport, err error) {
+	if (request.Kind != model.DeletionKindUser && request.Kind != model.DeletionKindTable) || request.Subject == "" {
+		return report, ErrInvalidDeletion
+	}
+	report = model.DeletionReport{DeletionRequest: request, Tables: []string{}, Deleted: map[string]int64{}, Retained: []string{}}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	if request.Kind == model.DeletionKindUser {
+		report.Tables, err = deletionUserTables(tx, db.config.PostgresUsageSchema, request.Subject)
+		if err != nil {
+			return report, err
+		}
+	} else {
+		report.Tables = []string{request.Subject}
+	}
+
+	var held bool
+	err = tx.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %v.usage_legal_holds WHERE \"table\" = ANY($1));", db.config.PostgresUsageSchema), report.Tables).Scan(&held)
+	if err != nil {
+		return report, err
+	}
+	if held {
+		return report, ErrLegalHold
+	}
+
+	var existing pgtype.TextArray
+	err = tx.QueryRow(fmt.Sprintf(existingTablesQuery, db.config.PostgresUsageSchema), report.Tables, userSubject(request), db.config.PostgresSourceSchema).Scan(&existing)
+	if err != nil {
+		return report, err
+	}
+	if len(existing.Elements) > 0 {
+		tables := []string{}
+		err = existing.AssignTo(&tables)
+		if err != nil {
+			return report, err
+		}
+		return report, fmt.Errorf("%w: %v", ErrTableExists, strings.Join(tables, ", "))
+	}
+
+	exec := func(table string, query string, args ...interface{}) error {
+		tag, err := tx.Exec(fmt.Sprintf(query, db.config.PostgresUsageSchema), args...)
+		if err != nil {
+			return err
+		}
+		report.Deleted[table] += tag.RowsAffected()
+		return nil
+	}
+
+	// violations and their audit trail of the user and the tables
+	subjects := "(kind = 'user' AND subject = $1) OR (kind = 'table' AND subject = ANY($2))"
+	err = exec("usage_violation_audit", "DELETE FROM %[1]v.usage_violation_audit WHERE violation_id IN (SELECT id FROM %[1]v.usage_violations WHERE "+subjects+");", userSubject(request), report.Tables)
+	if err != nil {
+		return report, err
+	}
+	for _, table := range []string{"usage_violations", "usage_quotas", "usage_query_stats"} {
+		err = exec(table, "DELETE FROM %v."+table+" WHERE "+subjects+";", userSubject(request), report.Tables)
+		if err != nil {
+			return report, err
+		}
+	}
+	err = exec("usage_write_blocks", "DELETE FROM %v.usage_write_blocks WHERE kind = 'user' AND subject = $1;", userSubject(request))
+	if err != nil {
+		return report, err
+	}
+	// reports created by the user or naming the user or the tables
+	err = exec("usage_jobs", "DELETE FROM %v.usage_jobs WHERE ($1 <> '' AND created_by = $1) OR EXISTS (SELECT 1 FROM jsonb_path_query(result, 'strict $.**') v WHERE ($1 <> '' AND v #>> '{}' = $1) OR v #>> '{}' = ANY($2));", userSubject(request), report.Tables)
+	if err != nil {
+		return report, err
+	}
+	if request.Kind == model.DeletionKindUser {
+		err = exec("usage_discounts", "DELETE FROM %v.usage_discounts WHERE user_id = $1;", request.Subject)
+		if err != nil {
+			return report, err
+		}
+		err = exec("usage_api_access", "DELETE FROM %v.usage_api_access WHERE subject = $1;", request.Subject)
+		if err != nil {
+			return report, err
+		}
+	}
+	// undelivered events still naming the user or the tables
+	err = exec("usage_outbox", "DELETE FROM %v.usage_outbox WHERE payload->>'user_id' = $1 OR payload->>'table' = ANY($2) OR (payload->>'quota_kind' = 'user' AND payload->>'subject' = $1) OR (payload->>'quota_kind' = 'table' AND payload->>'subject' = ANY($2));", userSubject(request), report.Tables)
+	if err != nil {
+		return report, err
+	}
+	// federated usage fetched from other clusters, owned by the user or naming the tables
+	err = exec("usage_federation_tables", "DELETE FROM %v.usage_federation_tables WHERE ($1 <> '' AND (owner = $1 OR tenant = $1)) OR \"table\" = ANY($2);", userSubject(request), report.Tables)
+	if err != nil {
+		return report, err
+	}
+	for _, table := range deletionTableKeyed {
+		err = exec(table, "DELETE FROM %v."+table+" WHERE \"table\" = ANY($1);", report.Tables)
+		if err != nil {
+			return report, err
+		}
+	}
+	if len(db.config.BillingExporters) > 0 {
+		report.Retained = append(report.Retained, "invoices pushed to the billing exporters "+strings.Join(db.config.BillingExporters, ", "))
+	}
+	if len(db.config.FederationClusters) > 0 {
+		clusters := []string{}
+		for cluster := range db.config.FederationClusters {
+			clusters = append(clusters, cluster)
+		}
+		sort.Strings(clusters)
+		report.Retained = append(report.Retained, "usage stored by the federation clusters "+strings.Join(clusters, ", ")+", purge it there, the next poll fetches it again")
+	}
+	report.DeletedAt = time.Now()
+	return report, tx.Commit()
+}
+
+// userSubject is the user of the request, a table request doesn't match any user
+func userSubject(request model.DeletionRequest) string {
+	if request.Kind == model.DeletionKindUser {
+		return request.Subject
+	}
+	return ""
+}
+
+func deletionUserTables(tx *pgx.Tx, schema string, user string) (tables []string, err error) {
+	rows, err := tx.Query(fmt.Sprintf(deletionUserTablesQuery, schema), user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables = []string{}
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
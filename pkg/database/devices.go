@@ -0,0 +1,41 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func (db *DB) DeviceUsage(table string) (result []model.DeviceUsage, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT \"table\", device, rows, avg_row_bytes, estimated_bytes, updated_at FROM %v.usage_devices WHERE \"table\" = $1 ORDER BY estimated_bytes DESC, device;", db.config.PostgresUsageSchema), table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result = []model.DeviceUsage{}
+	for rows.Next() {
+		d := model.DeviceUsage{}
+		err = rows.Scan(&d.Table, &d.Device, &d.Rows, &d.AvgRowBytes, &d.EstimatedBytes, &d.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,110 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// Diff compares the latest snapshots of every table at or before from and to.
+// Tables without a snapshot at or before from are reported as created. Tables no longer in usage are reported as
+// deleted if they were dropped at or before to, as recorded in usage_dropped; tables dropped at an unknown time are
+// assumed to be dropped before both. Tables deleted before from are not reported at all. Tables merely missing from
+// a run, e.g. skipped on a lock timeout or measured by another shard, keep their last snapshot.
+// Tables are attributed to users by the mapping, falling back to the owning role. Tenants are totals of tables
+// attributed on their own already, so they are not attributed. Continuous aggregates are left out of the user totals
+// if cagg_totals is separate.
+func (db *DB) Diff(from time.Time, to time.Time) (diff model.Diff, err error) {
+	query := fmt.Sprintf(`WITH f AS (SELECT DISTINCT ON ("table") "table", bytes FROM %[1]v.usage_history_all WHERE time <= $1 ORDER BY "table", time DESC),
+t AS (SELECT DISTINCT ON ("table") "table", bytes FROM %[1]v.usage_history_all WHERE time <= $2 ORDER BY "table", time DESC),
+gone AS (SELECT t."table", coalesce(o.dropped_at, '-infinity') AS dropped_at FROM t LEFT JOIN %[1]v.usage u ON u."table" = t."table"
+	LEFT JOIN %[1]v.usage_dropped o ON o."table" = t."table" WHERE u."table" IS NULL)
+SELECT t."table", p.bytes, t.bytes, p."table" IS NULL, coalesce(g.dropped_at <= $2, false),
+CASE WHEN coalesce(u.kind, o.kind) = '`+model.KindTenant+`' THEN NULL ELSE coalesce(m.user_id, u.source_user, u.owner, o.source_user, o.owner) END,
+(SELECT array_agg(DISTINCT tag) FROM %[1]v.usage_annotations a, unnest(a.tags) tag WHERE a."table" = t."table"),
+coalesce(u.kind, o.kind, '')
+FROM t LEFT JOIN gone g ON g."table" = t."table"
+LEFT JOIN f p ON p."table" = t."table" AND NOT coalesce(g.dropped_at <= $1, false)
+LEFT JOIN %[1]v.usage_mapping m ON m."table" = t."table" LEFT JOIN %[1]v.usage u ON u."table" = t."table"
+LEFT JOIN %[1]v.usage_dropped o ON o."table" = t."table"
+ORDER BY t."table";`, db.config.PostgresUsageSchema)
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return diff, err
+	}
+	defer rows.Close()
+
+	diff = model.Diff{From: from, To: to, Tables: []model.TableDiff{}, Users: []model.UserDiff{}}
+	users := map[string]*model.UserDiff{}
+	for rows.Next() {
+		var bytesFrom pgtype.Int8
+		var bytesTo int64
+		var userId pgtype.Text
+		var tags pgtype.TextArray
+		var kind string
+		entry := model.TableDiff{}
+		err = rows.Scan(&entry.Table, &bytesFrom, &bytesTo, &entry.Created, &entry.Deleted, &userId, &tags, &kind)
+		if err != nil {
+			return diff, err
+		}
+		if tags.Status == pgtype.Present {
+			err = tags.AssignTo(&entry.Tags)
+			if err != nil {
+				return diff, err
+			}
+		}
+		if bytesFrom.Status == pgtype.Present {
+			entry.BytesFrom = bytesFrom.Int
+		}
+		if !entry.Deleted {
+			entry.BytesTo = bytesTo
+		}
+		entry.Delta = entry.BytesTo - entry.BytesFrom
+		if entry.Created && entry.Deleted {
+			continue // existed only in between
+		}
+		entry.UserId = userId.String
+		diff.Tables = append(diff.Tables, entry)
+
+		if entry.UserId == "" || (kind == model.KindContinuousAggregate && !db.derivedIncluded()) {
+			continue
+		}
+		user, ok := users[entry.UserId]
+		if !ok {
+			user = &model.UserDiff{UserId: entry.UserId}
+			users[entry.UserId] = user
+		}
+		user.BytesFrom += entry.BytesFrom
+		user.BytesTo += entry.BytesTo
+		user.Delta += entry.Delta
+	}
+	if rows.Err() != nil {
+		return diff, rows.Err()
+	}
+	for _, user := range users {
+		diff.Users = append(diff.Users, *user)
+	}
+	sort.Slice(diff.Users, func(i, j int) bool {
+		return diff.Users[i].UserId < diff.Users[j].UserId
+	})
+	return diff, nil
+}
@@ -0,0 +1,117 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// SetClusterSummary stores a successfully fetched summary of a cluster
+func (db *DB) SetClusterSummary(cluster string, summary model.Summary, fetchedAt time.Time) error {
+	_, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %v.usage_federation (cluster, database_bytes, tracked_bytes, untracked_bytes, updated_at, fetched_at, error) VALUES ($1, $2, $3, $4, $5, $6, NULL) ON CONFLICT (cluster) DO UPDATE SET database_bytes = $2, tracked_bytes = $3, untracked_bytes = $4, updated_at = $5, fetched_at = $6, error = NULL;", db.config.PostgresUsageSchema), cluster, summary.DatabaseBytes, summary.TrackedBytes, summary.UntrackedBytes, summary.UpdatedAt, fetchedAt)
+	return err
+}
+
+// SetClusterError records a failed fetch, keeping the last summary of the cluster
+func (db *DB) SetClusterError(cluster string, fetchErr error, fetchedAt time.Time) error {
+	_, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %v.usage_federation (cluster, database_bytes, tracked_bytes, untracked_bytes, fetched_at, error) VALUES ($1, 0, 0, 0, $2, $3) ON CONFLICT (cluster) DO UPDATE SET fetched_at = $2, error = $3;", db.config.PostgresUsageSchema), cluster, fetchedAt, fetchErr.Error())
+	return err
+}
+
+// SetClusterTables replaces the tables of a cluster with the ones fetched successfully
+func (db *DB) SetClusterTables(cluster string, usages []model.Usage) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %v.usage_federation_tables WHERE cluster = $1;", db.config.PostgresUsageSchema), cluster)
+	if err != nil {
+		return err
+	}
+	for _, usage := range usages {
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO %v.usage_federation_tables (cluster, \"table\", bytes, owner, kind, tenant, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7);", db.config.PostgresUsageSchema), cluster, usage.Table, usage.Bytes, usage.Owner, usage.Kind, usage.Tenant, usage.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteOtherClusters removes clusters no longer configured
+func (db *DB) DeleteOtherClusters(clusters []string) error {
+	_, err := db.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage_federation WHERE NOT (cluster = ANY($1));", db.config.PostgresUsageSchema), clusters)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage_federation_tables WHERE NOT (cluster = ANY($1));", db.config.PostgresUsageSchema), clusters)
+	return err
+}
+
+// GetFederationTables lists the tables of all clusters, largest first
+func (db *DB) GetFederationTables() (usages []model.ClusterUsage, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT cluster, \"table\", bytes, owner, kind, tenant, updated_at FROM %v.usage_federation_tables ORDER BY bytes DESC, cluster, \"table\";", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	usages = []model.ClusterUsage{}
+	for rows.Next() {
+		u := model.ClusterUsage{}
+		err = rows.Scan(&u.Cluster, &u.Table, &u.Bytes, &u.Owner, &u.Kind, &u.Tenant, &u.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, u)
+	}
+	return usages, rows.Err()
+}
+
+// GetFederation sums up the last summaries of all clusters, flagging clusters whose last fetch failed
+func (db *DB) GetFederation() (federation model.Federation, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT cluster, database_bytes, tracked_bytes, untracked_bytes, updated_at, fetched_at, error FROM %v.usage_federation ORDER BY cluster;", db.config.PostgresUsageSchema))
+	if err != nil {
+		return federation, err
+	}
+	defer rows.Close()
+	federation.Clusters = []model.ClusterSummary{}
+	for rows.Next() {
+		c := model.ClusterSummary{}
+		var updatedAt pgtype.Timestamptz
+		var fetchErr pgtype.Text
+		err = rows.Scan(&c.Cluster, &c.DatabaseBytes, &c.TrackedBytes, &c.UntrackedBytes, &updatedAt, &c.FetchedAt, &fetchErr)
+		if err != nil {
+			return federation, err
+		}
+		c.UpdatedAt = updatedAt.Time
+		c.Error = fetchErr.String
+		c.Stale = c.Error != "" || updatedAt.Status != pgtype.Present
+		federation.Stale = federation.Stale || c.Stale
+		federation.Total.DatabaseBytes += c.DatabaseBytes
+		federation.Total.TrackedBytes += c.TrackedBytes
+		federation.Total.UntrackedBytes += c.UntrackedBytes
+		if updatedAt.Status == pgtype.Present && (federation.Total.UpdatedAt.IsZero() || c.UpdatedAt.Before(federation.Total.UpdatedAt)) {
+			federation.Total.UpdatedAt = c.UpdatedAt
+		}
+		federation.Clusters = append(federation.Clusters, c)
+	}
+	return federation, rows.Err()
+}
@@ -0,0 +1,106 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// StreamHistoryOfDay passes all snapshots taken on the given UTC day to f in batches of at most batchSize entries,
+// so days with many snapshots don't have to be held in memory at once. The batch is reused after f returns.
+func (db *DB) StreamHistoryOfDay(day time.Time, batchSize int, f func(batch []model.HistoryEntry) error) error {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT \"table\", bytes, time, run_started_at FROM %v.usage_history WHERE time >= $1 AND time < $2 ORDER BY time;", db.config.PostgresUsageSchema), day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	batch := make([]model.HistoryEntry, 0, batchSize)
+	for rows.Next() {
+		entry := model.HistoryEntry{}
+		var t, runStartedAt pgtype.Timestamptz
+		err = rows.Scan(&entry.Table, &entry.Bytes, &t, &runStartedAt)
+		if err != nil {
+			return err
+		}
+		entry.Time = t.Time
+		entry.RunStartedAt = runStartedAt.Time
+		batch = append(batch, entry)
+		if len(batch) == batchSize {
+			err = f(batch)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return f(batch)
+	}
+	return nil
+}
+
+// HistoryOfTables lists all snapshots of the given tables since from, including downsampled days.
+func (db *DB) HistoryOfTables(tables []string, from time.Time) (entries []model.HistoryEntry, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT \"table\", bytes, time, run_started_at FROM %v.usage_history_all WHERE \"table\" = ANY($1) AND time >= $2 ORDER BY \"table\", time;", db.config.PostgresUsageSchema), tables, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries = []model.HistoryEntry{}
+	for rows.Next() {
+		entry := model.HistoryEntry{}
+		var t, runStartedAt pgtype.Timestamptz
+		err = rows.Scan(&entry.Table, &entry.Bytes, &t, &runStartedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.Time = t.Time
+		entry.RunStartedAt = runStartedAt.Time
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// UnexportedDays lists all UTC days before the given time with snapshots that have not been exported yet.
+func (db *DB) UnexportedDays(before time.Time) (days []time.Time, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT DISTINCT date_trunc('day', time, 'UTC') AS day FROM %[1]v.usage_history WHERE time < $1 AND date_trunc('day', time, 'UTC') NOT IN (SELECT day FROM %[1]v.usage_exports) ORDER BY day;", db.config.PostgresUsageSchema), before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day pgtype.Timestamptz
+		err = rows.Scan(&day)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day.Time.UTC())
+	}
+	return days, rows.Err()
+}
+
+func (db *DB) MarkExported(day time.Time) error {
+	_, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %v.usage_exports (day, exported_at) VALUES ($1, now()) ON CONFLICT (day) DO UPDATE SET exported_at = now();", db.config.PostgresUsageSchema), day)
+	return err
+}
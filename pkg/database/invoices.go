@@ -0,0 +1,116 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// tables dropped since the period are attributed to their owner at the time they were dropped. Tenants are totals of
+// tables billed on their own already.
+const invoiceLineItemsQuery = `SELECT coalesce(m.user_id, u.source_user, u.owner, o.source_user, o.owner) AS user_id, d.day, sum(d.bytes)::bigint,
+coalesce(sum(d.bytes) FILTER (WHERE coalesce(u.kind, o.kind) = '` + model.KindContinuousAggregate + `'), 0)::bigint
+FROM (SELECT DISTINCT ON ("table", (time AT TIME ZONE 'UTC')::date) "table", (time AT TIME ZONE 'UTC')::date AS day, bytes FROM %[1]v.usage_history_all WHERE time >= $1 AND time < $2 ORDER BY "table", (time AT TIME ZONE 'UTC')::date, time DESC) d
+LEFT JOIN %[1]v.usage u ON u."table" = d."table"
+LEFT JOIN %[1]v.usage_dropped o ON o."table" = d."table"
+LEFT JOIN %[1]v.usage_mapping m ON m."table" = d."table"
+WHERE coalesce(m.user_id, u.source_user, u.owner, o.source_user, o.owner) IS NOT NULL AND coalesce(u.kind, o.kind, '') <> '` + model.KindTenant + `'
+GROUP BY 1, 2 ORDER BY 1, 2;`
+
+// InvoiceLineItems bills the storage of every user in [from, to). The storage of a day is the sum of the last measured
+// size of each table of the user on that day, priced with the price list valid on that day as a share of its month.
+func (db *DB) InvoiceLineItems(from time.Time, to time.Time) (items []model.InvoiceLineItem, err error) {
+	lists, err := db.ListPriceLists()
+	if err != nil {
+		return nil, err
+	}
+	factors, err := db.discountFactors()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.conn.Query(fmt.Sprintf(invoiceLineItemsQuery, db.config.PostgresUsageSchema), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	days := []invoiceDay{}
+	for rows.Next() {
+		d := invoiceDay{}
+		err = rows.Scan(&d.userId, &d.day, &d.bytes, &d.derivedBytes)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return db.lineItems(days, lists, factors, from, to)
+}
+
+// invoiceDay is the storage of a user on one day, ordered by user
+type invoiceDay struct {
+	userId       string
+	day          time.Time
+	bytes        int64
+	derivedBytes int64
+}
+
+// lineItems prices every day with the price list valid on it, as the monthly price of the day's storage divided by
+// the days of its month. Totals are discounted and rounded once per user.
+func (db *DB) lineItems(days []invoiceDay, lists []model.PriceList, factors map[string]float64, from time.Time, to time.Time) (items []model.InvoiceLineItem, err error) {
+	items = []model.InvoiceLineItem{}
+	costs := map[string]float64{}
+	for _, d := range days {
+		bytes := d.bytes
+		if !db.derivedIncluded() {
+			bytes -= d.derivedBytes
+		}
+		if len(items) == 0 || items[len(items)-1].UserId != d.userId {
+			item := model.InvoiceLineItem{UserId: d.userId, PeriodStart: from, PeriodEnd: to, DiscountFactor: 1, Currency: db.config.CostCurrency, DerivedIncluded: db.derivedIncluded()}
+			if factor, ok := factors[d.userId]; ok {
+				item.DiscountFactor = factor
+			}
+			items = append(items, item)
+		}
+		prices, ok := model.PriceListAt(lists, d.day)
+		if !ok {
+			return nil, fmt.Errorf("%w: no price list valid at %v", ErrNotFound, d.day.Format(time.DateOnly))
+		}
+		gb := float64(bytes) / model.BytesPerGb
+		daysOfMonth := float64(d.day.AddDate(0, 1, -d.day.Day()).Day())
+		items[len(items)-1].GbDays += gb
+		items[len(items)-1].DerivedGbDays += float64(d.derivedBytes) / model.BytesPerGb
+		costs[d.userId] += prices.Cost(gb) / daysOfMonth
+	}
+	for i, item := range items {
+		items[i].Total, err = db.roundCost(costs[item.UserId] * item.DiscountFactor)
+		if err != nil {
+			return nil, err
+		}
+		if item.GbDays > 0 {
+			items[i].UnitPrice, err = db.roundCost(costs[item.UserId] * item.DiscountFactor / item.GbDays)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return items, nil
+}
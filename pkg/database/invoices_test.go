@@ -0,0 +1,140 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func TestLineItems(t *testing.T) {
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	from, to := day(4, 1), day(5, 1)
+	aprilUntil := day(4, 16)
+	// 30 GB per month cost 30, so one GB stored for one day of April costs 1 / 30 * 30 = 1
+	flat := model.PriceList{Id: 1, ValidFrom: day(1, 1), Tiers: []model.PriceTier{{FromGb: 0, PricePerGbMonth: 30}}}
+	tiered := model.PriceList{Id: 2, ValidFrom: day(1, 1), Tiers: []model.PriceTier{{FromGb: 0, PricePerGbMonth: 30}, {FromGb: 10, PricePerGbMonth: 15}}}
+	tests := []struct {
+		name       string
+		config     configuration.ConfigStruct
+		days       []invoiceDay
+		lists      []model.PriceList
+		factors    map[string]float64
+		gbDays     []float64
+		totals     []float64
+		unitPrices []float64
+	}{
+		{
+			name:       "flat price",
+			days:       []invoiceDay{{userId: "a", day: day(4, 1), bytes: 2e9}, {userId: "a", day: day(4, 2), bytes: 4e9}},
+			lists:      []model.PriceList{flat},
+			gbDays:     []float64{6},
+			totals:     []float64{6},
+			unitPrices: []float64{1},
+		},
+		{
+			name: "users and discounts",
+			days: []invoiceDay{
+				{userId: "a", day: day(4, 1), bytes: 1e9},
+				{userId: "b", day: day(4, 1), bytes: 1e9},
+				{userId: "b", day: day(4, 2), bytes: 1e9},
+			},
+			lists:      []model.PriceList{flat},
+			factors:    map[string]float64{"b": 0.5},
+			gbDays:     []float64{1, 2},
+			totals:     []float64{1, 1},
+			unitPrices: []float64{1, 0.5},
+		},
+		{
+			name:       "tiers apply per day",
+			days:       []invoiceDay{{userId: "a", day: day(4, 1), bytes: 20e9}},
+			lists:      []model.PriceList{tiered},
+			gbDays:     []float64{20},
+			totals:     []float64{(10*30 + 10*15) / 30.0},
+			unitPrices: []float64{(10*30 + 10*15) / 30.0 / 20},
+		},
+		{
+			name: "price list changes mid period",
+			days: []invoiceDay{{userId: "a", day: day(4, 15), bytes: 1e9}, {userId: "a", day: day(4, 16), bytes: 1e9}},
+			lists: []model.PriceList{
+				{Id: 1, ValidFrom: day(1, 1), ValidUntil: &aprilUntil, Tiers: []model.PriceTier{{FromGb: 0, PricePerGbMonth: 30}}},
+				{Id: 2, ValidFrom: aprilUntil, Tiers: []model.PriceTier{{FromGb: 0, PricePerGbMonth: 60}}},
+			},
+			gbDays:     []float64{2},
+			totals:     []float64{3},
+			unitPrices: []float64{1.5},
+		},
+		{
+			name:       "continuous aggregates billed separately",
+			config:     configuration.ConfigStruct{CaggTotals: model.CaggTotalsSeparate},
+			days:       []invoiceDay{{userId: "a", day: day(4, 1), bytes: 3e9, derivedBytes: 1e9}},
+			lists:      []model.PriceList{flat},
+			gbDays:     []float64{2},
+			totals:     []float64{2},
+			unitPrices: []float64{1},
+		},
+		{
+			name:       "rounded total",
+			config:     configuration.ConfigStruct{CostPrecision: 2, CostRounding: model.CostRoundingHalfUp},
+			days:       []invoiceDay{{userId: "a", day: day(4, 1), bytes: 1e9}},
+			lists:      []model.PriceList{{Id: 1, ValidFrom: day(1, 1), Tiers: []model.PriceTier{{FromGb: 0, PricePerGbMonth: 1}}}},
+			gbDays:     []float64{1},
+			totals:     []float64{0.03},
+			unitPrices: []float64{0.03},
+		},
+	}
+	for _, test := range tests {
+		config := test.config
+		if config.CostRounding == "" {
+			config.CostPrecision, config.CostRounding = 9, model.CostRoundingHalfEven
+		}
+		db := &DB{config: &config}
+		items, err := db.lineItems(test.days, test.lists, test.factors, from, to)
+		if err != nil {
+			t.Error(test.name, err)
+			continue
+		}
+		if len(items) != len(test.totals) {
+			t.Errorf("%v: %v items, expected %v", test.name, len(items), len(test.totals))
+			continue
+		}
+		for i, item := range items {
+			if !item.PeriodStart.Equal(from) || !item.PeriodEnd.Equal(to) {
+				t.Errorf("%v: unexpected period %v - %v", test.name, item.PeriodStart, item.PeriodEnd)
+			}
+			if math.Abs(item.GbDays-test.gbDays[i]) > 1e-9 || math.Abs(item.Total-test.totals[i]) > 1e-6 || math.Abs(item.UnitPrice-test.unitPrices[i]) > 1e-6 {
+				t.Errorf("%v: item %v has %v GB-days, total %v, unit price %v, expected %v, %v, %v", test.name, item.UserId, item.GbDays, item.Total, item.UnitPrice, test.gbDays[i], test.totals[i], test.unitPrices[i])
+			}
+		}
+	}
+}
+
+func TestLineItemsWithoutPriceList(t *testing.T) {
+	db := &DB{config: &configuration.ConfigStruct{CostRounding: model.CostRoundingHalfEven}}
+	day := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	_, err := db.lineItems([]invoiceDay{{userId: "a", day: day, bytes: 1e9}}, []model.PriceList{{ValidFrom: day.AddDate(0, 0, 1)}}, nil, day, day.AddDate(0, 1, 0))
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound, got", err)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// jobs are kept for a week after creation
+const jobRetention = "7 days"
+
+func (db *DB) CreateJob(kind string, params model.JobParams, createdBy string) (job model.Job, err error) {
+	_, err = db.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage_jobs WHERE created_at < now() - $1::interval;", db.config.PostgresUsageSchema), jobRetention)
+	if err != nil {
+		return job, err
+	}
+	paramsJson, err := json.Marshal(params)
+	if err != nil {
+		return job, err
+	}
+	now := time.Now()
+	job = model.Job{Kind: kind, State: model.JobStatePending, Params: params, CreatedBy: createdBy, CreatedAt: now, UpdatedAt: now}
+	err = db.conn.QueryRow(fmt.Sprintf("INSERT INTO %v.usage_jobs (kind, state, params, created_by, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $5) RETURNING id;", db.config.PostgresUsageSchema), kind, job.State, string(paramsJson), createdBy, now).Scan(&job.Id)
+	return job, err
+}
+
+func (db *DB) GetJob(id int64) (job model.Job, err error) {
+	var params, result pgtype.JSONB
+	var errText, createdBy pgtype.Text
+	var createdAt, updatedAt pgtype.Timestamptz
+	err = db.conn.QueryRow(fmt.Sprintf("SELECT id, kind, state, params, result, error, created_by, created_at, updated_at FROM %v.usage_jobs WHERE id = $1;", db.config.PostgresUsageSchema), id).Scan(&job.Id, &job.Kind, &job.State, &params, &result, &errText, &createdBy, &createdAt, &updatedAt)
+	if err == pgx.ErrNoRows {
+		return job, ErrNotFound
+	}
+	if err != nil {
+		return job, err
+	}
+	if params.Status == pgtype.Present {
+		err = json.Unmarshal(params.Bytes, &job.Params)
+		if err != nil {
+			return job, err
+		}
+	}
+	if result.Status == pgtype.Present {
+		job.Result = result.Bytes
+	}
+	job.Error = errText.String
+	job.CreatedBy = createdBy.String
+	job.CreatedAt = createdAt.Time
+	job.UpdatedAt = updatedAt.Time
+	return job, nil
+}
+
+func (db *DB) StartJob(id int64) error {
+	_, err := db.conn.Exec(fmt.Sprintf("UPDATE %v.usage_jobs SET state = $2, updated_at = now() WHERE id = $1;", db.config.PostgresUsageSchema), id, model.JobStateRunning)
+	return err
+}
+
+// FinishJob stores the result of a job, or the error it failed with
+func (db *DB) FinishJob(id int64, result interface{}, jobErr error) error {
+	if jobErr != nil {
+		_, err := db.conn.Exec(fmt.Sprintf("UPDATE %v.usage_jobs SET state = $2, error = $3, updated_at = now() WHERE id = $1;", db.config.PostgresUsageSchema), id, model.JobStateFailed, jobErr.Error())
+		return err
+	}
+	resultJson, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(fmt.Sprintf("UPDATE %v.usage_jobs SET state = $2, result = $3, updated_at = now() WHERE id = $1;", db.config.PostgresUsageSchema), id, model.JobStateDone, string(resultJson))
+	return err
+}
+
+// FailInterruptedJobs marks jobs as failed which were pending or running when the api was stopped
+func (db *DB) FailInterruptedJobs() error {
+	_, err := db.conn.Exec(fmt.Sprintf("UPDATE %v.usage_jobs SET state = $1, error = 'interrupted', updated_at = now() WHERE state IN ($2, $3);", db.config.PostgresUsageSchema), model.JobStateFailed, model.JobStatePending, model.JobStateRunning)
+	return err
+}
+
+// UserSummary reports the storage of every user per month. Tables are attributed like in Diff, continuous aggregates
+// count unless cagg_totals is separate.
+func (db *DB) UserSummary(from time.Time, to time.Time) (summaries []model.UserSummary, err error) {
+	query := fmt.Sprintf(`WITH runs AS (SELECT coalesce(m.user_id, u.source_user, u.owner, o.source_user, o.owner) AS user_id, coalesce(h.run_started_at, h.time) AS run, date_trunc('month', h.time) AS month, sum(h.bytes) AS bytes
+FROM %[1]v.usage_history_all h LEFT JOIN %[1]v.usage_mapping m ON m."table" = h."table" LEFT JOIN %[1]v.usage u ON u."table" = h."table"
+LEFT JOIN %[1]v.usage_dropped o ON o."table" = h."table"
+WHERE h.time >= $1 AND h.time <= $2 AND coalesce(u.kind, o.kind, '') <> '`+model.KindTenant+`'
+	AND ($3 OR coalesce(u.kind, o.kind, '') <> '`+model.KindContinuousAggregate+`')
+GROUP BY 1, 2, 3)
+SELECT user_id, month, avg(bytes)::DOUBLE PRECISION, max(bytes)::bigint FROM runs WHERE user_id IS NOT NULL GROUP BY 1, 2 ORDER BY 1, 2;`, db.config.PostgresUsageSchema)
+	rows, err := db.conn.Query(query, from, to, db.derivedIncluded())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	summaries = []model.UserSummary{}
+	for rows.Next() {
+		summary := model.UserSummary{}
+		err = rows.Scan(&summary.UserId, &summary.Month, &summary.AvgBytes, &summary.MaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,41 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func (db *DB) ListLifecycles() (result []model.Lifecycle, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT l.\"table\", l.first_seen_at, l.last_seen_at, EXISTS (SELECT 1 FROM %[1]v.usage u WHERE u.\"table\" = l.\"table\") FROM %[1]v.usage_lifecycle l ORDER BY l.\"table\";", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result = []model.Lifecycle{}
+	for rows.Next() {
+		l := model.Lifecycle{}
+		err = rows.Scan(&l.Table, &l.FirstSeenAt, &l.LastSeenAt, &l.Present)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, l)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,41 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+func (db *DB) UsageByMonth(table string) (result []model.MonthUsage, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT \"table\", month, bytes, updated_at FROM %v.usage_by_month WHERE \"table\" = $1 ORDER BY month;", db.config.PostgresUsageSchema), table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result = []model.MonthUsage{}
+	for rows.Next() {
+		m := model.MonthUsage{}
+		err = rows.Scan(&m.Table, &m.Month, &m.Bytes, &m.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+	return result, rows.Err()
+}
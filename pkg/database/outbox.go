@@ -0,0 +1,94 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func scanOutboxEntry(row interface {
+	Scan(dest ...interface{}) error
+}) (e model.OutboxEntry, err error) {
+	var payload []byte
+	var lastError, idempotencyKey pgtype.Text
+	err = row.Scan(&e.Id, &e.Destination, &payload, &e.CreatedAt, &e.Attempts, &e.NextAttemptAt, &lastError, &idempotencyKey)
+	e.Payload = payload
+	e.LastError = lastError.String
+	e.IdempotencyKey = idempotencyKey.String
+	return e, err
+}
+
+// ClaimOutboxEntries returns up to limit entries of the destination with a due attempt, oldest first. The next attempt of
+// the returned entries is moved lease into the future, so that concurrent relays skip them while they are delivered.
+func (db *DB) ClaimOutboxEntries(destination string, limit int, lease time.Duration) (entries []model.OutboxEntry, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf(`UPDATE %[1]v.usage_outbox SET next_attempt_at = $3 WHERE id IN (
+	SELECT id FROM %[1]v.usage_outbox WHERE destination = $1 AND next_attempt_at <= now() ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED)
+RETURNING id, destination, payload, created_at, attempts, next_attempt_at, last_error, idempotency_key;`, db.config.PostgresUsageSchema), destination, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries = []model.OutboxEntry{}
+	for rows.Next() {
+		e, err := scanOutboxEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Id < entries[j].Id
+	})
+	return entries, nil
+}
+
+func (db *DB) ListOutboxEntries() (entries []model.OutboxEntry, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT id, destination, payload, created_at, attempts, next_attempt_at, last_error, idempotency_key FROM %v.usage_outbox ORDER BY id;", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries = []model.OutboxEntry{}
+	for rows.Next() {
+		e, err := scanOutboxEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteOutboxEntry removes a delivered entry
+func (db *DB) DeleteOutboxEntry(id int64) error {
+	_, err := db.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage_outbox WHERE id = $1;", db.config.PostgresUsageSchema), id)
+	return err
+}
+
+// FailOutboxEntry records a failed attempt and schedules the next one
+func (db *DB) FailOutboxEntry(id int64, deliveryErr error, nextAttemptAt time.Time) error {
+	_, err := db.conn.Exec(fmt.Sprintf("UPDATE %v.usage_outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1;", db.config.PostgresUsageSchema), id, deliveryErr.Error(), nextAttemptAt)
+	return err
+}
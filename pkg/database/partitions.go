@@ -0,0 +1,50 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func (db *DB) UsageByPartition(table string) (result []model.PartitionUsage, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT \"table\", dimension, range_start, range_end, bytes, keys, updated_at FROM %v.usage_by_partition WHERE \"table\" = $1 ORDER BY dimension, range_start;", db.config.PostgresUsageSchema), table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result = []model.PartitionUsage{}
+	for rows.Next() {
+		p := model.PartitionUsage{}
+		var keys pgtype.TextArray
+		err = rows.Scan(&p.Table, &p.Dimension, &p.RangeStart, &p.RangeEnd, &p.Bytes, &keys, &p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		p.Keys = []string{}
+		if keys.Status == pgtype.Present {
+			err = keys.AssignTo(&p.Keys)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,73 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func (db *DB) ListQuotas() (quotas []model.Quota, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT kind, subject, bytes, updated_at FROM %v.usage_quotas ORDER BY kind, subject;", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	quotas = []model.Quota{}
+	for rows.Next() {
+		quota := model.Quota{}
+		var updatedAt pgtype.Timestamptz
+		err = rows.Scan(&quota.Kind, &quota.Subject, &quota.Bytes, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		quota.UpdatedAt = updatedAt.Time
+		quotas = append(quotas, quota)
+	}
+	return quotas, rows.Err()
+}
+
+func (db *DB) GetQuota(kind string, subject string) (quota model.Quota, err error) {
+	var updatedAt pgtype.Timestamptz
+	err = db.conn.QueryRow(fmt.Sprintf("SELECT kind, subject, bytes, updated_at FROM %v.usage_quotas WHERE kind = $1 AND subject = $2;", db.config.PostgresUsageSchema), kind, subject).Scan(&quota.Kind, &quota.Subject, &quota.Bytes, &updatedAt)
+	if err == pgx.ErrNoRows {
+		return quota, ErrNotFound
+	}
+	quota.UpdatedAt = updatedAt.Time
+	return quota, err
+}
+
+func (db *DB) SetQuota(quota model.Quota) (model.Quota, error) {
+	quota.UpdatedAt = time.Now()
+	_, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %v.usage_quotas (kind, subject, bytes, updated_at) VALUES ($1, $2, $3, $4) ON CONFLICT (kind, subject) DO UPDATE SET bytes = $3, updated_at = $4;", db.config.PostgresUsageSchema), quota.Kind, quota.Subject, quota.Bytes, quota.UpdatedAt)
+	return quota, err
+}
+
+func (db *DB) DeleteQuota(kind string, subject string) error {
+	tag, err := db.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage_quotas WHERE kind = $1 AND subject = $2;", db.config.PostgresUsageSchema), kind, subject)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
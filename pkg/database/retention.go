@@ -0,0 +1,109 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+var ErrInvalidInterval = errors.New("invalid interval")
+
+// RetentionDefaults are the configured retentions, aggregates are kept as long as the raw history unless configured
+func RetentionDefaults(config configuration.Config) map[string]string {
+	aggregates := config.HistoryAggregateRetention
+	if aggregates == "" {
+		aggregates = config.HistoryRetention
+	}
+	return map[string]string{
+		model.RetentionKindHistory:    config.HistoryRetention,
+		model.RetentionKindAggregates: aggregates,
+		model.RetentionKindAudit:      config.AuditRetention,
+	}
+}
+
+// ListRetentions returns the effective retention of every kind, set by the api or falling back to the config
+func (db *DB) ListRetentions() (retentions []model.Retention, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT kind, interval, updated_at FROM %v.usage_retention;", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	overrides := map[string]model.Retention{}
+	for rows.Next() {
+		r := model.Retention{Source: model.RetentionSourceApi}
+		var updatedAt pgtype.Timestamptz
+		err = rows.Scan(&r.Kind, &r.Interval, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		r.UpdatedAt = &updatedAt.Time
+		overrides[r.Kind] = r
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	defaults := RetentionDefaults(db.config)
+	for _, kind := range model.RetentionKinds {
+		r, ok := overrides[kind]
+		if !ok {
+			r = model.Retention{Kind: kind, Interval: defaults[kind], Source: model.RetentionSourceConfig}
+		}
+		retentions = append(retentions, r)
+	}
+	return retentions, nil
+}
+
+func (db *DB) validateInterval(interval string) error {
+	_, err := db.conn.Exec("SELECT $1::interval;", interval)
+	var pgErr pgx.PgError
+	if errors.As(err, &pgErr) {
+		return fmt.Errorf("%w: %v", ErrInvalidInterval, pgErr.Message)
+	}
+	return err
+}
+
+// SetRetention overrides the configured retention of a kind, an empty interval keeps records forever
+func (db *DB) SetRetention(kind string, interval string) (model.Retention, error) {
+	if interval != "" {
+		err := db.validateInterval(interval)
+		if err != nil {
+			return model.Retention{}, err
+		}
+	}
+	now := time.Now()
+	_, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %v.usage_retention (kind, interval, updated_at) VALUES ($1, $2, $3) ON CONFLICT (kind) DO UPDATE SET interval = $2, updated_at = $3;", db.config.PostgresUsageSchema), kind, interval, now)
+	return model.Retention{Kind: kind, Interval: interval, Source: model.RetentionSourceApi, UpdatedAt: &now}, err
+}
+
+// DeleteRetention restores the configured retention of a kind
+func (db *DB) DeleteRetention(kind string) error {
+	tag, err := db.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage_retention WHERE kind = $1;", db.config.PostgresUsageSchema), kind)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// drop_chunks only drops chunks ending before the cutoff, chunks overlapping it are kept entirely
+const retentionSimulationQuery = `SELECT count(*) FILTER (WHERE c.range_end <= $3),
+coalesce(sum(d.total_bytes) FILTER (WHERE c.range_end <= $3), 0)::bigint,
+coalesce(sum(d.total_bytes) FILTER (WHERE c.range_end IS NULL OR c.range_end > $3), 0)::bigint
+FROM chunks_detailed_size(format('%I.%I', $1::text, $2::text)::regclass) d
+JOIN timescaledb_information.chunks c ON c.chunk_schema = d.chunk_schema AND c.chunk_name = d.chunk_name;`
+
+// SimulateRetention estimates the bytes freed by dropping all chunks of a hypertable of the source schema older than
+// interval. Tiered chunks are not included.
+func (db *DB) SimulateRetention(table string, interval string) (simulation model.RetentionSimulation, err error) {
+	err = db.validateInterval(interval)
+	if err != nil {
+		return simulation, err
+	}
+	var cutoff time.Time
+	err = db.conn.QueryRow("SELECT now() - $1::interval;", interval).Scan(&cutoff)
+	if err != nil {
+		return simulation, err
+	}
+	simulation, err = db.SimulateDrop(table, cutoff)
+	simulation.Interval = interval
+	return simulation, err
+}
+
+// SimulateDrop estimates the bytes freed by dropping all chunks of a hypertable of the source schema ending before cutoff
+func (db *DB) SimulateDrop(table string, cutoff time.Time) (simulation model.RetentionSimulation, err error) {
+	err = db.hypertableExists(table)
+	if err != nil {
+		return simulation, err
+	}
+	simulation = model.RetentionSimulation{Table: table, Cutoff: cutoff}
+	err = db.conn.QueryRow(retentionSimulationQuery, db.config.PostgresSourceSchema, table, cutoff).Scan(&simulation.Chunks, &simulation.Bytes, &simulation.RemainingBytes)
+	return simulation, err
+}
+
+func (db *DB) hypertableExists(table string) error {
+	var exists bool
+	err := db.conn.QueryRow("SELECT EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_schema = $1 AND hypertable_name = $2);", db.config.PostgresSourceSchema, table).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const ActionDropChunks = "drop_chunks"
+
+// DropChunks drops all chunks of a hypertable of the source schema ending before the given time and records the
+// action in the audit table, whether it succeeded or not.
+func (db *DB) DropChunks(table string, before time.Time, by string) (chunks []string, err error) {
+	err = db.hypertableExists(table)
+	if err != nil {
+		return nil, err
+	}
+	chunks, dropErr := db.dropChunks(table, before)
+	details := fmt.Sprintf("older_than %v, %v chunks", before.Format(time.RFC3339), len(chunks))
+	errText := pgtype.Text{Status: pgtype.Null}
+	if dropErr != nil {
+		errText = pgtype.Text{String: dropErr.Error(), Status: pgtype.Present}
+	}
+	_, err = db.conn.Exec(fmt.Sprintf("INSERT INTO %v.usage_actions (\"table\", action, details, error, by, created_at) VALUES ($1, $2, $3, $4, $5, now());", db.config.PostgresUsageSchema), table, ActionDropChunks, details, &errText, by)
+	if dropErr != nil {
+		return nil, dropErr
+	}
+	return chunks, err
+}
+
+// dropChunks checks for a legal hold and drops the chunks in one transaction, holding off new holds until the drop
+// is committed
+func (db *DB) dropChunks(table string, before time.Time) (chunks []string, err error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	err = db.lockLegalHold(tx, table, true)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(fmt.Sprintf("SELECT \"table\" FROM %v.usage_legal_holds WHERE \"table\" = $1 FOR SHARE;", db.config.PostgresUsageSchema), table).Scan(new(string))
+	if err == nil {
+		return nil, ErrLegalHold
+	}
+	if err != pgx.ErrNoRows {
+		return nil, err
+	}
+	rows, err := tx.Query("SELECT drop_chunks(format('%I.%I', $1::text, $2::text)::regclass, older_than => $3::timestamptz)::text;", db.config.PostgresSourceSchema, table, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	chunks = []string{}
+	for rows.Next() {
+		var chunk string
+		err = rows.Scan(&chunk)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return chunks, tx.Commit()
+}
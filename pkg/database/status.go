@@ -0,0 +1,75 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func scanRunStatus(row interface {
+	Scan(dest ...interface{}) error
+}) (s model.RunStatus, err error) {
+	var currentTable, runErr pgtype.Text
+	var finishedAt pgtype.Timestamptz
+	err = row.Scan(&s.Shard, &s.RunStartedAt, &s.TablesDone, &s.TablesTotal, &currentTable, &finishedAt, &runErr, &s.UpdatedAt)
+	s.CurrentTable = currentTable.String
+	s.FinishedAt = timePtr(finishedAt)
+	s.Error = runErr.String
+	return s, err
+}
+
+func (db *DB) ListRunStatus() (result []model.RunStatus, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT shard, run_started_at, tables_done, tables_total, current_table, finished_at, error, updated_at FROM %v.usage_run_status ORDER BY shard;", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result = []model.RunStatus{}
+	for rows.Next() {
+		s, err := scanRunStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// ListRuns returns the runs of all shards started in [from, to), latest first
+func (db *DB) ListRuns(from time.Time, to time.Time) (result []model.Run, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT id, shard, started_at, finished_at, duration_seconds, outcome, error, tables_done, tables_total FROM %v.usage_runs WHERE started_at >= $1 AND started_at < $2 ORDER BY started_at DESC, shard;", db.config.PostgresUsageSchema), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result = []model.Run{}
+	for rows.Next() {
+		run := model.Run{}
+		var runErr pgtype.Text
+		err = rows.Scan(&run.Id, &run.Shard, &run.StartedAt, &run.FinishedAt, &run.DurationSeconds, &run.Outcome, &runErr, &run.TablesDone, &run.TablesTotal)
+		if err != nil {
+			return nil, err
+		}
+		run.Error = runErr.String
+		result = append(result, run)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,35 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func (db *DB) GetSummary() (summary model.Summary, err error) {
+	var updatedAt pgtype.Timestamptz
+	err = db.conn.QueryRow(fmt.Sprintf("SELECT database_bytes, tracked_bytes, untracked_bytes, updated_at FROM %v.usage_summary WHERE id = 1;", db.config.PostgresUsageSchema)).Scan(&summary.DatabaseBytes, &summary.TrackedBytes, &summary.UntrackedBytes, &updatedAt)
+	if err == pgx.ErrNoRows {
+		return summary, ErrNotFound
+	}
+	summary.UpdatedAt = updatedAt.Time
+	return summary, err
+}
@@ -0,0 +1,88 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/jackc/pgx"
+)
+
+// pool is implemented by the connection pool and by tracedPool
+type pool interface {
+	Exec(sql string, arguments ...interface{}) (pgx.CommandTag, error)
+	Query(sql string, args ...interface{}) (*pgx.Rows, error)
+	QueryRow(sql string, args ...interface{}) *pgx.Row
+	Begin() (*pgx.Tx, error)
+	BeginEx(ctx context.Context, txOptions *pgx.TxOptions) (*pgx.Tx, error)
+	Close()
+}
+
+// W3C trace context, version 00
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// Traced returns a DB tagging its queries with the traceparent of a request, so that slow requests can be correlated
+// with their statements in pg_stat_activity and the postgres logs. Statements carry the traceparent as sqlcommenter
+// comment, transactions as application_name. Returns db itself for a missing or malformed traceparent.
+func (db *DB) Traced(traceparent string) *DB {
+	if !traceparentPattern.MatchString(traceparent) {
+		return db
+	}
+	return &DB{conn: &tracedPool{pool: db.conn, traceparent: traceparent}, config: db.config}
+}
+
+type tracedPool struct {
+	pool
+	traceparent string
+}
+
+func (t *tracedPool) comment(sql string) string {
+	return "/*traceparent='" + t.traceparent + "'*/ " + sql
+}
+
+func (t *tracedPool) Exec(sql string, arguments ...interface{}) (pgx.CommandTag, error) {
+	return t.pool.Exec(t.comment(sql), arguments...)
+}
+
+func (t *tracedPool) Query(sql string, args ...interface{}) (*pgx.Rows, error) {
+	return t.pool.Query(t.comment(sql), args...)
+}
+
+func (t *tracedPool) QueryRow(sql string, args ...interface{}) *pgx.Row {
+	return t.pool.QueryRow(t.comment(sql), args...)
+}
+
+func (t *tracedPool) Begin() (*pgx.Tx, error) {
+	return t.BeginEx(context.Background(), nil)
+}
+
+func (t *tracedPool) BeginEx(ctx context.Context, txOptions *pgx.TxOptions) (*pgx.Tx, error) {
+	tx, err := t.pool.BeginEx(ctx, txOptions)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecEx(ctx, "SELECT set_config('application_name', $1, true);", nil, t.traceparent)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Close leaves the shared pool open
+func (t *tracedPool) Close() {}
@@ -0,0 +1,230 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// usageColumns selects the columns read by scanUsage from the usage table, including the tags of its annotations
+// and whether it is under legal hold
+func (db *DB) usageColumns() string {
+	return fmt.Sprintf("\"table\", bytes, updated_at, bytes_per_day, growth_r2, bytes_local, bytes_tiered, bytes_smoothed, owner, kind, chunk_count, avg_chunk_bytes, tiny_chunks, rows_per_day, dead_tuples, live_tuples, last_vacuum, tenant, source_table, source_user, method, error_margin, (SELECT array_agg(DISTINCT tag) FROM %[1]v.usage_annotations a, unnest(a.tags) tag WHERE a.\"table\" = usage.\"table\"), EXISTS (SELECT 1 FROM %[1]v.usage_legal_holds h WHERE h.\"table\" = usage.\"table\")", db.config.PostgresUsageSchema)
+}
+
+func scanUsage(row interface {
+	Scan(dest ...interface{}) error
+}) (usage model.Usage, err error) {
+	var bytesPerDay, growthR2, bytesSmoothed, rowsPerDay, errorMargin pgtype.Float8
+	var bytesLocal, bytesTiered, chunkCount, avgChunkBytes, deadTuples, liveTuples pgtype.Int8
+	var tinyChunks pgtype.Bool
+	var updatedAt, lastVacuum pgtype.Timestamptz
+	var owner, kind, tenant, sourceTable, sourceUser, method pgtype.Text
+	var tags pgtype.TextArray
+	err = row.Scan(&usage.Table, &usage.Bytes, &updatedAt, &bytesPerDay, &growthR2, &bytesLocal, &bytesTiered, &bytesSmoothed, &owner, &kind, &chunkCount, &avgChunkBytes, &tinyChunks, &rowsPerDay, &deadTuples, &liveTuples, &lastVacuum, &tenant, &sourceTable, &sourceUser, &method, &errorMargin, &tags, &usage.LegalHold)
+	if err != nil {
+		return usage, err
+	}
+	if updatedAt.Status == pgtype.Present {
+		usage.UpdatedAt = updatedAt.Time
+	}
+	if bytesPerDay.Status == pgtype.Present {
+		usage.BytesPerDay = bytesPerDay.Float
+	}
+	if growthR2.Status == pgtype.Present {
+		usage.GrowthR2 = &growthR2.Float
+	}
+	if bytesLocal.Status == pgtype.Present {
+		usage.BytesLocal = &bytesLocal.Int
+	}
+	if bytesTiered.Status == pgtype.Present {
+		usage.BytesTiered = &bytesTiered.Int
+	}
+	usage.Owner = owner.String
+	usage.Kind = kind.String
+	usage.Tenant = tenant.String
+	usage.SourceTable = sourceTable.String
+	usage.SourceUser = sourceUser.String
+	usage.Method = method.String
+	if errorMargin.Status == pgtype.Present {
+		usage.ErrorMargin = &errorMargin.Float
+	}
+	usage.TinyChunks = tinyChunks.Bool
+	if chunkCount.Status == pgtype.Present {
+		usage.ChunkCount = &chunkCount.Int
+	}
+	if avgChunkBytes.Status == pgtype.Present {
+		usage.AvgChunkBytes = &avgChunkBytes.Int
+	}
+	if bytesSmoothed.Status == pgtype.Present {
+		usage.BytesSmoothed = &bytesSmoothed.Float
+	}
+	if rowsPerDay.Status == pgtype.Present {
+		usage.RowsPerDay = &rowsPerDay.Float
+	}
+	if deadTuples.Status == pgtype.Present {
+		usage.DeadTuples = &deadTuples.Int
+	}
+	if liveTuples.Status == pgtype.Present {
+		usage.LiveTuples = &liveTuples.Int
+	}
+	if lastVacuum.Status == pgtype.Present {
+		usage.LastVacuum = &lastVacuum.Time
+	}
+	usage.Tags = []string{}
+	if tags.Status == pgtype.Present {
+		err = tags.AssignTo(&usage.Tags)
+	}
+	return usage, err
+}
+
+func (db *DB) GetUsage(table string) (usage model.Usage, err error) {
+	usage, err = scanUsage(db.conn.QueryRow(fmt.Sprintf("SELECT "+db.usageColumns()+" FROM %v.usage WHERE \"table\" = $1;", db.config.PostgresUsageSchema), table))
+	if err == pgx.ErrNoRows {
+		return usage, ErrNotFound
+	}
+	return usage, err
+}
+
+// GetUsages returns the usage of all given tables, unknown tables are omitted
+func (db *DB) GetUsages(tables []string) (usages []model.Usage, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT "+db.usageColumns()+" FROM %v.usage WHERE \"table\" = ANY($1) ORDER BY \"table\";", db.config.PostgresUsageSchema), tables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	usages = []model.Usage{}
+	for rows.Next() {
+		usage, err := scanUsage(rows)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+	}
+	return usages, rows.Err()
+}
+
+// ListUsages returns the usage of all tables
+func (db *DB) ListUsages() (usages []model.Usage, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT "+db.usageColumns()+" FROM %v.usage ORDER BY \"table\";", db.config.PostgresUsageSchema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	usages = []model.Usage{}
+	for rows.Next() {
+		usage, err := scanUsage(rows)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+	}
+	return usages, rows.Err()
+}
+
+// LargestTables lists the usage of the largest tables
+func (db *DB) LargestTables(limit int) (usages []model.Usage, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT "+db.usageColumns()+" FROM %v.usage ORDER BY bytes DESC LIMIT $1;", db.config.PostgresUsageSchema), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	usages = []model.Usage{}
+	for rows.Next() {
+		usage, err := scanUsage(rows)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+	}
+	return usages, rows.Err()
+}
+
+// LastUpdated is the time of the latest change of usage or usage_run_status, which only runs write. The run status is
+// updated by every run, so the time doesn't move backwards when usage rows of dropped tables are deleted.
+func (db *DB) LastUpdated() (t time.Time, err error) {
+	var updatedAt pgtype.Timestamptz
+	err = db.conn.QueryRow(fmt.Sprintf("SELECT greatest((SELECT max(updated_at) FROM %[1]v.usage), (SELECT max(updated_at) FROM %[1]v.usage_run_status));", db.config.PostgresUsageSchema)).Scan(&updatedAt)
+	if err != nil {
+		return t, err
+	}
+	if updatedAt.Status == pgtype.Present {
+		t = updatedAt.Time
+	}
+	return t, nil
+}
+
+const (
+	ForecastMethodLinear   = "linear"
+	ForecastMethodSeasonal = "seasonal"
+)
+
+// Forecast estimates the size of a table at the given date. The linear method extrapolates the current growth rate,
+// the seasonal method evaluates the stored Holt-Winters model.
+func (db *DB) Forecast(table string, date time.Time, method string) (forecast model.Forecast, err error) {
+	usage, err := db.GetUsage(table)
+	if err != nil {
+		return forecast, err
+	}
+	forecast = model.Forecast{
+		Table:       table,
+		Date:        date,
+		Method:      method,
+		BytesPerDay: usage.BytesPerDay,
+	}
+	switch method {
+	case ForecastMethodSeasonal:
+		m, err := db.GetSeasonalModel(table)
+		if err != nil {
+			return forecast, err
+		}
+		forecast.Bytes = int64(m.Forecast(date))
+		forecast.BytesPerDay = m.Trend
+	default:
+		forecast.Method = ForecastMethodLinear
+		days := date.Sub(usage.UpdatedAt).Hours() / 24
+		bytes := float64(usage.Bytes) + usage.BytesPerDay*days
+		if bytes < 0 {
+			bytes = 0
+		}
+		forecast.Bytes = int64(bytes)
+	}
+	return forecast, nil
+}
+
+func (db *DB) GetSeasonalModel(table string) (m model.SeasonalModel, err error) {
+	var seasonal []float64
+	var lastDay pgtype.Timestamptz
+	err = db.conn.QueryRow(fmt.Sprintf("SELECT \"table\", alpha, beta, gamma, level, trend, seasonal, last_day FROM %v.usage_forecast WHERE \"table\" = $1;", db.config.PostgresUsageSchema), table).Scan(&m.Table, &m.Alpha, &m.Beta, &m.Gamma, &m.Level, &m.Trend, &seasonal, &lastDay)
+	if err == pgx.ErrNoRows {
+		return m, ErrNotFound
+	}
+	if err != nil {
+		return m, err
+	}
+	copy(m.Seasonal[:], seasonal)
+	m.LastDay = lastDay.Time
+	return m, nil
+}
@@ -0,0 +1,121 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+const violationColumns = "id, kind, subject, state, bytes, quota_bytes, grace_until, created_at, updated_at, resolved_at, acknowledged_at, acknowledged_by, override_until, override_by, exceeded_at"
+
+func timePtr(t pgtype.Timestamptz) *time.Time {
+	if t.Status != pgtype.Present {
+		return nil
+	}
+	return &t.Time
+}
+
+func scanViolation(row interface {
+	Scan(dest ...interface{}) error
+}) (v model.Violation, err error) {
+	var graceUntil, createdAt, updatedAt, resolvedAt, acknowledgedAt, overrideUntil, exceededAt pgtype.Timestamptz
+	var acknowledgedBy, overrideBy pgtype.Text
+	err = row.Scan(&v.Id, &v.Kind, &v.Subject, &v.State, &v.Bytes, &v.QuotaBytes, &graceUntil, &createdAt, &updatedAt, &resolvedAt, &acknowledgedAt, &acknowledgedBy, &overrideUntil, &overrideBy, &exceededAt)
+	if err != nil {
+		return v, err
+	}
+	v.GraceUntil = timePtr(graceUntil)
+	v.CreatedAt = createdAt.Time
+	v.UpdatedAt = updatedAt.Time
+	v.ResolvedAt = timePtr(resolvedAt)
+	v.AcknowledgedAt = timePtr(acknowledgedAt)
+	v.AcknowledgedBy = acknowledgedBy.String
+	v.OverrideUntil = timePtr(overrideUntil)
+	v.OverrideBy = overrideBy.String
+	v.ExceededAt = timePtr(exceededAt)
+	return v, nil
+}
+
+// ListViolations lists open violations, or all violations if includeResolved is set.
+func (db *DB) ListViolations(includeResolved bool) (violations []model.Violation, err error) {
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT "+violationColumns+" FROM %v.usage_violations WHERE $1 OR state <> 'resolved' ORDER BY id;", db.config.PostgresUsageSchema), includeResolved)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	violations = []model.Violation{}
+	for rows.Next() {
+		v, err := scanViolation(rows)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, v)
+	}
+	return violations, rows.Err()
+}
+
+func (db *DB) GetViolation(id int64) (v model.Violation, err error) {
+	v, err = scanViolation(db.conn.QueryRow(fmt.Sprintf("SELECT "+violationColumns+" FROM %v.usage_violations WHERE id = $1;", db.config.PostgresUsageSchema), id))
+	if err == pgx.ErrNoRows {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+func (db *DB) AcknowledgeViolation(id int64, by string, comment string) (model.Violation, error) {
+	return db.updateViolation(id, "ack", by, pgtype.Timestamptz{Status: pgtype.Null}, comment,
+		"UPDATE %v.usage_violations SET acknowledged_at = now(), acknowledged_by = $2 WHERE id = $1;")
+}
+
+// OverrideViolation suppresses the enforcement of a violation until the given time.
+func (db *DB) OverrideViolation(id int64, by string, until time.Time, comment string) (model.Violation, error) {
+	return db.updateViolation(id, "override", by, pgtype.Timestamptz{Time: until, Status: pgtype.Present}, comment,
+		"UPDATE %v.usage_violations SET override_until = $3, override_by = $2 WHERE id = $1;")
+}
+
+func (db *DB) updateViolation(id int64, action string, by string, until pgtype.Timestamptz, comment string, update string) (v model.Violation, err error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return v, err
+	}
+	defer tx.Rollback()
+	args := []interface{}{id, by}
+	if until.Status == pgtype.Present {
+		args = append(args, &until)
+	}
+	tag, err := tx.Exec(fmt.Sprintf(update, db.config.PostgresUsageSchema), args...)
+	if err != nil {
+		return v, err
+	}
+	if tag.RowsAffected() == 0 {
+		return v, ErrNotFound
+	}
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %v.usage_violation_audit (violation_id, action, by, until, comment, created_at) VALUES ($1, $2, $3, $4, $5, now());", db.config.PostgresUsageSchema), id, action, by, &until, comment)
+	if err != nil {
+		return v, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return v, err
+	}
+	return db.GetViolation(id)
+}
@@ -0,0 +1,81 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package debug
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/jackc/pgx"
+)
+
+var enabled atomic.Bool
+
+// Enabled reports whether verbose debug logging of SQL statements and per table timings is on
+func Enabled() bool {
+	return enabled.Load()
+}
+
+func Set(value bool) {
+	enabled.Store(value)
+	if value {
+		log.Println("debug logging enabled")
+	} else {
+		log.Println("debug logging disabled")
+	}
+}
+
+func Printf(format string, v ...interface{}) {
+	if Enabled() {
+		log.Printf("DEBUG: "+format, v...)
+	}
+}
+
+// ToggleOnSignal switches debug logging on every SIGUSR1, so slow runs can be diagnosed without redeploying
+func ToggleOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			Set(!Enabled())
+		}
+	}()
+}
+
+// PgxLogger logs all statements executed by pgx while debug logging is enabled. With RedactStatements, e.g. for
+// log_table_names redact or hash, statements, arguments and errors are left out, since they contain table names.
+type PgxLogger struct {
+	RedactStatements bool
+}
+
+func (l PgxLogger) Log(level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if !Enabled() {
+		return
+	}
+	if l.RedactStatements {
+		log.Printf("DEBUG: pgx %v %v <redacted> time=%v failed=%v", level, msg, data["time"], data["err"] != nil)
+		return
+	}
+	if sql, ok := data["sql"]; ok {
+		log.Printf("DEBUG: %v %v args=%v time=%v err=%v", msg, sql, data["args"], data["time"], data["err"])
+		return
+	}
+	log.Printf("DEBUG: pgx %v %v %v", level, msg, data)
+}
@@ -0,0 +1,187 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/signing"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/parquet-go/parquet-go"
+)
+
+type Exporter struct {
+	db     *database.DB
+	config configuration.Config
+	s3     *minio.Client
+	signer *signing.Signer
+}
+
+// Start periodically exports every completed day of usage history as parquet file,
+// partitioned as date=YYYY-MM-DD/usage_history.parquet below the configured path or bucket prefix.
+func Start(ctx context.Context, wg *sync.WaitGroup, config configuration.Config) error {
+	d, err := time.ParseDuration(config.ParquetExportDuration)
+	if err != nil {
+		return err
+	}
+	signer, err := signing.New(config)
+	if err != nil {
+		return err
+	}
+	db, err := database.New(config, "export")
+	if err != nil {
+		return err
+	}
+	e := &Exporter{db: db, config: config, signer: signer}
+	if config.ParquetExportS3Bucket != "" {
+		e.s3, err = minio.New(config.ParquetExportS3Endpoint, &minio.Options{
+			Creds:  credentials.NewStaticV4(config.ParquetExportS3AccessKey, config.ParquetExportS3SecretKey, ""),
+			Secure: config.ParquetExportS3UseSsl,
+		})
+		if err != nil {
+			db.Close()
+			return err
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer db.Close()
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := e.export(ctx)
+				if err != nil {
+					log.Println("ERROR: parquet export", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (e *Exporter) export(ctx context.Context) error {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	days, err := e.db.UnexportedDays(today)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		err = e.exportDay(ctx, day)
+		if err != nil {
+			return err
+		}
+		err = e.db.MarkExported(day)
+		if err != nil {
+			return err
+		}
+		log.Println("Exported usage history of", day.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// exportDay streams the parquet file of the day to its destination. Only a detached signature needs the whole file,
+// so the file is kept in memory only with signing_key_file.
+func (e *Exporter) exportDay(ctx context.Context, day time.Time) error {
+	var signed *bytes.Buffer
+	err := e.write(ctx, path.Join("date="+day.Format(time.DateOnly), "usage_history.parquet"), "application/vnd.apache.parquet", func(w io.Writer) error {
+		if e.signer != nil {
+			signed = &bytes.Buffer{}
+			w = io.MultiWriter(w, signed)
+		}
+		writer := parquet.NewGenericWriter[model.HistoryEntry](w)
+		err := e.db.StreamHistoryOfDay(day, 1000, func(batch []model.HistoryEntry) error {
+			_, err := writer.Write(batch)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+	if err != nil || signed == nil {
+		return err
+	}
+	signature, err := e.signer.SignDetached(signed.Bytes())
+	if err != nil {
+		return err
+	}
+	return e.write(ctx, path.Join("date="+day.Format(time.DateOnly), "usage_history.parquet.jws"), "application/jose", func(w io.Writer) error {
+		_, err := io.WriteString(w, signature)
+		return err
+	})
+}
+
+// uploads of unknown size are split into parts of this size, which bounds the memory used per upload
+const s3PartSize = 16 << 20
+
+// write streams the content produced by fill to the bucket as multipart upload, or to a file below the export path,
+// which is only renamed into place once complete
+func (e *Exporter) write(ctx context.Context, name string, contentType string, fill func(w io.Writer) error) error {
+	if e.s3 != nil {
+		reader, writer := io.Pipe()
+		filled := make(chan error, 1)
+		go func() {
+			err := fill(writer)
+			writer.CloseWithError(err)
+			filled <- err
+		}()
+		_, err := e.s3.PutObject(ctx, e.config.ParquetExportS3Bucket, path.Join(e.config.ParquetExportPath, name), reader, -1, minio.PutObjectOptions{ContentType: contentType, PartSize: s3PartSize})
+		reader.CloseWithError(err)
+		fillErr := <-filled
+		if fillErr != nil {
+			return fillErr
+		}
+		return err
+	}
+	file := filepath.Join(e.config.ParquetExportPath, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	err = fill(f)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file + ".tmp")
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
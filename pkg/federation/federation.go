@@ -0,0 +1,122 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+type Federation struct {
+	db     *database.DB
+	config configuration.Config
+	client *http.Client
+}
+
+// Start fetches the summary and the tables of every instance in federation_clusters each federation_interval into
+// usage_federation and usage_federation_tables, combining the clusters of a platform into one capacity overview.
+func Start(ctx context.Context, wg *sync.WaitGroup, config configuration.Config) error {
+	interval, err := time.ParseDuration(config.FederationInterval)
+	if err != nil {
+		return err
+	}
+	db, err := database.New(config, "federation")
+	if err != nil {
+		return err
+	}
+	f := &Federation{db: db, config: config, client: &http.Client{Timeout: time.Minute}}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer db.Close()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := f.fetchAll(ctx)
+			if err != nil {
+				log.Println("ERROR: federation", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// fetchAll fetches all clusters, a failing cluster is recorded with its error and doesn't stop the others
+func (f *Federation) fetchAll(ctx context.Context) error {
+	clusters := []string{}
+	for cluster, url := range f.config.FederationClusters {
+		clusters = append(clusters, cluster)
+		now := time.Now()
+		summary := model.Summary{}
+		usages := []model.Usage{}
+		err := f.fetch(ctx, url, "/summary", &summary)
+		if err == nil {
+			err = f.fetch(ctx, url, "/usage", &usages)
+		}
+		if err != nil {
+			log.Println("WARNING: unable to fetch usage of cluster", cluster, err)
+			err = f.db.SetClusterError(cluster, err, now)
+		} else {
+			err = f.db.SetClusterTables(cluster, usages)
+			if err == nil {
+				err = f.db.SetClusterSummary(cluster, summary, now)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return f.db.DeleteOtherClusters(clusters)
+}
+
+// fetch decodes the response of the api of the cluster at url to result
+func (f *Federation) fetch(ctx context.Context, url string, path string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(url, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if f.config.FederationToken != "" {
+		req.Header.Set("Authorization", "Bearer "+f.config.FederationToken)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %v: %v", resp.StatusCode, string(body))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
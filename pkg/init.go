@@ -24,18 +24,75 @@ import (
 
 	"net/http"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/SENERGY-Platform/timescale-usage/pkg/api"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/billing"
 	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/debug"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/export"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/federation"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/outbox"
 	"github.com/SENERGY-Platform/timescale-usage/pkg/worker"
 )
 
 func Start(ctx context.Context, config configuration.Config) (wg *sync.WaitGroup, err error) {
 	metricsPort := strconv.Itoa(config.MetricsPort)
 	log.Println("Starting metrics server on port " + metricsPort)
-	http.Handle("/metrics", promhttp.Handler())
-	go http.ListenAndServe(":"+metricsPort, nil)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	if config.RuntimeMetrics {
+		// replaces the default go collector, which only exports a small subset of runtime/metrics
+		prometheus.Unregister(collectors.NewGoCollector())
+		prometheus.MustRegister(collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsAll)))
+	}
+	if config.Pprof {
+		log.Println("Serving pprof on port " + metricsPort)
+		handlePprof(mux, config.PprofToken)
+	}
+	go http.ListenAndServe(":"+metricsPort, mux)
+	if config.Debug {
+		debug.Set(true)
+	}
+	debug.ToggleOnSignal()
 	wg = &sync.WaitGroup{}
+	if config.ApiPort != 0 {
+		err = api.Start(ctx, wg, config)
+		if err != nil {
+			return wg, err
+		}
+	}
+	// replicas of a sharded worker share the usage schema, these services must only run on one of them
+	singleton, err := worker.Singleton(config)
+	if err != nil {
+		return wg, err
+	}
+	if singleton {
+		if config.ParquetExportDuration != "" {
+			err = export.Start(ctx, wg, config)
+			if err != nil {
+				return wg, err
+			}
+		}
+		if len(config.BillingExporters) > 0 {
+			err = billing.Start(ctx, wg, config)
+			if err != nil {
+				return wg, err
+			}
+		}
+		err = outbox.Start(ctx, wg, config)
+		if err != nil {
+			return wg, err
+		}
+		if config.FederationInterval != "" && len(config.FederationClusters) > 0 {
+			err = federation.Start(ctx, wg, config)
+			if err != nil {
+				return wg, err
+			}
+		}
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -0,0 +1,40 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+// tables annotated with this tag are skipped by automatic enforcement and retention
+const AnnotationTagKeep = "keep"
+
+type Annotation struct {
+	Id        int64     `json:"id"`
+	Table     string    `json:"table"`
+	Note      string    `json:"note"`
+	Tags      []string  `json:"tags"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LegalHold prevents any automated or requested action from modifying a table and purging its history
+type LegalHold struct {
+	Table     string     `json:"table"`
+	LegalHold bool       `json:"legal_hold"`
+	Reason    string     `json:"reason"`
+	SetBy     string     `json:"set_by,omitempty"`
+	SetAt     *time.Time `json:"set_at"`
+}
@@ -0,0 +1,28 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+// BenchmarkReport are the durations of consecutive collection runs. The first run measures all tables from scratch,
+// later runs profit from the previous sizes, e.g. for sampling and cached tables.
+type BenchmarkReport struct {
+	Tables          int64     `json:"tables"`
+	RunSeconds      []float64 `json:"run_seconds"`
+	MinSeconds      float64   `json:"min_seconds"`
+	AvgSeconds      float64   `json:"avg_seconds"`
+	MaxSeconds      float64   `json:"max_seconds"`
+	TablesPerSecond float64   `json:"tables_per_second"`
+}
@@ -0,0 +1,35 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+const (
+	BillingExportStatusSucceeded = "succeeded"
+	BillingExportStatusFailed    = "failed"
+)
+
+// BillingExport is the delivery state of the invoice line items of a period to one billing exporter
+type BillingExport struct {
+	Exporter       string    `json:"exporter"`
+	PeriodStart    time.Time `json:"period_start"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"last_error"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
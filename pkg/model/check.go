@@ -0,0 +1,38 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+// CheckReport is the result of the check command, Ok if all checks passed
+type CheckReport struct {
+	Ok     bool          `json:"ok"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Name    string `json:"name"`
+	Ok      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+func (r *CheckReport) Add(name string, err error, message string) {
+	result := CheckResult{Name: name, Ok: err == nil, Message: message}
+	if err != nil {
+		result.Message = err.Error()
+	}
+	r.Checks = append(r.Checks, result)
+	r.Ok = r.Ok && result.Ok
+}
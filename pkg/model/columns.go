@@ -0,0 +1,29 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+// ColumnSize is the experimental estimate of the storage share of a column, sampled from the latest rows of a table
+type ColumnSize struct {
+	Table          string    `json:"table"`
+	Column         string    `json:"column"`
+	AvgBytes       float64   `json:"avg_bytes"`
+	Share          *float64  `json:"share"`
+	EstimatedBytes *int64    `json:"estimated_bytes"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,117 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// BytesPerGb is the unit of prices, decimal gigabytes as used by contracts
+const BytesPerGb = 1e9
+
+const (
+	CostRoundingHalfUp   = "half_up"
+	CostRoundingHalfEven = "half_even"
+	CostRoundingUp       = "up"
+	CostRoundingDown     = "down"
+)
+
+// RoundCost rounds cost to precision decimal places with one of the CostRounding modes. The scaled cost is rounded to
+// 15 significant digits first, so that binary noise like 1.1 * 100 = 110.00000000000001 doesn't round up a cent.
+func RoundCost(cost float64, precision int, mode string) (float64, error) {
+	scale := math.Pow10(precision)
+	scaled, err := strconv.ParseFloat(strconv.FormatFloat(cost*scale, 'g', 15, 64), 64)
+	if err != nil {
+		return 0, err
+	}
+	switch mode {
+	case CostRoundingHalfUp:
+		return math.Round(scaled) / scale, nil
+	case CostRoundingHalfEven:
+		return math.RoundToEven(scaled) / scale, nil
+	case CostRoundingUp:
+		return math.Ceil(scaled) / scale, nil
+	case CostRoundingDown:
+		return math.Floor(scaled) / scale, nil
+	default:
+		return 0, fmt.Errorf("unknown cost rounding %v", mode)
+	}
+}
+
+// PriceTier applies its price to the storage of a user above FromGb, up to the FromGb of the next tier
+type PriceTier struct {
+	FromGb          float64 `json:"from_gb"`
+	PricePerGbMonth float64 `json:"price_per_gb_month"`
+}
+
+// PriceList is valid from ValidFrom until ValidUntil, or until a price list with a later ValidFrom starts
+type PriceList struct {
+	Id         int64       `json:"id"`
+	ValidFrom  time.Time   `json:"valid_from"`
+	ValidUntil *time.Time  `json:"valid_until"`
+	Tiers      []PriceTier `json:"tiers"`
+}
+
+// Cost is the monthly price of storing gb with tiered pricing
+func (p PriceList) Cost(gb float64) (cost float64) {
+	tiers := append([]PriceTier{}, p.Tiers...)
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].FromGb < tiers[j].FromGb
+	})
+	for i, tier := range tiers {
+		if gb <= tier.FromGb {
+			break
+		}
+		upper := gb
+		if i+1 < len(tiers) && tiers[i+1].FromGb < gb {
+			upper = tiers[i+1].FromGb
+		}
+		cost += (upper - tier.FromGb) * tier.PricePerGbMonth
+	}
+	return cost
+}
+
+// Discount scales the cost of a user, a factor of 0.9 grants 10% discount
+type Discount struct {
+	UserId    string    `json:"user_id"`
+	Factor    float64   `json:"factor"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// cagg_totals modes, whether continuous aggregates are billed with the tables of a user or only reported separately
+const (
+	CaggTotalsAdd      = "add"
+	CaggTotalsSeparate = "separate"
+)
+
+// CostEstimate prices Bytes. DerivedBytes is the part of continuous aggregates, included in Bytes only if DerivedIncluded.
+type CostEstimate struct {
+	UserId          string    `json:"user_id"`
+	Date            time.Time `json:"date"`
+	PriceListId     int64     `json:"price_list_id"`
+	Bytes           int64     `json:"bytes"`
+	DerivedBytes    int64     `json:"derived_bytes"`
+	DerivedIncluded bool      `json:"derived_included"`
+	Gb              float64   `json:"gb"`
+	DiscountFactor  float64   `json:"discount_factor"`
+	CostPerMonth    float64   `json:"cost_per_month"`
+	Currency        string    `json:"currency"`
+}
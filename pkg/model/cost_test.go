@@ -0,0 +1,87 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRoundCost(t *testing.T) {
+	tests := []struct {
+		cost      float64
+		precision int
+		mode      string
+		expected  float64
+	}{
+		{1.005, 2, CostRoundingHalfUp, 1.01},
+		{1.015, 2, CostRoundingHalfUp, 1.02},
+		{0.125, 2, CostRoundingHalfEven, 0.12},
+		{0.135, 2, CostRoundingHalfEven, 0.14},
+		{2.5, 0, CostRoundingHalfEven, 2},
+		{2.5, 0, CostRoundingHalfUp, 3},
+		{1.001, 2, CostRoundingUp, 1.01},
+		{1.1, 2, CostRoundingUp, 1.1},
+		{0.29, 2, CostRoundingDown, 0.29},
+		{1.009, 2, CostRoundingDown, 1.0},
+		{-1.001, 2, CostRoundingUp, -1.0},
+		{123.456, 0, CostRoundingDown, 123},
+		{123.456, -1, CostRoundingHalfUp, 120},
+	}
+	for _, test := range tests {
+		actual, err := RoundCost(test.cost, test.precision, test.mode)
+		if err != nil {
+			t.Error(test, err)
+			continue
+		}
+		if math.Abs(actual-test.expected) > 1e-9 {
+			t.Errorf("RoundCost(%v, %v, %v) = %v, expected %v", test.cost, test.precision, test.mode, actual, test.expected)
+		}
+	}
+	_, err := RoundCost(1, 2, "bankers")
+	if err == nil {
+		t.Error("expected error for unknown rounding")
+	}
+}
+
+func TestPriceListCost(t *testing.T) {
+	tiered := PriceList{Tiers: []PriceTier{{FromGb: 100, PricePerGbMonth: 0.5}, {FromGb: 0, PricePerGbMonth: 1}, {FromGb: 1000, PricePerGbMonth: 0.1}}}
+	tests := []struct {
+		name     string
+		list     PriceList
+		gb       float64
+		expected float64
+	}{
+		{"no tiers", PriceList{}, 50, 0},
+		{"nothing stored", tiered, 0, 0},
+		{"first tier", tiered, 50, 50},
+		{"first tier boundary", tiered, 100, 100},
+		{"second tier", tiered, 150, 100 + 25},
+		{"all tiers", tiered, 1500, 100 + 450 + 50},
+		{"free below first tier", PriceList{Tiers: []PriceTier{{FromGb: 10, PricePerGbMonth: 2}}}, 15, 10},
+		{"below first tier", PriceList{Tiers: []PriceTier{{FromGb: 10, PricePerGbMonth: 2}}}, 5, 0},
+	}
+	for _, test := range tests {
+		actual := test.list.Cost(test.gb)
+		if math.Abs(actual-test.expected) > 1e-9 {
+			t.Errorf("%v: Cost(%v) = %v, expected %v", test.name, test.gb, actual, test.expected)
+		}
+	}
+	if tiered.Tiers[0].FromGb != 100 {
+		t.Error("Cost sorted the tiers of the price list")
+	}
+}
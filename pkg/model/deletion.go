@@ -0,0 +1,40 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+const (
+	DeletionKindUser  = "user"
+	DeletionKindTable = "table"
+)
+
+// DeletionRequest names the data subject to purge, a user or a single table, e.g. of an export
+type DeletionRequest struct {
+	Kind    string `json:"kind"`
+	Subject string `json:"subject"`
+}
+
+// DeletionReport lists the tables the purge applied to and the number of rows deleted per usage table. Retained
+// names records of the subject kept on purpose, outside of the usage schema.
+type DeletionReport struct {
+	DeletionRequest
+	Tables    []string         `json:"tables"`
+	Deleted   map[string]int64 `json:"deleted"`
+	Retained  []string         `json:"retained"`
+	DeletedAt time.Time        `json:"deleted_at"`
+}
@@ -0,0 +1,30 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+// DeviceUsage is the estimated share of a device in a hypertable shared by many devices, assuming rows of the
+// average width
+type DeviceUsage struct {
+	Table          string    `json:"table"`
+	Device         string    `json:"device"`
+	Rows           int64     `json:"rows"`
+	AvgRowBytes    float64   `json:"avg_row_bytes"`
+	EstimatedBytes int64     `json:"estimated_bytes"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
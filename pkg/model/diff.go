@@ -0,0 +1,44 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+type Diff struct {
+	From   time.Time   `json:"from"`
+	To     time.Time   `json:"to"`
+	Tables []TableDiff `json:"tables"`
+	Users  []UserDiff  `json:"users"`
+}
+
+type TableDiff struct {
+	Table     string   `json:"table"`
+	UserId    string   `json:"user_id,omitempty"`
+	BytesFrom int64    `json:"bytes_from"`
+	BytesTo   int64    `json:"bytes_to"`
+	Delta     int64    `json:"delta"`
+	Created   bool     `json:"created"`
+	Deleted   bool     `json:"deleted"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+type UserDiff struct {
+	UserId    string `json:"user_id"`
+	BytesFrom int64  `json:"bytes_from"`
+	BytesTo   int64  `json:"bytes_to"`
+	Delta     int64  `json:"delta"`
+}
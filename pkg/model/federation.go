@@ -0,0 +1,47 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+// ClusterSummary is the summary of a remote instance, as fetched by the federation. Error is set if the last fetch
+// failed, Summary then is the last one fetched successfully. Stale clusters contribute an outdated or no summary.
+type ClusterSummary struct {
+	Cluster string `json:"cluster"`
+	Summary
+	FetchedAt time.Time `json:"fetched_at"`
+	Error     string    `json:"error,omitempty"`
+	Stale     bool      `json:"stale"`
+}
+
+// Federation combines the summaries of all clusters with their totals. The total is as old as its oldest cluster.
+type Federation struct {
+	Clusters []ClusterSummary `json:"clusters"`
+	Total    Summary          `json:"total"`
+	Stale    bool             `json:"stale"` // any cluster is stale
+}
+
+// ClusterUsage is the usage of a table of a remote instance, labeled with its cluster
+type ClusterUsage struct {
+	Cluster   string    `json:"cluster"`
+	Table     string    `json:"table"`
+	Bytes     int64     `json:"bytes"`
+	Owner     string    `json:"owner"`
+	Kind      string    `json:"kind"`
+	Tenant    string    `json:"tenant"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,33 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+type HistoryEntry struct {
+	Table        string    `json:"table" parquet:"table"`
+	Bytes        int64     `json:"bytes" parquet:"bytes"`
+	Time         time.Time `json:"time" parquet:"time"`
+	RunStartedAt time.Time `json:"run_started_at" parquet:"run_started_at"`
+}
+
+type BackfillResult struct {
+	Table     string    `json:"table"`
+	Snapshots int       `json:"snapshots"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+}
@@ -0,0 +1,55 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+// InvoiceLineItem bills the storage of a user in [PeriodStart, PeriodEnd). GbDays sums the stored gigabytes of every day,
+// UnitPrice is the resulting average price per GB-day. DerivedGbDays is the part of continuous aggregates, included in GbDays
+// only if DerivedIncluded.
+type InvoiceLineItem struct {
+	UserId          string    `json:"user_id"`
+	PeriodStart     time.Time `json:"period_start"`
+	PeriodEnd       time.Time `json:"period_end"`
+	GbDays          float64   `json:"gb_days"`
+	DerivedGbDays   float64   `json:"derived_gb_days"`
+	DerivedIncluded bool      `json:"derived_included"`
+	UnitPrice       float64   `json:"unit_price"`
+	DiscountFactor  float64   `json:"discount_factor"`
+	Total           float64   `json:"total"`
+	Currency        string    `json:"currency"`
+}
+
+// PriceListAt returns the price list valid at t, the latest started one if several are valid
+func PriceListAt(lists []PriceList, t time.Time) (p PriceList, ok bool) {
+	for _, list := range lists {
+		if list.ValidFrom.After(t) || (list.ValidUntil != nil && !list.ValidUntil.After(t)) {
+			continue
+		}
+		if !ok || list.ValidFrom.After(p.ValidFrom) {
+			p, ok = list, true
+		}
+	}
+	return p, ok
+}
+
+// InvoicePeriodOf returns the calendar month (UTC) containing t
+func InvoicePeriodOf(t time.Time) (start time.Time, end time.Time) {
+	t = t.UTC()
+	start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
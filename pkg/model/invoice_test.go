@@ -0,0 +1,75 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriceListAt(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	until := day(20)
+	lists := []PriceList{
+		{Id: 1, ValidFrom: day(1)},
+		{Id: 2, ValidFrom: day(10), ValidUntil: &until},
+		{Id: 3, ValidFrom: day(15)},
+	}
+	tests := []struct {
+		at       time.Time
+		expected int64
+		ok       bool
+	}{
+		{day(1).Add(-time.Second), 0, false},
+		{day(1), 1, true},
+		{day(12), 2, true},
+		{day(16), 3, true},
+		{day(20), 3, true},
+		{day(25), 3, true},
+	}
+	for _, test := range tests {
+		actual, ok := PriceListAt(lists, test.at)
+		if ok != test.ok || actual.Id != test.expected {
+			t.Errorf("PriceListAt(%v) = %v %v, expected %v %v", test.at, actual.Id, ok, test.expected, test.ok)
+		}
+	}
+	_, ok := PriceListAt([]PriceList{{Id: 1, ValidFrom: day(1), ValidUntil: &until}}, day(21))
+	if ok {
+		t.Error("expired price list returned")
+	}
+}
+
+func TestInvoicePeriodOf(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	tests := []struct {
+		at    time.Time
+		start time.Time
+		end   time.Time
+	}{
+		{time.Date(2024, 2, 15, 12, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC), time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 3, 1, 0, 30, 0, 0, berlin), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		start, end := InvoicePeriodOf(test.at)
+		if !start.Equal(test.start) || !end.Equal(test.end) {
+			t.Errorf("InvoicePeriodOf(%v) = %v - %v, expected %v - %v", test.at, start, end, test.start, test.end)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobKindDiff        = "diff"
+	JobKindUserSummary = "user_summary"
+)
+
+const (
+	JobStatePending = "pending"
+	JobStateRunning = "running"
+	JobStateDone    = "done"
+	JobStateFailed  = "failed"
+)
+
+type Job struct {
+	Id        int64           `json:"id"`
+	Kind      string          `json:"kind"`
+	State     string          `json:"state"`
+	Params    JobParams       `json:"params"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedBy string          `json:"created_by,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// JobParams select the time range of a report, dates are parsed with ParseDate
+type JobParams struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// UserSummary is the storage of a user within a month, summed over all tables of the user per run
+type UserSummary struct {
+	UserId   string    `json:"user_id"`
+	Month    time.Time `json:"month"`
+	AvgBytes float64   `json:"avg_bytes"`
+	MaxBytes int64     `json:"max_bytes"`
+}
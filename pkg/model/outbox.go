@@ -0,0 +1,57 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const OutboxDestinationAccounting = "accounting"
+
+// NotifierDestination is the outbox destination of a notifier channel. Each channel has its own entries, so a failing
+// channel is retried without sending the event to the others again.
+func NotifierDestination(channel string) string {
+	return "notifier:" + channel
+}
+
+// OutboxEntry is an event waiting for delivery. Entries are removed once delivered, failed attempts are retried
+// from NextAttemptAt on. The IdempotencyKey consists of the run id and the subject of the event, an event is put into
+// the outbox of a destination only once per key and is sent as Idempotency-Key header, so that consumers can drop
+// deliveries they have received before.
+type OutboxEntry struct {
+	Id             int64           `json:"id"`
+	Destination    string          `json:"destination"`
+	IdempotencyKey string          `json:"idempotency_key,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error,omitempty"`
+}
+
+// AccountingUsage is the usage of a user after a run, as pushed to the accounting service. DerivedBytes is the part
+// of continuous aggregates, included in Bytes only if DerivedIncluded, like in CostEstimate.
+type AccountingUsage struct {
+	RunId           int64     `json:"run_id"`
+	UserId          string    `json:"user_id"`
+	Bytes           int64     `json:"bytes"`
+	DerivedBytes    int64     `json:"derived_bytes"`
+	DerivedIncluded bool      `json:"derived_included"`
+	Tables          int64     `json:"tables"`
+	MeasuredAt      time.Time `json:"measured_at"`
+}
@@ -0,0 +1,32 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+// PartitionUsage is the size of the chunks of a hypertable in one space partition, i.e. the range of partition hashes
+// of Dimension from RangeStart to RangeEnd. Keys are values of Dimension in the newest chunk of the partition, at most
+// partition_keys_limit.
+type PartitionUsage struct {
+	Table      string    `json:"table"`
+	Dimension  string    `json:"dimension"`
+	RangeStart int64     `json:"range_start"`
+	RangeEnd   int64     `json:"range_end"`
+	Bytes      int64     `json:"bytes"`
+	Keys       []string  `json:"keys"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,69 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+const (
+	RetentionKindHistory    = "history"
+	RetentionKindAggregates = "aggregates"
+	RetentionKindAudit      = "audit"
+)
+
+var RetentionKinds = []string{RetentionKindHistory, RetentionKindAggregates, RetentionKindAudit}
+
+const (
+	RetentionSourceConfig = "config"
+	RetentionSourceApi    = "api"
+)
+
+// Retention is the interval after which records of a kind are purged, empty if they are kept forever
+type Retention struct {
+	Kind      string     `json:"kind"`
+	Interval  string     `json:"interval"`
+	Source    string     `json:"source"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// RetentionSimulation estimates the effect of dropping all chunks of a table older than an interval
+type RetentionSimulation struct {
+	Table          string    `json:"table"`
+	Interval       string    `json:"interval,omitempty"`
+	Cutoff         time.Time `json:"cutoff"`
+	Chunks         int64     `json:"chunks"`
+	Bytes          int64     `json:"bytes"`
+	RemainingBytes int64     `json:"remaining_bytes"`
+}
+
+// RetentionConfirmation has to be passed back to apply a drop, so that chunks are only dropped after the caller saw
+// the estimated effect
+type RetentionConfirmation struct {
+	RetentionSimulation
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RetentionRequest struct {
+	Before string `json:"before"`
+	Token  string `json:"token"`
+}
+
+type RetentionResult struct {
+	Table         string    `json:"table"`
+	Before        time.Time `json:"before"`
+	DroppedChunks []string  `json:"dropped_chunks"`
+}
@@ -0,0 +1,75 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// SeasonalModel holds the state of an additive Holt-Winters model with weekly seasonality fitted on daily sizes.
+// Seasonal is indexed by time.Weekday.
+type SeasonalModel struct {
+	Table    string     `json:"table"`
+	Alpha    float64    `json:"alpha"`
+	Beta     float64    `json:"beta"`
+	Gamma    float64    `json:"gamma"`
+	Level    float64    `json:"level"`
+	Trend    float64    `json:"trend"`
+	Seasonal [7]float64 `json:"seasonal"`
+	LastDay  time.Time  `json:"last_day"`
+}
+
+func (m SeasonalModel) Forecast(date time.Time) float64 {
+	h := math.Round(date.Sub(m.LastDay).Hours() / 24)
+	value := m.Level + h*m.Trend + m.Seasonal[date.UTC().Weekday()]
+	if value < 0 {
+		return 0
+	}
+	return value
+}
+
+// FitSeasonalModel fits the model on consecutive daily values, the last of which belongs to lastDay.
+// At least two full weeks are required.
+func FitSeasonalModel(daily []float64, lastDay time.Time, alpha float64, beta float64, gamma float64) (m SeasonalModel, ok bool) {
+	const season = 7
+	if len(daily) < 2*season {
+		return m, false
+	}
+	firstDay := lastDay.AddDate(0, 0, -(len(daily) - 1))
+	weekday := func(i int) time.Weekday {
+		return firstDay.AddDate(0, 0, i).UTC().Weekday()
+	}
+
+	var firstMean, secondMean float64
+	for i := 0; i < season; i++ {
+		firstMean += daily[i] / season
+		secondMean += daily[season+i] / season
+	}
+	m = SeasonalModel{Alpha: alpha, Beta: beta, Gamma: gamma, LastDay: lastDay, Level: firstMean, Trend: (secondMean - firstMean) / season}
+	for i := 0; i < season; i++ {
+		m.Seasonal[weekday(i)] = daily[i] - firstMean
+	}
+	for i := season; i < len(daily); i++ {
+		wd := weekday(i)
+		level := alpha*(daily[i]-m.Seasonal[wd]) + (1-alpha)*(m.Level+m.Trend)
+		m.Trend = beta*(level-m.Level) + (1-beta)*m.Trend
+		m.Seasonal[wd] = gamma*(daily[i]-level) + (1-gamma)*m.Seasonal[wd]
+		m.Level = level
+	}
+	return m, true
+}
@@ -0,0 +1,75 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFitSeasonalModel(t *testing.T) {
+	lastDay := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	weekly := func(days int, base float64, trend float64, amplitude float64) []float64 {
+		daily := make([]float64, days)
+		first := lastDay.AddDate(0, 0, -(days - 1))
+		for i := range daily {
+			daily[i] = base + trend*float64(i)
+			if first.AddDate(0, 0, i).Weekday() == time.Sunday {
+				daily[i] += amplitude
+			}
+		}
+		return daily
+	}
+	tests := []struct {
+		name     string
+		daily    []float64
+		ok       bool
+		date     time.Time
+		expected float64
+	}{
+		{"too short", weekly(13, 100, 0, 0), false, time.Time{}, 0},
+		{"constant", weekly(28, 100, 0, 0), true, lastDay.AddDate(0, 0, 10), 100},
+		{"linear", weekly(84, 100, 5, 0), true, lastDay.AddDate(0, 0, 7), 100 + 5*90},
+		{"weekly seasonality", weekly(56, 100, 0, 50), true, lastDay.AddDate(0, 0, 7), 150},
+		{"weekly seasonality off day", weekly(56, 100, 0, 50), true, lastDay.AddDate(0, 0, 8), 100},
+	}
+	for _, test := range tests {
+		m, ok := FitSeasonalModel(test.daily, lastDay, 0.5, 0.3, 0.3)
+		if ok != test.ok {
+			t.Errorf("%v: ok = %v, expected %v", test.name, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		actual := m.Forecast(test.date)
+		if math.Abs(actual-test.expected) > 0.05*test.expected {
+			t.Errorf("%v: Forecast(%v) = %v, expected %v", test.name, test.date.Format(time.DateOnly), actual, test.expected)
+		}
+	}
+}
+
+func TestSeasonalForecastNotNegative(t *testing.T) {
+	m := SeasonalModel{Level: 10, Trend: -5, LastDay: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if actual := m.Forecast(m.LastDay.AddDate(0, 0, 1)); actual != 5 {
+		t.Error("unexpected forecast", actual)
+	}
+	if actual := m.Forecast(m.LastDay.AddDate(0, 0, 10)); actual != 0 {
+		t.Error("shrinking forecast below 0", actual)
+	}
+}
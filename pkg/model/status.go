@@ -0,0 +1,51 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+const (
+	RunOutcomeSucceeded   = "succeeded"
+	RunOutcomeFailed      = "failed"
+	RunOutcomeInterrupted = "interrupted"
+)
+
+// Run is the outcome of a finished run of a worker shard
+type Run struct {
+	Id              int64     `json:"id"`
+	Shard           int       `json:"shard"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Outcome         string    `json:"outcome"`
+	Error           string    `json:"error,omitempty"`
+	TablesDone      int64     `json:"tables_done"`
+	TablesTotal     int64     `json:"tables_total"`
+}
+
+// RunStatus is the progress of the current or last run of a worker shard, shard 0 without sharding. TablesTotal grows while the run lists
+// hypertables, continuous aggregates, materialized views and tenants. Error is "run interrupted" for runs stopped by a shutdown.
+type RunStatus struct {
+	Shard        int        `json:"shard"`
+	RunStartedAt time.Time  `json:"run_started_at"`
+	TablesDone   int64      `json:"tables_done"`
+	TablesTotal  int64      `json:"tables_total"`
+	CurrentTable string     `json:"current_table"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	Error        string     `json:"error"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,67 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+const (
+	KindHypertable          = "hypertable"
+	KindContinuousAggregate = "continuous_aggregate"
+	KindMaterializedView    = "materialized_view"
+	KindTenant              = "tenant"
+	KindTable               = "table"       // plain table, tracked without TimescaleDB only
+	KindPartitioned         = "partitioned" // declaratively partitioned table, e.g. managed by pg_partman, with the size of all its partitions
+)
+
+type Usage struct {
+	Table         string     `json:"table"`
+	Bytes         int64      `json:"bytes"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	BytesPerDay   float64    `json:"bytes_per_day"`
+	GrowthR2      *float64   `json:"growth_r2"`
+	BytesLocal    *int64     `json:"bytes_local"`
+	BytesTiered   *int64     `json:"bytes_tiered"`
+	BytesSmoothed *float64   `json:"bytes_smoothed"`
+	Owner         string     `json:"owner"`
+	Kind          string     `json:"kind"`
+	Tenant        string     `json:"tenant"`
+	SourceTable   string     `json:"source_table,omitempty"` // hypertable of a continuous aggregate
+	SourceUser    string     `json:"source_user,omitempty"`  // user of SourceTable the aggregate is attributed to, see cagg_source_attribution
+	Method        string     `json:"method"`                 // how Bytes was measured: approximate, exact, sampled or cached
+	ErrorMargin   *float64   `json:"error_margin"`           // relative error of Bytes, null if unknown
+	ChunkCount    *int64     `json:"chunk_count"`
+	AvgChunkBytes *int64     `json:"avg_chunk_bytes"`
+	TinyChunks    bool       `json:"tiny_chunks"`
+	RowsPerDay    *float64   `json:"rows_per_day"`
+	DeadTuples    *int64     `json:"dead_tuples"`
+	LiveTuples    *int64     `json:"live_tuples"`
+	LastVacuum    *time.Time `json:"last_vacuum"`
+	Tags          []string   `json:"tags"`
+	LegalHold     bool       `json:"legal_hold"`
+}
+
+type UsageQuery struct {
+	Tables []string `json:"tables"`
+}
+
+type Forecast struct {
+	Table       string    `json:"table"`
+	Date        time.Time `json:"date"`
+	Method      string    `json:"method"`
+	Bytes       int64     `json:"bytes"`
+	BytesPerDay float64   `json:"bytes_per_day"`
+}
@@ -0,0 +1,46 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package model
+
+import "time"
+
+type Violation struct {
+	Id             int64      `json:"id"`
+	Kind           string     `json:"kind"`
+	Subject        string     `json:"subject"`
+	State          string     `json:"state"`
+	Bytes          int64      `json:"bytes"`
+	QuotaBytes     int64      `json:"quota_bytes"`
+	GraceUntil     *time.Time `json:"grace_until"`
+	ExceededAt     *time.Time `json:"exceeded_at"` // first time the quota was exceeded while the violation is open
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	OverrideUntil  *time.Time `json:"override_until"`
+	OverrideBy     string     `json:"override_by,omitempty"`
+}
+
+type ViolationAck struct {
+	Comment string `json:"comment"`
+}
+
+type ViolationOverride struct {
+	Until   time.Time `json:"until"`
+	Comment string    `json:"comment"`
+}
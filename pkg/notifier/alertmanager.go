@@ -0,0 +1,98 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+var alertNames = map[string]string{
+	EventKindThresholdExceeded: "TimescaleTableSizeThresholdExceeded",
+	EventKindRunFailed:         "TimescaleUsageRunFailed",
+	EventKindQuotaWarning:      "TimescaleUsageQuotaWarning",
+	EventKindQuotaGrace:        "TimescaleUsageQuotaExceeded",
+	EventKindQuotaEnforced:     "TimescaleUsageQuotaEnforced",
+}
+
+// quotaAlerts are the alerts of one quota subject, at most one of them is firing
+var quotaAlerts = []string{EventKindQuotaWarning, EventKindQuotaGrace, EventKindQuotaEnforced}
+
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+// alertmanager posts events to the v2 alerts API of a Prometheus Alertmanager,
+// leaving routing, grouping and silencing to the Alertmanager configuration.
+// Quota events end the other alerts of their subject, quota_resolved ends all of them. Open violations are repeated
+// on every run, so that their alert doesn't resolve after the resolve_timeout of the Alertmanager.
+type alertmanager struct {
+	client   *http.Client
+	template *template.Template
+	url      string
+}
+
+func (a *alertmanager) Notify(ctx context.Context, event Event) error {
+	text, err := render(a.template, event)
+	if err != nil {
+		return err
+	}
+	if event.Subject == "" {
+		return send(ctx, a.client, http.MethodPost, a.url+"/api/v2/alerts", nil, []alertmanagerAlert{a.alert(event.Kind, event, text)})
+	}
+	alerts := []alertmanagerAlert{}
+	for _, kind := range quotaAlerts {
+		alert := a.alert(kind, event, text)
+		if kind != event.Kind {
+			alert.EndsAt = &event.Time
+		}
+		alerts = append(alerts, alert)
+	}
+	return send(ctx, a.client, http.MethodPost, a.url+"/api/v2/alerts", nil, alerts)
+}
+
+func (a *alertmanager) alert(kind string, event Event, text string) alertmanagerAlert {
+	alertName, ok := alertNames[kind]
+	if !ok {
+		alertName = kind
+	}
+	labels := map[string]string{
+		"alertname": alertName,
+		"service":   "timescale-usage",
+		"severity":  "warning",
+	}
+	if event.Table != "" {
+		labels["table"] = event.Table
+	}
+	if event.Subject != "" {
+		labels["quota_kind"] = event.QuotaKind
+		labels["subject"] = event.Subject
+	}
+	if kind == EventKindRunFailed {
+		labels["severity"] = "critical"
+	}
+	return alertmanagerAlert{
+		Labels:      labels,
+		Annotations: map[string]string{"summary": text},
+		StartsAt:    event.Time,
+	}
+}
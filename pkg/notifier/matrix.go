@@ -0,0 +1,52 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+type matrix struct {
+	client      *http.Client
+	template    *template.Template
+	homeserver  string
+	roomId      string
+	accessToken string
+}
+
+func (m *matrix) Notify(ctx context.Context, event Event) error {
+	text, err := render(m.template, event)
+	if err != nil {
+		return err
+	}
+	endpoint := m.homeserver + "/_matrix/client/v3/rooms/" + url.PathEscape(m.roomId) + "/send/m.room.message/" + url.PathEscape(transactionId(event))
+	header := http.Header{"Authorization": []string{"Bearer " + m.accessToken}}
+	return send(ctx, m.client, http.MethodPut, endpoint, header, map[string]string{"msgtype": "m.text", "body": text})
+}
+
+// transactionId is stable per run and subject, so that matrix drops retried deliveries of an event it already received
+func transactionId(event Event) string {
+	if event.RunId == 0 {
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return "timescale-usage-" + strconv.FormatInt(event.RunId, 10) + "-" + event.IdempotencyKey()
+}
@@ -0,0 +1,179 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+)
+
+const (
+	EventKindThresholdExceeded = "threshold_exceeded"
+	EventKindRunFailed         = "run_failed"
+	EventKindQuotaWarning      = "quota_warning"
+	EventKindQuotaGrace        = "quota_grace"
+	EventKindQuotaEnforced     = "quota_enforced"
+	EventKindQuotaResolved     = "quota_resolved"
+)
+
+// Event is emitted at most once per run and subject. Consumers receiving events through the outbox should deduplicate
+// by run_id, kind and table or quota subject, since a delivery may be retried after the event was already received.
+type Event struct {
+	RunId     int64     `json:"run_id,omitempty"`
+	Kind      string    `json:"kind"`
+	Table     string    `json:"table,omitempty"`
+	Bytes     int64     `json:"bytes,omitempty"`
+	Threshold int64     `json:"threshold,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+
+	// set for quota events
+	QuotaKind  string    `json:"quota_kind,omitempty"`
+	Subject    string    `json:"subject,omitempty"`
+	GraceUntil time.Time `json:"grace_until"`
+	// Repeat is set on events of open violations whose state didn't change, only the alertmanager receives them
+	Repeat bool `json:"repeat,omitempty"`
+}
+
+// ReceivesRepeats reports whether the channel is sent repeated events
+func ReceivesRepeats(channel string) bool {
+	return channel == "alertmanager"
+}
+
+// IdempotencyKey identifies the event within its run
+func (e Event) IdempotencyKey() string {
+	switch {
+	case e.Table != "":
+		return e.Kind + "/" + e.Table
+	case e.Subject != "":
+		return e.Kind + "/" + e.QuotaKind + "/" + e.Subject
+	default:
+		return e.Kind
+	}
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+const DefaultTemplate = `{{if eq .Kind "run_failed"}}timescale-usage run failed: {{.Error}}
+{{- else if eq .Kind "quota_warning"}}{{.QuotaKind}} {{.Subject}} uses {{.Bytes}} bytes, approaching the quota of {{.Threshold}} bytes
+{{- else if eq .Kind "quota_grace"}}{{.QuotaKind}} {{.Subject}} uses {{.Bytes}} bytes, exceeding the quota of {{.Threshold}} bytes, grace period ends {{.GraceUntil.Format "2006-01-02 15:04 MST"}}
+{{- else if eq .Kind "quota_enforced"}}{{.QuotaKind}} {{.Subject}} uses {{.Bytes}} bytes, exceeding the quota of {{.Threshold}} bytes after the grace period, enforcing
+{{- else if eq .Kind "quota_resolved"}}{{.QuotaKind}} {{.Subject}} uses {{.Bytes}} bytes, quota violation resolved
+{{- else}}table {{.Table}} uses {{.Bytes}} bytes, exceeding the threshold of {{.Threshold}} bytes{{end}}`
+
+// New creates a notifier sending to all channels listed in config.Notifiers.
+func New(config configuration.Config) (Notifier, error) {
+	channels, err := NewChannels(config)
+	if err != nil {
+		return nil, err
+	}
+	multi := &multiNotifier{}
+	for _, name := range config.Notifiers {
+		multi.notifiers = append(multi.notifiers, channels[name])
+	}
+	return multi, nil
+}
+
+// NewChannels creates the notifiers listed in config.Notifiers by name.
+func NewChannels(config configuration.Config) (map[string]Notifier, error) {
+	tmplStr := config.NotificationTemplate
+	if tmplStr == "" {
+		tmplStr = DefaultTemplate
+	}
+	tmpl, err := template.New("notification").Parse(tmplStr)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	channels := map[string]Notifier{}
+	for _, name := range config.Notifiers {
+		switch name {
+		case "slack":
+			channels[name] = &slack{client: client, template: tmpl, url: config.SlackWebhookUrl}
+		case "teams":
+			channels[name] = &teams{client: client, template: tmpl, url: config.TeamsWebhookUrl}
+		case "matrix":
+			channels[name] = &matrix{client: client, template: tmpl, homeserver: strings.TrimSuffix(config.MatrixHomeserverUrl, "/"), roomId: config.MatrixRoomId, accessToken: config.MatrixAccessToken}
+		case "alertmanager":
+			channels[name] = &alertmanager{client: client, template: tmpl, url: strings.TrimSuffix(config.AlertmanagerUrl, "/")}
+		default:
+			return nil, fmt.Errorf("unknown notifier %v", name)
+		}
+	}
+	return channels, nil
+}
+
+type multiNotifier struct {
+	notifiers []Notifier
+}
+
+func (m *multiNotifier) Notify(ctx context.Context, event Event) error {
+	errs := []error{}
+	for _, n := range m.notifiers {
+		if _, ok := n.(*alertmanager); event.Repeat && !ok {
+			continue
+		}
+		err := n.Notify(ctx, event)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func render(tmpl *template.Template, event Event) (string, error) {
+	buf := &bytes.Buffer{}
+	err := tmpl.Execute(buf, event)
+	return buf.String(), err
+}
+
+func send(ctx context.Context, client *http.Client, method string, url string, header http.Header, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response %v: %v", resp.StatusCode, string(msg))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"text/template"
+)
+
+type teams struct {
+	client   *http.Client
+	template *template.Template
+	url      string
+}
+
+func (t *teams) Notify(ctx context.Context, event Event) error {
+	text, err := render(t.template, event)
+	if err != nil {
+		return err
+	}
+	return send(ctx, t.client, http.MethodPost, t.url, nil, map[string]string{"text": text})
+}
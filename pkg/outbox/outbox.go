@@ -0,0 +1,177 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/accounting"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/notifier"
+)
+
+const maxBackoff = 24 * time.Hour
+
+// entries are claimed in small batches, each with a lease long enough to deliver all of them
+const (
+	claimBatchSize = 10
+	claimLease     = 10 * time.Minute
+)
+
+// Deliverer sends the entries of one outbox destination
+type Deliverer interface {
+	Deliver(ctx context.Context, entry model.OutboxEntry) error
+}
+
+// NewDeliverers creates a deliverer for every configured destination: the accounting service and each notifier channel.
+func NewDeliverers(config configuration.Config) (map[string]Deliverer, error) {
+	deliverers := map[string]Deliverer{}
+	if config.AccountingUrl != "" {
+		client, err := accounting.New(config)
+		if err != nil {
+			return nil, err
+		}
+		deliverers[model.OutboxDestinationAccounting] = client
+	}
+	channels, err := notifier.NewChannels(config)
+	if err != nil {
+		return nil, err
+	}
+	for name, n := range channels {
+		deliverers[model.NotifierDestination(name)] = &notification{notifier: n}
+	}
+	return deliverers, nil
+}
+
+type Relay struct {
+	db         *database.DB
+	deliverers map[string]Deliverer
+	backoff    time.Duration
+}
+
+// Start delivers the events the worker puts into usage_outbox. Entries stay in the outbox until delivered, failed
+// deliveries are retried with doubling backoff, so an unreachable destination neither loses events nor blocks the worker.
+func Start(ctx context.Context, wg *sync.WaitGroup, config configuration.Config) error {
+	backoff, err := time.ParseDuration(config.OutboxRetryBackoff)
+	if err != nil {
+		return err
+	}
+	deliverers, err := NewDeliverers(config)
+	if err != nil {
+		return err
+	}
+	if len(deliverers) == 0 {
+		return nil
+	}
+	db, err := database.New(config, "outbox")
+	if err != nil {
+		return err
+	}
+	r := &Relay{db: db, deliverers: deliverers, backoff: backoff}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer db.Close()
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			err := r.relay(ctx)
+			if err != nil {
+				log.Println("ERROR: outbox", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Relay) relay(ctx context.Context) error {
+	destinations := []string{}
+	for destination := range r.deliverers {
+		destinations = append(destinations, destination)
+	}
+	sort.Strings(destinations)
+	errs := []error{}
+	for _, destination := range destinations {
+		err := r.relayDestination(ctx, destination, r.deliverers[destination])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", destination, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// relayDestination delivers all due entries of the destination in batches, a failed entry doesn't hold back the others
+func (r *Relay) relayDestination(ctx context.Context, destination string, deliverer Deliverer) error {
+	for ctx.Err() == nil {
+		entries, err := r.db.ClaimOutboxEntries(destination, claimBatchSize, claimLease)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		for _, entry := range entries {
+			err = deliverer.Deliver(ctx, entry)
+			if err != nil {
+				log.Println("WARNING: delivery attempt", entry.Attempts+1, "of outbox entry", entry.Id, "to", destination, "failed", err)
+				err = r.db.FailOutboxEntry(entry.Id, err, time.Now().Add(r.nextBackoff(entry.Attempts)))
+			} else {
+				err = r.db.DeleteOutboxEntry(entry.Id)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Relay) nextBackoff(attempts int) time.Duration {
+	backoff := r.backoff
+	for i := 0; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+type notification struct {
+	notifier notifier.Notifier
+}
+
+func (n *notification) Deliver(ctx context.Context, entry model.OutboxEntry) error {
+	event := notifier.Event{}
+	err := json.Unmarshal(entry.Payload, &event)
+	if err != nil {
+		return err
+	}
+	return n.notifier.Notify(ctx, event)
+}
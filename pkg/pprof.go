@@ -0,0 +1,45 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package pkg
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+)
+
+// handlePprof serves the profiles of net/http/pprof below /debug/pprof/. With a token, requests have to
+// authenticate with "Authorization: Bearer <token>".
+func handlePprof(mux *http.ServeMux, token string) {
+	gate := func(next http.HandlerFunc) http.HandlerFunc {
+		if token == "" {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("/debug/pprof/", gate(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", gate(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", gate(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", gate(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", gate(pprof.Trace))
+}
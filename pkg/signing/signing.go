@@ -0,0 +1,163 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+)
+
+// Header carries the detached JWS of a response body
+const Header = "X-Jws-Signature"
+
+// Signer creates JWS (RFC 7515) of exported documents with the key in signing_key_file.
+// A nil Signer signs nothing, so callers can use it unconditionally.
+type Signer struct {
+	key       crypto.Signer
+	keyId     string
+	algorithm string
+}
+
+// New loads the PEM encoded RSA (RS256), P-256 ECDSA (ES256) or Ed25519 (EdDSA) private key of signing_key_file.
+// Returns nil without signing_key_file.
+func New(config configuration.Config) (*Signer, error) {
+	if config.SigningKeyFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(config.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("signing key file contains no pem block")
+	}
+	var key interface{}
+	key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.New("unable to parse signing key")
+	}
+	s := &Signer{keyId: config.SigningKeyId}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s.key, s.algorithm = k, "RS256"
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ecdsa signing keys are supported")
+		}
+		s.key, s.algorithm = k, "ES256"
+	case ed25519.PrivateKey:
+		s.key, s.algorithm = k, "EdDSA"
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+	return s, nil
+}
+
+// Sign returns the compact serialization of a JWS over payload
+func (s *Signer) Sign(payload []byte) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": s.algorithm, "kid": s.keyId})
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := s.signature([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// SignDetached returns a JWS over payload without the payload (RFC 7515 Appendix F),
+// to be sent alongside the unmodified document. Returns "" for a nil Signer.
+func (s *Signer) SignDetached(payload []byte) (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	jws, err := s.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(jws, ".")
+	return parts[0] + ".." + parts[2], nil
+}
+
+func (s *Signer) signature(input []byte) ([]byte, error) {
+	switch k := s.key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, input), nil
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(input)
+		r, sig, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		result := make([]byte, 64)
+		r.FillBytes(result[:32])
+		sig.FillBytes(result[32:])
+		return result, nil
+	default:
+		digest := sha256.Sum256(input)
+		return s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+}
+
+// Jwks returns the public key as JSON Web Key Set, allowing consumers to verify signatures
+func (s *Signer) Jwks() map[string]interface{} {
+	jwk := map[string]interface{}{"kid": s.keyId, "alg": s.algorithm, "use": "sig"}
+	switch k := s.key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		jwk["kty"] = "EC"
+		jwk["crv"] = "P-256"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(x)
+		jwk["y"] = base64.RawURLEncoding.EncodeToString(y)
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(k)
+	}
+	return map[string]interface{}{"keys": []interface{}{jwk}}
+}
@@ -0,0 +1,76 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// usage of a user is the sum of all tables mapped to the user, or owned by the role of the same name if unmapped.
+// Tenants are totals of tables counted on their own already. Continuous aggregates are summed separately too.
+const accountingUsageQuery = `SELECT coalesce(m.user_id, u.source_user, u.owner) AS user_id, sum(u.bytes)::bigint,
+coalesce(sum(u.bytes) FILTER (WHERE u.kind = '` + model.KindContinuousAggregate + `'), 0)::bigint, count(*)
+FROM %[1]v.usage u LEFT JOIN %[1]v.usage_mapping m ON m."table" = u."table"
+WHERE coalesce(m.user_id, u.source_user, u.owner) IS NOT NULL AND u.kind IS DISTINCT FROM '` + model.KindTenant + `' GROUP BY 1 ORDER BY 1;`
+
+// enqueueAccounting puts the usage of every user into the outbox, all in one transaction, so that the accounting
+// service receives either all users of a run or none.
+func (w *Worker) enqueueAccounting(ctx context.Context) error {
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf(accountingUsageQuery, w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	usages := []model.AccountingUsage{}
+	for rows.Next() {
+		u := model.AccountingUsage{RunId: w.runId, MeasuredAt: w.runStartedAt, DerivedIncluded: w.derivedIncluded()}
+		err = rows.Scan(&u.UserId, &u.Bytes, &u.DerivedBytes, &u.Tables)
+		if err != nil {
+			return err
+		}
+		if !u.DerivedIncluded {
+			u.Bytes -= u.DerivedBytes
+		}
+		usages = append(usages, u)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	rows.Close()
+
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, u := range usages {
+		payload, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_outbox (destination, payload, created_at, next_attempt_at, idempotency_key) VALUES ($1, $2, now(), now(), $3) ON CONFLICT DO NOTHING;", w.config.PostgresUsageSchema), nil, model.OutboxDestinationAccounting, payload, outboxKey(w.runId, "usage/"+u.UserId))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,93 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// keptTables lists the tables annotated to be skipped by automatic enforcement
+func (w *Worker) keptTables(ctx context.Context) (tables map[string]bool, err error) {
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT DISTINCT \"table\" FROM %v.usage_annotations WHERE $1 = ANY(tags);", w.config.PostgresUsageSchema), nil, model.AnnotationTagKeep)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables = map[string]bool{}
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables[table] = true
+	}
+	return tables, rows.Err()
+}
+
+// legalHolds lists the tables under legal hold
+func (w *Worker) legalHolds(ctx context.Context) (tables map[string]bool, err error) {
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT \"table\" FROM %v.usage_legal_holds;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables = map[string]bool{}
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables[table] = true
+	}
+	return tables, rows.Err()
+}
+
+// withoutProtected removes kept tables and tables under legal hold from the tables an action would be applied to.
+// Attempts on tables under legal hold are recorded as failed actions.
+func (w *Worker) withoutProtected(ctx context.Context, tables []string, action string, details string) ([]string, error) {
+	kept, err := w.keptTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	held, err := w.legalHolds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, table := range tables {
+		if held[table] {
+			err = w.recordAction(ctx, table, action, details, database.ErrLegalHold)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if kept[table] {
+			log.Println("Skipped action", action, "on", w.logName(table), "annotated with", model.AnnotationTagKeep)
+			continue
+		}
+		result = append(result, table)
+	}
+	return result, nil
+}
@@ -0,0 +1,196 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/notifier"
+	"github.com/jackc/pgx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// generated tables are named with this prefix, so that Generate can drop them again
+const benchmarkTablePrefix = "bench_"
+
+// benchmarkTablePattern matches the generated tables only, _ would match any character otherwise
+const benchmarkTablePattern = "bench\\_%"
+
+// benchmarkConfig points config at the benchmark_schema, whose tables are measured into a usage schema of their own,
+// and turns off everything reaching beyond the benchmark: notifications, accounting, quota enforcement and changes to
+// the source tables. The benchmark_schema must not be one of the schemas in use.
+func benchmarkConfig(config configuration.Config) (configuration.Config, error) {
+	if config.BenchmarkSchema == "" || config.BenchmarkSchema == config.PostgresSourceSchema || config.BenchmarkSchema == config.PostgresUsageSchema {
+		return nil, errors.New("benchmark_schema must be set and differ from postgres_source_schema and postgres_usage_schema")
+	}
+	c := *config
+	c.PostgresSourceSchema = config.BenchmarkSchema
+	c.PostgresUsageSchema = config.BenchmarkSchema + "_usage"
+	c.Notifiers = nil
+	c.ThresholdBytes = 0
+	c.AccountingUrl = ""
+	c.QuotaEnforcement = ""
+	c.CompressionEnforce = false
+	c.ChunkIntervalEnforce = false
+	c.TenantSchemaPattern = ""
+	c.MaterializedViews = false
+	c.PartitionedTables = false
+	c.ShardCount = 0
+	return &c, nil
+}
+
+// Generate creates hypertables of daily chunks with rowsPerChunk rows each in the benchmark_schema, as synthetic data
+// for Benchmark. Previously generated tables are dropped first, with tables = 0 they are only dropped.
+func Generate(ctx context.Context, config configuration.Config, tables int, chunks int, rowsPerChunk int) error {
+	config, err := benchmarkConfig(config)
+	if err != nil {
+		return err
+	}
+	conn, err := database.Connect(config, "generate")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecEx(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{config.PostgresSourceSchema}.Sanitize()+";", nil)
+	if err != nil {
+		return err
+	}
+	rows, err := conn.QueryEx(ctx, "SELECT tablename FROM pg_tables WHERE schemaname = $1 AND tablename LIKE $2;", nil, config.PostgresSourceSchema, benchmarkTablePattern)
+	if err != nil {
+		return err
+	}
+	existing := []string{}
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		existing = append(existing, table)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	for _, table := range existing {
+		_, err = conn.ExecEx(ctx, "DROP TABLE "+pgx.Identifier{config.PostgresSourceSchema, table}.Sanitize()+";", nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < tables; i++ {
+		name := pgx.Identifier{config.PostgresSourceSchema, fmt.Sprintf("%v%05d", benchmarkTablePrefix, i)}.Sanitize()
+		_, err = conn.ExecEx(ctx, "CREATE TABLE "+name+" (time timestamptz NOT NULL, device text NOT NULL, value double precision);", nil)
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecEx(ctx, "SELECT create_hypertable($1::regclass, 'time', chunk_time_interval => interval '1 day');", nil, name)
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecEx(ctx, "INSERT INTO "+name+" SELECT date_trunc('day', now()) - (c || ' days')::interval + (r || ' seconds')::interval, 'device_' || (r % 10), random() FROM generate_series(0, $1 - 1) c, generate_series(0, $2 - 1) r;", nil, chunks, rowsPerChunk)
+		if err != nil {
+			return err
+		}
+		if (i+1)%100 == 0 {
+			log.Println("Generated", i+1, "of", tables, "tables")
+		}
+	}
+	return nil
+}
+
+// newBenchmarkWorker creates a worker measuring the benchmark_schema with benchmarkConfig. Its metrics are not
+// registered globally, so that several benchmark workers can be created in one process.
+func newBenchmarkWorker(ctx context.Context, config configuration.Config) (w *Worker, closeWorker func(), err error) {
+	config, err = benchmarkConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = validateSourceReadOnly(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := database.Connect(config, "bench")
+	if err != nil {
+		return nil, nil, err
+	}
+	source, err := database.ConnectSource(config, "bench")
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	closeWorker = func() {
+		source.Close()
+		conn.Close()
+	}
+	n, err := notifier.New(config)
+	if err != nil {
+		closeWorker()
+		return nil, nil, err
+	}
+	w = &Worker{conn: conn, source: source, config: config, metrics: newMetricsWith(config, prometheus.NewRegistry()), notifier: n, benchmark: true}
+	err = w.init(ctx)
+	if err != nil {
+		closeWorker()
+		return nil, nil, err
+	}
+	return w, closeWorker, nil
+}
+
+// Benchmark runs the collection runs times in a row on the tables generated by Generate and reports their durations
+func Benchmark(ctx context.Context, config configuration.Config, runs int) (report model.BenchmarkReport, err error) {
+	w, closeWorker, err := newBenchmarkWorker(ctx, config)
+	if err != nil {
+		return report, err
+	}
+	defer closeWorker()
+
+	report.RunSeconds = []float64{}
+	var total float64
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		err = w.run(ctx)
+		if err != nil {
+			return report, err
+		}
+		seconds := time.Since(start).Seconds()
+		report.RunSeconds = append(report.RunSeconds, seconds)
+		total += seconds
+		if i == 0 || seconds < report.MinSeconds {
+			report.MinSeconds = seconds
+		}
+		report.MaxSeconds = max(report.MaxSeconds, seconds)
+	}
+	report.Tables = w.tablesTotal
+	if runs > 0 {
+		report.AvgSeconds = total / float64(runs)
+	}
+	if report.AvgSeconds > 0 {
+		report.TablesPerSecond = float64(report.Tables) / report.AvgSeconds
+	}
+	return report, nil
+}
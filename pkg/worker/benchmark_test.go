@@ -0,0 +1,97 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// BenchmarkCollection measures collection runs against the database of the config file named by
+// TIMESCALE_USAGE_BENCH_CONFIG, e.g. go test ./pkg/worker -run ^$ -bench Collection. The generated tables are dropped
+// and created again in its benchmark_schema.
+func BenchmarkCollection(b *testing.B) {
+	location := os.Getenv("TIMESCALE_USAGE_BENCH_CONFIG")
+	if location == "" {
+		b.Skip("TIMESCALE_USAGE_BENCH_CONFIG not set")
+	}
+	config, err := configuration.Load(location)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	err = Generate(ctx, config, 100, 30, 100)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w, closeWorker, err := newBenchmarkWorker(ctx, config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer closeWorker()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err = w.run(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(w.tablesTotal)*float64(b.N)/b.Elapsed().Seconds(), "tables/s")
+}
+
+func BenchmarkSortTables(b *testing.B) {
+	tables := make([]hypertable, 10000)
+	kinds := []string{model.KindHypertable, model.KindContinuousAggregate, model.KindMaterializedView, model.KindTenant}
+	for i := range tables {
+		tables[len(tables)-1-i] = hypertable{kind: kinds[i%len(kinds)], schema: "public", table: fmt.Sprintf("table_%05d", i)}
+	}
+	shuffled := make([]hypertable, len(tables))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(shuffled, tables)
+		sortTables(shuffled)
+	}
+}
+
+func TestBenchmarkConfig(t *testing.T) {
+	config := &configuration.ConfigStruct{PostgresSourceSchema: "public", PostgresUsageSchema: "usage", BenchmarkSchema: "usage_benchmark", Notifiers: []string{"slack"}, QuotaEnforcement: writeBlockModeRevoke, AccountingUrl: "http://accounting"}
+	c, err := benchmarkConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.PostgresSourceSchema != "usage_benchmark" || c.PostgresUsageSchema != "usage_benchmark_usage" {
+		t.Error("unexpected schemas", c.PostgresSourceSchema, c.PostgresUsageSchema)
+	}
+	if len(c.Notifiers) > 0 || c.QuotaEnforcement != "" || c.AccountingUrl != "" {
+		t.Error("side effects not turned off")
+	}
+	if config.PostgresSourceSchema != "public" || len(config.Notifiers) != 1 {
+		t.Error("original config modified")
+	}
+	for _, schema := range []string{"", "public", "usage"} {
+		config.BenchmarkSchema = schema
+		_, err = benchmarkConfig(config)
+		if err == nil {
+			t.Error("expected error for benchmark_schema", schema)
+		}
+	}
+}
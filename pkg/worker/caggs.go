@@ -0,0 +1,47 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// attributeToSource attributes a continuous aggregate to the user of its hypertable, so that derived data counts
+// towards the totals of the user owning the raw data. Hypertables are processed before continuous aggregates,
+// a hypertable not measured (yet) leaves the aggregate attributed to its owner. The attributed user is kept apart from
+// the owner, which stays the owning role.
+func (w *Worker) attributeToSource(ctx context.Context, t hypertable, m *measurement) error {
+	if !w.config.CaggSourceAttribution || t.source == "" {
+		return nil
+	}
+	user := pgtype.Text{}
+	err := w.conn.QueryRowEx(ctx, fmt.Sprintf("SELECT coalesce(m.user_id, u.source_user, u.owner) FROM %[1]v.usage u LEFT JOIN %[1]v.usage_mapping m ON m.\"table\" = u.\"table\" WHERE u.\"table\" = $1;", w.config.PostgresUsageSchema), nil, t.source).Scan(&user)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Status == pgtype.Present {
+		m.user = user.String
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// Check validates the configuration and database setup without changing anything, checks depending on a failed
+// connection are skipped.
+func Check(ctx context.Context, config configuration.Config) (report model.CheckReport) {
+	report.Ok = true
+	report.Add("config", validateSourceReadOnly(config), "")
+
+	conn, err := database.Connect(config, "check")
+	report.Add("connection", err, "")
+	if err != nil {
+		return report
+	}
+	defer conn.Close()
+	source, err := database.ConnectSource(config, "check")
+	report.Add("source_connection", err, "")
+	if err != nil {
+		return report
+	}
+	defer source.Close()
+
+	w := &Worker{conn: conn, source: source, config: config}
+	description, err := w.selectDialect(ctx)
+	report.Add("dialect", err, description)
+	if err != nil {
+		return report
+	}
+	missing, err := w.missingPrivileges(ctx)
+	if err == nil && len(missing) > 0 {
+		err = errors.New("missing privileges: " + strings.Join(missing, " "))
+	}
+	report.Add("privileges", err, "")
+	report.Add("usage_schema_writable", w.checkWritable(ctx), "")
+	return report
+}
+
+// checkWritable creates a table in the usage schema within a transaction that is rolled back
+func (w *Worker) checkWritable(ctx context.Context) error {
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecEx(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %v;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecEx(ctx, fmt.Sprintf("CREATE TABLE %v.usage_check (id int);", w.config.PostgresUsageSchema), nil)
+	return err
+}
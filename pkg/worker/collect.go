@@ -0,0 +1,156 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// prefetchedUsage is a measurement of a hypertable together with the previous usage row, read for many tables at once
+// by prefetchUsage. Tables of a failed batch are not fetched.
+type prefetchedUsage struct {
+	fetched     bool
+	m           measurement
+	previous    previousUsage
+	renamedFrom pgtype.Text // usage row with the OID of the table under another name, see carryOverRename
+}
+
+// batchDialect is implemented by dialects able to measure many hypertables with one query
+type batchDialect interface {
+	sizeFunction() (function string, method string)
+}
+
+// collectQuery reads the size, chunk count and owner of each table from the snapshot
+const collectQuery = `SELECT t.i, %[1]v(c.oid), (SELECT count(*) FROM show_chunks(c.oid::regclass)), pg_get_userbyid(c.relowner)::text, c.oid::bigint
+FROM unnest($1::text[]) WITH ORDINALITY t(name, i)
+JOIN pg_class c ON c.oid = to_regclass(t.name);`
+
+// collectPreviousQuery reads the previous usage and size comparison of the measured tables. It runs on the usage
+// connection, the source role needs no grants on the usage schema. The batch is measured before any of its tables
+// is written, so the previous usage is the one of the last run.
+const collectPreviousQuery = `SELECT t.i, coalesce(u.bytes, 0), u.bytes_smoothed, abs(s.deviation), r."table"
+FROM unnest($1::text[], $2::bigint[]) WITH ORDINALITY t(name, relid, i)
+LEFT JOIN %[1]v.usage u ON u."table" = t.name
+LEFT JOIN %[1]v.usage_size_comparison s ON s."table" = t.name
+LEFT JOIN LATERAL (SELECT o."table" FROM %[1]v.usage o WHERE o.relid = t.relid AND o."table" <> t.name LIMIT 1) r ON true;`
+
+func (w *Worker) batched(t hypertable) bool {
+	_, ok := w.dialect.(batchDialect)
+	return ok && w.config.CollectionBatchSize > 0 && t.kind == model.KindHypertable && !w.sampled(t)
+}
+
+// prefetchUsage measures the next collection_batch_size hypertables of the shard with one query, unless they were
+// measured with an earlier batch already. Tables missing from the result, e.g. because they were dropped in the
+// meantime, and tables of a failed batch are measured on their own.
+func (w *Worker) prefetchUsage(ctx context.Context, tables []hypertable) error {
+	if !w.batched(tables[0]) {
+		return nil
+	}
+	if _, ok := w.prefetched[cursorKey(tables[0])]; ok {
+		return nil
+	}
+	batch := []hypertable{}
+	names := []string{}
+	for _, t := range tables {
+		if len(batch) >= w.config.CollectionBatchSize {
+			break
+		}
+		if w.inShard(t) && w.batched(t) {
+			batch = append(batch, t)
+			names = append(names, pgx.Identifier{t.schema, t.table}.Sanitize())
+		}
+	}
+	for _, t := range batch {
+		w.prefetched[cursorKey(t)] = prefetchedUsage{}
+	}
+	sizeFunction, method := w.dialect.(batchDialect).sizeFunction()
+	err := w.inSavepoint(ctx, func() error {
+		rows, err := w.snapshot.QueryEx(ctx, fmt.Sprintf(collectQuery, sizeFunction), nil, names)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var i int64
+			p := prefetchedUsage{fetched: true, m: measurement{method: method}}
+			err = rows.Scan(&i, &p.m.size, &p.m.chunks, &p.m.owner, &p.m.relid)
+			if err != nil {
+				return err
+			}
+			w.prefetched[cursorKey(batch[i-1])] = p
+		}
+		return rows.Err()
+	})
+	if err == nil {
+		err = w.prefetchPrevious(ctx, batch, method)
+	}
+	if err != nil {
+		for _, t := range batch {
+			w.prefetched[cursorKey(t)] = prefetchedUsage{}
+		}
+		if errIsLockTimeout(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// prefetchPrevious adds the previous usage and the size deviation to the measured tables of the batch
+func (w *Worker) prefetchPrevious(ctx context.Context, batch []hypertable, method string) error {
+	measured := []hypertable{}
+	names := []string{}
+	relids := []int64{}
+	for _, t := range batch {
+		if p := w.prefetched[cursorKey(t)]; p.fetched {
+			measured = append(measured, t)
+			names = append(names, t.table)
+			relids = append(relids, p.m.relid)
+		}
+	}
+	if len(measured) == 0 {
+		return nil
+	}
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf(collectPreviousQuery, w.config.PostgresUsageSchema), nil, names, relids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i int64
+		var deviation pgtype.Float8
+		var previous previousUsage
+		var renamedFrom pgtype.Text
+		err = rows.Scan(&i, &previous.bytes, &previous.smoothed, &deviation, &renamedFrom)
+		if err != nil {
+			return err
+		}
+		key := cursorKey(measured[i-1])
+		p := w.prefetched[key]
+		p.previous, p.renamedFrom, p.m.margin = previous, renamedFrom, deviation
+		if method == methodExact {
+			p.m.margin = pgtype.Float8{Float: 0, Status: pgtype.Present}
+		}
+		w.prefetched[key] = p
+	}
+	return rows.Err()
+}
@@ -0,0 +1,144 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+type columnSize struct {
+	column   string
+	avgBytes float64
+}
+
+// estimateColumnSizes splits the size of the column_sizes_tables biggest hypertables into the shares of their columns.
+// Experimental: the share is the average pg_column_size of the latest column_sizes_sample_rows rows, which neither
+// accounts for compression nor for older rows being shaped differently.
+func (w *Worker) estimateColumnSizes(ctx context.Context) error {
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT \"table\", bytes FROM %v.usage WHERE kind = $1 ORDER BY bytes DESC LIMIT $2;", w.config.PostgresUsageSchema), nil, model.KindHypertable, w.config.ColumnSizesTables)
+	if err != nil {
+		return err
+	}
+	sizes := map[string]int64{}
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		var bytes int64
+		err = rows.Scan(&table, &bytes)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		sizes[table] = bytes
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, table := range tables {
+		err = w.renewSnapshot(ctx)
+		if err != nil {
+			return err
+		}
+		var columns []columnSize
+		err = w.inSavepoint(ctx, func() (err error) {
+			columns, err = w.sampleColumnSizes(ctx, table)
+			return err
+		})
+		if err != nil {
+			log.Println("WARNING: unable to estimate column sizes of", w.logName(table), err)
+			continue
+		}
+		err = w.replaceColumnSizes(ctx, table, sizes[table], columns, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_column_sizes WHERE NOT (\"table\" = ANY($1));", w.config.PostgresUsageSchema), nil, tables)
+	return err
+}
+
+func (w *Worker) sampleColumnSizes(ctx context.Context, table string) (columns []columnSize, err error) {
+	rows, err := w.snapshot.QueryEx(ctx, "SELECT column_name FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 ORDER BY ordinal_position;", nil, w.config.PostgresSourceSchema, table)
+	if err != nil {
+		return nil, err
+	}
+	selects := []string{}
+	for rows.Next() {
+		c := columnSize{}
+		err = rows.Scan(&c.column)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		columns = append(columns, c)
+		selects = append(selects, "coalesce(avg(pg_column_size("+pgx.Identifier{c.column}.Sanitize()+")), 0)::DOUBLE PRECISION")
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(columns) == 0 {
+		return nil, err
+	}
+
+	identifier := pgx.Identifier{w.config.PostgresSourceSchema, table}.Sanitize()
+	dest := make([]interface{}, len(columns))
+	for i := range columns {
+		dest[i] = &columns[i].avgBytes
+	}
+	err = w.snapshot.QueryRowEx(ctx, "SELECT "+strings.Join(selects, ", ")+" FROM (SELECT * FROM "+identifier+" ORDER BY time DESC LIMIT $1) s;", nil, w.config.ColumnSizesSampleRows).Scan(dest...)
+	return columns, err
+}
+
+func (w *Worker) replaceColumnSizes(ctx context.Context, table string, tableBytes int64, columns []columnSize, now time.Time) error {
+	var rowBytes float64
+	for _, c := range columns {
+		rowBytes += c.avgBytes
+	}
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_column_sizes WHERE \"table\" = $1;", w.config.PostgresUsageSchema), nil, table)
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		share := pgtype.Float8{Status: pgtype.Null}
+		estimatedBytes := pgtype.Int8{Status: pgtype.Null}
+		if rowBytes > 0 {
+			share = pgtype.Float8{Float: c.avgBytes / rowBytes, Status: pgtype.Present}
+			estimatedBytes = pgtype.Int8{Int: int64(share.Float * float64(tableBytes)), Status: pgtype.Present}
+		}
+		_, err = tx.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_column_sizes (\"table\", \"column\", avg_bytes, share, estimated_bytes, updated_at) VALUES ($1, $2, $3, $4, $5, $6);", w.config.PostgresUsageSchema), nil, table, c.column, c.avgBytes, &share, &estimatedBytes, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
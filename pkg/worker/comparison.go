@@ -0,0 +1,67 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/pgtype"
+)
+
+// deviations above this ratio are logged
+const sizeComparisonLogRatio = 0.01
+
+// compareSizes measures a hypertable with the exact size function and the chunk ranges as well, so that deviations of
+// the billed approximate size and first date can be validated before switching methods.
+func (w *Worker) compareSizes(ctx context.Context, t hypertable, m measurement, now time.Time) error {
+	identifier := "\"" + t.schema + "\".\"" + t.table + "\""
+	var exactBytes pgtype.Int8
+	var chunkFirstDate pgtype.Timestamptz
+	err := w.inSavepoint(ctx, func() error {
+		err := w.snapshot.QueryRowEx(ctx, "SELECT hypertable_size($1::regclass);", nil, identifier).Scan(&exactBytes)
+		if err != nil {
+			return err
+		}
+		return w.snapshot.QueryRowEx(ctx, "SELECT min(range_start) FROM timescaledb_information.chunks WHERE hypertable_schema = $1 AND hypertable_name = $2;", nil, t.schema, t.table).Scan(&chunkFirstDate)
+	})
+	if err != nil {
+		return err
+	}
+
+	var approximateBytes int64 = 0
+	if m.size.Status == pgtype.Present {
+		approximateBytes = m.size.Int
+	}
+	deviation := pgtype.Float8{Status: pgtype.Null}
+	if exactBytes.Status == pgtype.Present && exactBytes.Int > 0 {
+		deviation = pgtype.Float8{Float: float64(approximateBytes-exactBytes.Int) / float64(exactBytes.Int), Status: pgtype.Present}
+		w.metrics.sizeDeviation.WithLabelValues(t.table).Set(deviation.Float)
+		if math.Abs(deviation.Float) > sizeComparisonLogRatio {
+			log.Printf("WARNING: approximate size of %v deviates by %.2f%% from exact size %v\n", w.logName(t.table), deviation.Float*100, exactBytes.Int)
+		}
+	}
+	firstDateDeviationDays := pgtype.Float8{Status: pgtype.Null}
+	if chunkFirstDate.Status == pgtype.Present {
+		firstDateDeviationDays = pgtype.Float8{Float: m.firstDate.Sub(chunkFirstDate.Time).Hours() / 24, Status: pgtype.Present}
+	}
+
+	_, err = w.conn.ExecEx(ctx, w.statement(stmtUpsertSizeComparison), nil, t.table, approximateBytes, &exactBytes, &deviation, m.firstDate, &chunkFirstDate, &firstDateDeviationDays, now)
+	return err
+}
@@ -0,0 +1,149 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+)
+
+var kindOrder = map[string]int{
+	model.KindHypertable:          0,
+	model.KindTable:               0,
+	model.KindPartitioned:         0,
+	model.KindContinuousAggregate: 1,
+	model.KindMaterializedView:    2,
+	model.KindTenant:              3,
+}
+
+// cursorKey orders tables the way a run processes them
+func cursorKey(t hypertable) string {
+	return fmt.Sprintf("%v/%v.%v", kindOrder[t.kind], t.schema, t.table)
+}
+
+func sortTables(tables []hypertable) {
+	sort.Slice(tables, func(i, j int) bool {
+		return cursorKey(tables[i]) < cursorKey(tables[j])
+	})
+}
+
+// startCursor loads the cursor of an aborted run, so that this run resumes after the last table processed by it.
+// With max_run_duration, the run stops processing tables when the duration is exceeded. Runs interrupted by a
+// shutdown are resumed the same way.
+func (w *Worker) startCursor(ctx context.Context) (err error) {
+	w.cursor, w.lastProcessed, w.aborted = "", "", false
+	w.cachedTables = []string{}
+	w.deadline = time.Time{}
+	if w.config.MaxRunDuration != "" {
+		d, err := time.ParseDuration(w.config.MaxRunDuration)
+		if err != nil {
+			return err
+		}
+		w.deadline = w.runStartedAt.Add(d)
+	}
+	err = w.loadPreviousSizes(ctx)
+	if err != nil {
+		return err
+	}
+	err = w.conn.QueryRowEx(ctx, fmt.Sprintf("SELECT cursor FROM %v.usage_run_cursor WHERE shard = $1;", w.config.PostgresUsageSchema), nil, w.shard).Scan(&w.cursor)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("Resuming after", w.logName(w.cursor))
+	return nil
+}
+
+// loadPreviousSizes reads the sizes of the last measurement, used for tables skipped by this run
+func (w *Worker) loadPreviousSizes(ctx context.Context) error {
+	w.previousSizes = map[string]int64{}
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT \"table\", bytes FROM %v.usage;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var bytes int64
+		err = rows.Scan(&table, &bytes)
+		if err != nil {
+			return err
+		}
+		w.previousSizes[table] = bytes
+	}
+	return rows.Err()
+}
+
+// skipTable reports whether t was processed by the aborted run being resumed, the run is out of time or interrupted
+func (w *Worker) skipTable(t hypertable) bool {
+	if w.cursor != "" && cursorKey(t) <= w.cursor {
+		return true
+	}
+	if w.stop != nil && w.stop.Err() != nil {
+		w.aborted = true
+		return true
+	}
+	if !w.deadline.IsZero() && time.Now().After(w.deadline) {
+		if !w.aborted {
+			log.Println("WARNING: max_run_duration exceeded, continuing with", w.logName(cursorKey(t)), "next run")
+			w.aborted = true
+		}
+		return true
+	}
+	return false
+}
+
+// keepTable keeps the usage of a skipped table until it is measured again
+func (w *Worker) keepTable(t hypertable) {
+	if t.kind == model.KindTenant {
+		return
+	}
+	w.cachedTables = append(w.cachedTables, t.table)
+	if size, ok := w.previousSizes[t.table]; ok {
+		w.listedSizes[t.table] = size
+	}
+}
+
+// markCached records that the usage of kept tables is from an earlier run
+func (w *Worker) markCached(ctx context.Context) error {
+	if len(w.cachedTables) == 0 {
+		return nil
+	}
+	_, err := w.conn.ExecEx(ctx, fmt.Sprintf("UPDATE %v.usage SET method = $2 WHERE \"table\" = ANY($1);", w.config.PostgresUsageSchema), nil, w.cachedTables, methodCached)
+	return err
+}
+
+// saveCursor persists the last processed table of an aborted run, or removes the cursor once all tables were processed
+func (w *Worker) saveCursor(ctx context.Context) (err error) {
+	if !w.aborted {
+		_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_run_cursor WHERE shard = $1;", w.config.PostgresUsageSchema), nil, w.shard)
+		return err
+	}
+	if w.lastProcessed == "" {
+		return nil
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_run_cursor (shard, cursor, updated_at) VALUES ($1, $2, now()) ON CONFLICT (shard) DO UPDATE SET cursor = $2, updated_at = now();", w.config.PostgresUsageSchema), nil, w.shard, w.lastProcessed)
+	return err
+}
@@ -0,0 +1,93 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// tableDates are the oldest and newest timestamp of a table, null if the table is empty. Tables of a failed batch are
+// not fetched.
+type tableDates struct {
+	fetched bool
+	first   pgtype.Timestamptz
+	last    pgtype.Timestamptz
+}
+
+func hasTimeColumn(t hypertable) bool {
+	return t.kind == model.KindHypertable || t.kind == model.KindContinuousAggregate
+}
+
+// prefetchDates reads the oldest and newest timestamps of the next date_batch_size tables of the shard with one query,
+// unless they were fetched with an earlier batch already. If the batch fails, e.g. because one of the tables was
+// dropped in the meantime, the tables fall back to their own queries in measureInSnapshot.
+func (w *Worker) prefetchDates(ctx context.Context, tables []hypertable) error {
+	if w.config.DateBatchSize <= 0 || !hasTimeColumn(tables[0]) {
+		return nil
+	}
+	if _, ok := w.dates[cursorKey(tables[0])]; ok {
+		return nil
+	}
+	batch := []hypertable{}
+	for _, t := range tables {
+		if len(batch) >= w.config.DateBatchSize {
+			break
+		}
+		if w.inShard(t) && hasTimeColumn(t) {
+			batch = append(batch, t)
+		}
+	}
+	// the time column is indexed per chunk, ORDER BY LIMIT 1 needs to look at the first and last chunk only
+	parts := []string{}
+	for i, t := range batch {
+		identifier := pgx.Identifier{t.schema, t.table}.Sanitize()
+		parts = append(parts, "SELECT "+strconv.Itoa(i)+", (SELECT time FROM "+identifier+" ORDER BY time ASC LIMIT 1), (SELECT time FROM "+identifier+" ORDER BY time DESC LIMIT 1)")
+	}
+	err := w.inSavepoint(ctx, func() error {
+		rows, err := w.snapshot.QueryEx(ctx, strings.Join(parts, " UNION ALL ")+";", nil)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var i int
+			dates := tableDates{fetched: true}
+			err = rows.Scan(&i, &dates.first, &dates.last)
+			if err != nil {
+				return err
+			}
+			w.dates[cursorKey(batch[i])] = dates
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		if errIsTableDoesNotExist(err) || errIsLockTimeout(err) {
+			for _, t := range batch {
+				w.dates[cursorKey(t)] = tableDates{}
+			}
+			return nil
+		}
+		return err
+	}
+	return nil
+}
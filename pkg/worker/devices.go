@@ -0,0 +1,136 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+)
+
+type deviceRows struct {
+	device string
+	rows   int64
+}
+
+// estimateDeviceUsage splits the size of the device_usage_tables biggest hypertables having a device_column into the
+// shares of the devices stored in them. Opt-in, since counting the rows per device reads the whole table. Every row
+// is assumed to be of the average width, the size of a table divided by its rows, so the estimates add up to the size
+// of the table.
+func (w *Worker) estimateDeviceUsage(ctx context.Context) error {
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT \"table\", bytes FROM %v.usage WHERE kind = $1 ORDER BY bytes DESC LIMIT $2;", w.config.PostgresUsageSchema), nil, model.KindHypertable, w.config.DeviceUsageTables)
+	if err != nil {
+		return err
+	}
+	sizes := map[string]int64{}
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		var bytes int64
+		err = rows.Scan(&table, &bytes)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		sizes[table] = bytes
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, table := range tables {
+		err = w.renewSnapshot(ctx)
+		if err != nil {
+			return err
+		}
+		var devices []deviceRows
+		err = w.inSavepoint(ctx, func() (err error) {
+			devices, err = w.countDeviceRows(ctx, table)
+			return err
+		})
+		if err != nil {
+			log.Println("WARNING: unable to estimate device usage of", w.logName(table), err)
+			continue
+		}
+		err = w.replaceDeviceUsage(ctx, table, sizes[table], devices, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_devices WHERE NOT (\"table\" = ANY($1));", w.config.PostgresUsageSchema), nil, tables)
+	return err
+}
+
+// countDeviceRows returns no devices if the table has no device_column
+func (w *Worker) countDeviceRows(ctx context.Context, table string) (devices []deviceRows, err error) {
+	var hasColumn bool
+	err = w.snapshot.QueryRowEx(ctx, "SELECT EXISTS (SELECT FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 AND column_name = $3);", nil, w.config.PostgresSourceSchema, table, w.config.DeviceColumn).Scan(&hasColumn)
+	if err != nil || !hasColumn {
+		return nil, err
+	}
+	identifier := pgx.Identifier{w.config.PostgresSourceSchema, table}.Sanitize()
+	column := pgx.Identifier{w.config.DeviceColumn}.Sanitize()
+	rows, err := w.snapshot.QueryEx(ctx, "SELECT "+column+"::text, count(*) FROM "+identifier+" WHERE "+column+" IS NOT NULL GROUP BY 1;", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := deviceRows{}
+		err = rows.Scan(&d.device, &d.rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+func (w *Worker) replaceDeviceUsage(ctx context.Context, table string, tableBytes int64, devices []deviceRows, now time.Time) error {
+	var totalRows int64
+	for _, d := range devices {
+		totalRows += d.rows
+	}
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_devices WHERE \"table\" = $1;", w.config.PostgresUsageSchema), nil, table)
+	if err != nil {
+		return err
+	}
+	avgRowBytes := 0.0
+	if totalRows > 0 {
+		avgRowBytes = float64(tableBytes) / float64(totalRows)
+	}
+	for _, d := range devices {
+		_, err = tx.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_devices (\"table\", device, rows, avg_row_bytes, estimated_bytes, updated_at) VALUES ($1, $2, $3, $4, $5, $6);", w.config.PostgresUsageSchema), nil, table, d.device, d.rows, avgRowBytes, int64(avgRowBytes*float64(d.rows)), now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,93 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/jackc/pgx"
+)
+
+// dialect abstracts the metadata queries of a storage backend. Another backend is supported by implementing dialect
+// and selecting it in selectDialect.
+type dialect interface {
+	// name is the value of the dialect config selecting the dialect
+	name() string
+	// list returns the tables and views measured by a run. Plain materialized views and tenants are listed by the worker.
+	list(ctx context.Context, snapshot *pgx.Tx, config configuration.Config) ([]hypertable, error)
+	// measureSize sets size, owner, relid, chunks, method and margin of m. With sampleChunks > 0, the size may be
+	// estimated from that many chunks.
+	measureSize(ctx context.Context, snapshot *pgx.Tx, t hypertable, sampleChunks int, m *measurement) error
+	// measureTenant sets size and owner of m to the total of a schema
+	measureTenant(ctx context.Context, snapshot *pgx.Tx, schema string, m *measurement) error
+	// informationViews are the views read by the dialect, checked by preflight
+	informationViews() []string
+	// unreadableTablesQuery lists the tables of the source schema $1 without SELECT privilege
+	unreadableTablesQuery() string
+	// timescale reports whether the analyses based on TimescaleDB are available: ingest rates, dead tuples,
+	// tablespaces, recommendations and compression enforcement
+	timescale() bool
+}
+
+const (
+	dialectTimescale = "timescaledb"
+	dialectPostgres  = "postgres"
+)
+
+var errTimescaleNotInstalled = errors.New("extension timescaledb is not installed")
+
+// selectDialect selects the dialect config, by default timescaledb if the extension is installed and postgres otherwise
+func (w *Worker) selectDialect(ctx context.Context) (description string, err error) {
+	switch w.config.Dialect {
+	case "", dialectTimescale:
+		version, err := w.timescaleVersion(ctx)
+		if errors.Is(err, errTimescaleNotInstalled) && w.config.Dialect == "" {
+			w.dialect = postgresDialect{}
+			return dialectPostgres + ", " + err.Error(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		d, err := newTimescaleDialect(version)
+		if err != nil {
+			return "", err
+		}
+		w.dialect = d
+		return dialectTimescale + " " + version, nil
+	case dialectPostgres:
+		w.dialect = postgresDialect{}
+		return dialectPostgres, nil
+	default:
+		return "", fmt.Errorf("unknown dialect %v", w.config.Dialect)
+	}
+}
+
+func (w *Worker) timescaleVersion(ctx context.Context) (version string, err error) {
+	err = w.source.QueryRowEx(ctx, "SELECT extversion FROM pg_extension WHERE extname = 'timescaledb';", nil).Scan(&version)
+	if err == pgx.ErrNoRows {
+		return "", errTimescaleNotInstalled
+	}
+	return version, err
+}
+
+// relationSize measures a relation with a size function taking its OID
+func relationSize(ctx context.Context, snapshot *pgx.Tx, sizeFunction string, t hypertable, m *measurement) error {
+	return snapshot.QueryRowEx(ctx, "SELECT "+sizeFunction+"(c.oid), pg_get_userbyid(c.relowner)::text, c.oid::bigint FROM pg_class c WHERE c.oid = $1::regclass;", nil, pgx.Identifier{t.schema, t.table}.Sanitize()).Scan(&m.size, &m.owner, &m.relid)
+}
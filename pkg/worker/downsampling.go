@@ -0,0 +1,93 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+const downsampleQuery = `INSERT INTO %[1]v.usage_history_daily AS d ("table", day, min_bytes, max_bytes, avg_bytes, samples, last_bytes, last_time, last_run_started_at)
+SELECT "table", date_trunc('day', time, 'UTC'), min(bytes), max(bytes), avg(bytes), count(*),
+(array_agg(bytes ORDER BY time DESC))[1], max(time), (array_agg(run_started_at ORDER BY time DESC))[1]
+FROM %[1]v.usage_history WHERE time < $1 GROUP BY 1, 2
+ON CONFLICT ("table", day) DO UPDATE SET
+min_bytes = least(d.min_bytes, EXCLUDED.min_bytes),
+max_bytes = greatest(d.max_bytes, EXCLUDED.max_bytes),
+avg_bytes = (d.avg_bytes * d.samples + EXCLUDED.avg_bytes * EXCLUDED.samples) / (d.samples + EXCLUDED.samples),
+samples = d.samples + EXCLUDED.samples,
+last_bytes = CASE WHEN EXCLUDED.last_time > d.last_time THEN EXCLUDED.last_bytes ELSE d.last_bytes END,
+last_run_started_at = CASE WHEN EXCLUDED.last_time > d.last_time THEN EXCLUDED.last_run_started_at ELSE d.last_run_started_at END,
+last_time = greatest(d.last_time, EXCLUDED.last_time);`
+
+// downsample compacts raw history of completed days older than history_downsample_after into daily aggregates. With
+// the parquet export, days are only compacted once exported, since the export reads the raw history.
+func (w *Worker) downsample(ctx context.Context) error {
+	if w.config.HistoryDownsampleAfter == "" {
+		return nil
+	}
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var cutoff time.Time
+	err = tx.QueryRowEx(ctx, "SELECT date_trunc('day', now() - $1::interval, 'UTC');", nil, w.config.HistoryDownsampleAfter).Scan(&cutoff)
+	if err != nil {
+		return err
+	}
+	if w.config.ParquetExportDuration != "" {
+		cutoff, err = w.exportedCutoff(ctx, tx, cutoff)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecEx(ctx, fmt.Sprintf(downsampleQuery, w.config.PostgresUsageSchema), nil, cutoff)
+	if err != nil {
+		return err
+	}
+	tag, err := tx.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_history WHERE time < $1;", w.config.PostgresUsageSchema), nil, cutoff)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		log.Printf("Downsampling: compacted %v history rows into daily aggregates\n", tag.RowsAffected())
+	}
+	return nil
+}
+
+// exportedCutoff moves the cutoff back to the first day not exported yet
+func (w *Worker) exportedCutoff(ctx context.Context, tx *pgx.Tx, cutoff time.Time) (time.Time, error) {
+	var unexported pgtype.Timestamptz
+	err := tx.QueryRowEx(ctx, fmt.Sprintf("SELECT min(date_trunc('day', time, 'UTC')) FROM %[1]v.usage_history WHERE time < $1 AND date_trunc('day', time, 'UTC') NOT IN (SELECT day FROM %[1]v.usage_exports);", w.config.PostgresUsageSchema), nil, cutoff).Scan(&unexported)
+	if err != nil {
+		return cutoff, err
+	}
+	if unexported.Status == pgtype.Present && unexported.Time.Before(cutoff) {
+		return unexported.Time, nil
+	}
+	return cutoff, nil
+}
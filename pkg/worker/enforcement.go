@@ -0,0 +1,111 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/pgtype"
+)
+
+const (
+	actionEnableCompression = "enable_compression"
+	actionSetChunkInterval  = "set_chunk_time_interval"
+)
+
+// recordAction writes an enforcement action to the audit table. actionErr is the error the action failed with, if any.
+func (w *Worker) recordAction(ctx context.Context, table string, action string, details string, actionErr error) error {
+	errText := pgtype.Text{Status: pgtype.Null}
+	if actionErr != nil {
+		errText = pgtype.Text{String: actionErr.Error(), Status: pgtype.Present}
+		log.Println("WARNING: action", action, "on", w.logName(table), "failed:", actionErr)
+	} else {
+		log.Println("Action", action, "on", w.logName(table)+":", details)
+	}
+	_, err := w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_actions (\"table\", action, details, error, created_at) VALUES ($1, $2, $3, $4, $5);", w.config.PostgresUsageSchema), nil, table, action, details, &errText, time.Now())
+	return err
+}
+
+func (w *Worker) enforceCompression(ctx context.Context) error {
+	pattern, err := regexp.Compile(w.config.CompressionEnforceTablePattern)
+	if err != nil {
+		return err
+	}
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT h.hypertable_name FROM timescaledb_information.hypertables h JOIN %v.usage u ON u.\"table\" = h.hypertable_name WHERE h.hypertable_schema = $1 AND NOT h.compression_enabled AND u.bytes >= $2;", w.config.PostgresUsageSchema), nil, w.config.PostgresSourceSchema, w.config.CompressionEnforceMinBytes)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return err
+		}
+		if pattern.MatchString(table) {
+			tables = append(tables, table)
+		}
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	tables, err = w.withoutProtected(ctx, tables, actionEnableCompression, "compress_after "+w.config.CompressionCompressAfter)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		err = w.recordAction(ctx, table, actionEnableCompression, "compress_after "+w.config.CompressionCompressAfter, w.enableCompression(ctx, table))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enableCompression enables compression and adds the policy in one transaction,
+// a table with compression enabled but no policy would never be selected again
+func (w *Worker) enableCompression(ctx context.Context, table string) error {
+	identifier := fmt.Sprintf("\"%v\".\"%v\"", w.config.PostgresSourceSchema, table)
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecEx(ctx, "ALTER TABLE "+identifier+" SET (timescaledb.compress);", nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecEx(ctx, "SELECT add_compression_policy($1::regclass, $2::interval, if_not_exists => true);", nil, identifier, w.config.CompressionCompressAfter)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setChunkInterval only affects chunks created in the future
+func (w *Worker) setChunkInterval(ctx context.Context, table string, interval time.Duration) error {
+	identifier := fmt.Sprintf("\"%v\".\"%v\"", w.config.PostgresSourceSchema, table)
+	_, err := w.conn.ExecEx(ctx, "SELECT set_chunk_time_interval($1::regclass, make_interval(secs => $2));", nil, identifier, interval.Seconds())
+	return err
+}
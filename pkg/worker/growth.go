@@ -0,0 +1,88 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/pgtype"
+)
+
+type growthModel struct {
+	bytesPerDay float64
+	r2          float64
+}
+
+// fitGrowth fits a line through the current and the last snapshots of a table. The current snapshot is passed, since
+// it is still buffered, see flushHistory. ok is false if there are not enough snapshots spread over time to fit a model.
+func (w *Worker) fitGrowth(ctx context.Context, table string, bytes int64, now time.Time) (model growthModel, ok bool, err error) {
+	if w.config.GrowthModelSnapshots < 2 {
+		return model, false, nil
+	}
+	rows, err := w.conn.QueryEx(ctx, w.statement(stmtGrowthSnapshots), nil, table, w.config.GrowthModelSnapshots-1)
+	if err != nil {
+		return model, false, err
+	}
+	defer rows.Close()
+	xs, ys := []float64{0}, []float64{float64(bytes)}
+	for rows.Next() {
+		var snapshotBytes int64
+		var t pgtype.Timestamptz
+		err = rows.Scan(&snapshotBytes, &t)
+		if err != nil {
+			return model, false, err
+		}
+		xs = append(xs, t.Time.Sub(now).Hours()/24)
+		ys = append(ys, float64(snapshotBytes))
+	}
+	if rows.Err() != nil {
+		return model, false, rows.Err()
+	}
+	slope, r2, ok := linearRegression(xs, ys)
+	return growthModel{bytesPerDay: slope, r2: r2}, ok, nil
+}
+
+// linearRegression computes the least-squares slope of ys over xs and the coefficient of determination.
+func linearRegression(xs []float64, ys []float64) (slope float64, r2 float64, ok bool) {
+	n := float64(len(xs))
+	if len(xs) < 2 || len(xs) != len(ys) {
+		return 0, 0, false
+	}
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var sxx, sxy, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return 0, 0, false
+	}
+	slope = sxy / sxx
+	if syy == 0 {
+		return slope, 1, true
+	}
+	r2 = (sxy * sxy) / (sxx * syy)
+	return slope, r2, true
+}
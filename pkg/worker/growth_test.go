@@ -0,0 +1,51 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLinearRegression(t *testing.T) {
+	tests := []struct {
+		name  string
+		xs    []float64
+		ys    []float64
+		slope float64
+		r2    float64
+		ok    bool
+	}{
+		{"too few points", []float64{1}, []float64{1}, 0, 0, false},
+		{"mismatched lengths", []float64{1, 2, 3}, []float64{1, 2}, 0, 0, false},
+		{"single day", []float64{1, 1, 1}, []float64{1, 2, 3}, 0, 0, false},
+		{"exact growth", []float64{0, 1, 2, 3}, []float64{10, 20, 30, 40}, 10, 1, true},
+		{"shrinking", []float64{0, 1, 2}, []float64{30, 20, 10}, -10, 1, true},
+		{"constant", []float64{0, 1, 2}, []float64{5, 5, 5}, 0, 1, true},
+		{"noisy", []float64{0, 1, 2, 3}, []float64{1, 3, 2, 4}, 0.8, 0.64, true},
+	}
+	for _, test := range tests {
+		slope, r2, ok := linearRegression(test.xs, test.ys)
+		if ok != test.ok {
+			t.Errorf("%v: ok = %v, expected %v", test.name, ok, test.ok)
+			continue
+		}
+		if math.Abs(slope-test.slope) > 1e-9 || math.Abs(r2-test.r2) > 1e-9 {
+			t.Errorf("%v: linearRegression = %v %v, expected %v %v", test.name, slope, r2, test.slope, test.r2)
+		}
+	}
+}
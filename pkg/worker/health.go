@@ -0,0 +1,60 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// checkHealth pings the database. If the ping fails, all pooled connections are reset, so that the next
+// queries establish new connections, e.g. after a restart or failover of Postgres.
+func (w *Worker) checkHealth(ctx context.Context) bool {
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := w.conn.ExecEx(pingCtx, "SELECT 1;", nil)
+	if err != nil {
+		log.Println("WARNING: database health check failed, resetting connections:", err)
+		w.metrics.connected.Set(0)
+		w.conn.Reset()
+		w.source.Reset()
+		return false
+	}
+	w.metrics.connected.Set(1)
+	return true
+}
+
+func (w *Worker) startHealthCheck(ctx context.Context) error {
+	d, err := time.ParseDuration(w.config.HealthCheckInterval)
+	if err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.checkHealth(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,54 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// buffered history rows are written with COPY once this many are collected, and at the end of each listing
+const historyFlushRows = 1000
+
+var historyColumns = []string{"table", "bytes", "time", "run_started_at"}
+
+// bufferHistory queues a usage_history row for flushHistory
+func (w *Worker) bufferHistory(table string, bytes int64, now time.Time) {
+	w.historyRows = append(w.historyRows, []interface{}{table, bytes, now, w.runStartedAt})
+}
+
+// flushHistory writes the buffered history rows with the COPY protocol, which is much cheaper than one INSERT per
+// table. Seasonal forecasts include the current snapshot, so they are updated after the rows are written.
+func (w *Worker) flushHistory(ctx context.Context) error {
+	if len(w.historyRows) > 0 {
+		_, err := w.conn.CopyFrom(pgx.Identifier{w.config.PostgresUsageSchema, "usage_history"}, historyColumns, pgx.CopyFromRows(w.historyRows))
+		if err != nil {
+			return err
+		}
+		w.historyRows = w.historyRows[:0]
+	}
+	for _, table := range w.forecastTables {
+		err := w.updateSeasonalForecast(ctx, table)
+		if err != nil {
+			return err
+		}
+	}
+	w.forecastTables = w.forecastTables[:0]
+	return nil
+}
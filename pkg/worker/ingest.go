@@ -0,0 +1,93 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// rows are inserted into the chunks, the counters of the hypertable itself only cover rows inserted before it was
+// converted
+const insertedRowsQuery = `SELECT h.hypertable_name,
+(coalesce(sum(s.n_tup_ins), 0) + coalesce((SELECT n_tup_ins FROM pg_stat_user_tables WHERE relid = format('%I.%I', h.hypertable_schema, h.hypertable_name)::regclass), 0))::bigint
+FROM timescaledb_information.hypertables h
+LEFT JOIN timescaledb_information.chunks c ON c.hypertable_schema = h.hypertable_schema AND c.hypertable_name = h.hypertable_name
+LEFT JOIN pg_stat_user_tables s ON s.relid = format('%I.%I', c.chunk_schema, c.chunk_name)::regclass
+WHERE h.hypertable_schema = $1
+GROUP BY h.hypertable_schema, h.hypertable_name;`
+
+// updateIngestRates derives the rows inserted per day from the delta of n_tup_ins between runs
+func (w *Worker) updateIngestRates(ctx context.Context) error {
+	log.Println("Ingest rates")
+	now := time.Now()
+	rows, err := w.snapshot.QueryEx(ctx, insertedRowsQuery, nil, w.config.PostgresSourceSchema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	inserted := map[string]int64{}
+	for rows.Next() {
+		var table string
+		var count int64
+		err = rows.Scan(&table, &count)
+		if err != nil {
+			return err
+		}
+		inserted[table] = count
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	for table, count := range inserted {
+		var previous pgtype.Int8
+		var previousAt pgtype.Timestamptz
+		err = w.conn.QueryRowEx(ctx, fmt.Sprintf("SELECT tup_ins, tup_ins_at FROM %v.usage WHERE \"table\" = $1;", w.config.PostgresUsageSchema), nil, table).Scan(&previous, &previousAt)
+		if err == pgx.ErrNoRows {
+			continue // not measured in this run
+		}
+		if err != nil {
+			return err
+		}
+		// counters shrink if chunks were dropped or statistics were reset, the rate is kept until the next run
+		if previous.Status != pgtype.Present || previousAt.Status != pgtype.Present || count < previous.Int {
+			_, err = w.conn.ExecEx(ctx, fmt.Sprintf("UPDATE %v.usage SET tup_ins = $2, tup_ins_at = $3 WHERE \"table\" = $1;", w.config.PostgresUsageSchema), nil, table, count, now)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		days := now.Sub(previousAt.Time).Hours() / 24
+		if days <= 0 {
+			continue
+		}
+		rowsPerDay := float64(count-previous.Int) / days
+		_, err = w.conn.ExecEx(ctx, fmt.Sprintf("UPDATE %v.usage SET tup_ins = $2, tup_ins_at = $3, rows_per_day = $4 WHERE \"table\" = $1;", w.config.PostgresUsageSchema), nil, table, count, now, rowsPerDay)
+		if err != nil {
+			return err
+		}
+		w.metrics.rowsPerDay.WithLabelValues(table).Set(rowsPerDay)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+)
+
+// trackLifecycle records when each listed table was first and last observed. Rows of dropped tables are kept,
+// their last_seen_at is the last run they existed in.
+func (w *Worker) trackLifecycle(ctx context.Context) error {
+	_, err := w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_lifecycle (\"table\", first_seen_at, last_seen_at) SELECT DISTINCT unnest($1::text[]), $2::timestamptz, $2::timestamptz ON CONFLICT (\"table\") DO UPDATE SET last_seen_at = $2;", w.config.PostgresUsageSchema), nil, w.listedTables, w.runStartedAt)
+	return err
+}
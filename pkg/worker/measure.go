@@ -0,0 +1,140 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+type measurement struct {
+	size      pgtype.Int8
+	firstDate time.Time
+	lastDate  time.Time // zero if the table is empty or has no time column
+	owner     string    // role owning the table, used for attribution if the table has no mapping
+	user      string    // user of the hypertable of a continuous aggregate, attributed before owner, see attributeToSource
+	chunks    int64
+	relid     int64 // OID of the table, identifying it across renames, 0 for tenants
+	method    string
+	margin    pgtype.Float8 // relative error of size, null if unknown
+}
+
+// methods of measuring the size of a table
+const (
+	methodApproximate = "approximate"
+	methodExact       = "exact"
+	methodSampled     = "sampled"
+	methodCached      = "cached" // kept from an earlier run, see keepTable
+)
+
+// measure reads size, owner, oldest and newest timestamp of a table from the snapshot. A savepoint protects the snapshot from being
+// aborted when the table has been dropped in the meantime or is locked longer than lock_timeout.
+func (w *Worker) measure(ctx context.Context, t hypertable, now time.Time) (m measurement, err error) {
+	err = w.inSavepoint(ctx, func() (err error) {
+		m, err = w.measureInSnapshot(ctx, t, now)
+		return err
+	})
+	return m, err
+}
+
+// inSavepoint runs f within a savepoint of the snapshot, which is rolled back if f fails
+func (w *Worker) inSavepoint(ctx context.Context, f func() error) error {
+	_, err := w.snapshot.ExecEx(ctx, "SAVEPOINT measure;", nil)
+	if err != nil {
+		return err
+	}
+	err = f()
+	if err != nil {
+		_, rollbackErr := w.snapshot.ExecEx(ctx, "ROLLBACK TO SAVEPOINT measure;", nil)
+		if rollbackErr != nil {
+			return rollbackErr
+		}
+		return err
+	}
+	_, err = w.snapshot.ExecEx(ctx, "RELEASE SAVEPOINT measure;", nil)
+	return err
+}
+
+// plain tables and materialized views are not chunked and don't necessarily have a time column
+func (w *Worker) measureInSnapshot(ctx context.Context, t hypertable, now time.Time) (m measurement, err error) {
+	m.firstDate = now
+	if t.kind == model.KindTenant {
+		err = w.dialect.measureTenant(ctx, w.snapshot, t.schema, &m)
+		return m, err
+	}
+	if t.kind == model.KindPartitioned {
+		err = measurePartitioned(ctx, w.snapshot, t, &m)
+		return m, err
+	}
+	sampleChunks := 0
+	if w.sampled(t) {
+		sampleChunks = w.config.SamplingChunks
+	}
+	if p := w.prefetched[cursorKey(t)]; p.fetched {
+		m.size, m.owner, m.chunks, m.relid, m.method, m.margin = p.m.size, p.m.owner, p.m.chunks, p.m.relid, p.m.method, p.m.margin
+	} else {
+		err = w.dialect.measureSize(ctx, w.snapshot, t, sampleChunks, &m)
+	}
+	if err != nil || t.kind == model.KindMaterializedView || t.kind == model.KindTable {
+		return m, err
+	}
+	dates := w.dates[cursorKey(t)]
+	delete(w.dates, cursorKey(t))
+	if dates.fetched {
+		if dates.first.Status == pgtype.Present {
+			m.firstDate = dates.first.Time
+		}
+		if dates.last.Status == pgtype.Present {
+			m.lastDate = dates.last.Time
+		}
+		return m, nil
+	}
+	identifier := "\"" + t.schema + "\".\"" + t.table + "\""
+	pgdate := pgtype.Timestamptz{}
+	err = w.snapshot.QueryRowEx(ctx, "SELECT time from "+identifier+" ORDER BY time ASC LIMIT 1;", nil).Scan(&pgdate)
+	if err == pgx.ErrNoRows {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	m.firstDate = pgdate.Get().(time.Time)
+	err = w.snapshot.QueryRowEx(ctx, "SELECT time from "+identifier+" ORDER BY time DESC LIMIT 1;", nil).Scan(&pgdate)
+	if err != nil {
+		return m, err
+	}
+	m.lastDate = pgdate.Get().(time.Time)
+	return m, nil
+}
+
+// sampled reports whether the size of t is estimated from sampled chunks, based on the size of the last run
+func (w *Worker) sampled(t hypertable) bool {
+	return t.kind == model.KindHypertable && w.config.SamplingMinBytes > 0 && w.config.SamplingChunks > 0 && w.previousSizes[t.table] >= w.config.SamplingMinBytes
+}
+
+// approximateMargin takes the deviation of the last size comparison as margin of approximately measured tables
+func (w *Worker) approximateMargin(ctx context.Context, table string) (margin pgtype.Float8, err error) {
+	err = w.conn.QueryRowEx(ctx, w.statement(stmtApproximateMargin), nil, table).Scan(&margin)
+	if err == pgx.ErrNoRows {
+		return pgtype.Float8{Status: pgtype.Null}, nil
+	}
+	return margin, err
+}
@@ -0,0 +1,262 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type metrics struct {
+	bytes           *prometheus.GaugeVec
+	info            *prometheus.GaugeVec
+	localBytes      *prometheus.GaugeVec
+	tieredBytes     *prometheus.GaugeVec
+	tablespaceBytes *prometheus.GaugeVec
+	forecast        *prometheus.GaugeVec
+	smoothedBytes   *prometheus.GaugeVec
+	chunks          *prometheus.GaugeVec
+	avgChunkBytes   *prometheus.GaugeVec
+	selfBytes       *prometheus.GaugeVec
+	tenantBytes     *prometheus.GaugeVec
+	sizeDeviation   *prometheus.GaugeVec
+	rowsPerDay      *prometheus.GaugeVec
+	deadTuples      *prometheus.GaugeVec
+	lastVacuum      *prometheus.GaugeVec
+	oldestData      *prometheus.GaugeVec
+	newestData      *prometheus.GaugeVec
+	untrackedBytes  prometheus.Gauge
+	connected       prometheus.Gauge
+	skippedRuns     prometheus.Counter
+	purgedRows      *prometheus.CounterVec
+	topK            *topKFilter
+	sizes           *sizeHistogram
+
+	quotaUsedRatio      *prometheus.GaugeVec
+	quotaRemainingBytes *prometheus.GaugeVec
+
+	queryCalls        *prometheus.GaugeVec
+	queryExecSeconds  *prometheus.GaugeVec
+	queryReadBytes    *prometheus.GaugeVec
+	queryWrittenBytes *prometheus.GaugeVec
+}
+
+// newMetrics registers all metrics, prefixed with metrics_namespace and carrying metrics_const_labels,
+// so that several workers can feed one Prometheus
+func newMetrics(config configuration.Config) *metrics {
+	return newMetricsWith(config, prometheus.DefaultRegisterer)
+}
+
+func newMetricsWith(config configuration.Config, registerer prometheus.Registerer) *metrics {
+	if config.MetricsNamespace != "" {
+		registerer = prometheus.WrapRegistererWithPrefix(config.MetricsNamespace+"_", registerer)
+	}
+	if len(config.MetricsConstLabels) > 0 {
+		registerer = prometheus.WrapRegistererWith(config.MetricsConstLabels, registerer)
+	}
+	factory := promauto.With(registerer)
+	sizes := newSizeHistogram()
+	registerer.MustRegister(sizes)
+	// per table metrics, limited to the largest tables with metrics_top_k
+	tables := factory
+	var topK *topKFilter
+	if config.MetricsTopK > 0 {
+		topK = &topKFilter{allowed: map[string]bool{}}
+		tables = promauto.With(topK)
+	}
+	m := &metrics{
+		sizes: sizes,
+		topK:  topK,
+
+		bytes:           tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_size_bytes", Help: "Table size in bytes"}, []string{"table"}),
+		info:            tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_info", Help: "Metadata of the table as labels, always 1"}, []string{"table", "schema", "kind", "owner", "export_id"}),
+		localBytes:      tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_local_size_bytes", Help: "Table size in bytes stored locally"}, []string{"table"}),
+		tieredBytes:     tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_tiered_size_bytes", Help: "Table size in bytes stored in tiered object storage"}, []string{"table"}),
+		tablespaceBytes: tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_tablespace_size_bytes", Help: "Table size in bytes per tablespace"}, []string{"table", "tablespace"}),
+		forecast:        tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_size_forecast_bytes", Help: "Seasonal forecast of the table size in bytes"}, []string{"table", "horizon"}),
+		smoothedBytes:   tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_size_smoothed_bytes", Help: "Table size in bytes as exponentially weighted moving average"}, []string{"table"}),
+		chunks:          tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_chunks", Help: "Number of chunks of the table"}, []string{"table"}),
+		avgChunkBytes:   tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_avg_chunk_size_bytes", Help: "Average chunk size in bytes"}, []string{"table"}),
+		selfBytes:       factory.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_usage_schema_table_size_bytes", Help: "Size of the tables of the usage schema in bytes"}, []string{"table"}),
+		rowsPerDay:      tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_rows_inserted_per_day", Help: "Rows inserted per day, derived from n_tup_ins between runs"}, []string{"table"}),
+		deadTuples:      tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_dead_tuples", Help: "Dead tuples in the chunks of the table not yet reclaimed by vacuum"}, []string{"table"}),
+		lastVacuum:      tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_oldest_vacuum_timestamp_seconds", Help: "Oldest last (auto)vacuum of any chunk with dead tuples"}, []string{"table"}),
+		oldestData:      tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_oldest_data_seconds", Help: "Timestamp of the oldest row of the table"}, []string{"table"}),
+		newestData:      tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_newest_data_seconds", Help: "Timestamp of the newest row of the table"}, []string{"table"}),
+		tenantBytes:     factory.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_tenant_size_bytes", Help: "Size in bytes of all tables in the schema of a tenant"}, []string{"tenant"}),
+		sizeDeviation:   tables.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_size_comparison_deviation_ratio", Help: "Deviation of the approximate from the exact table size, relative to the exact size"}, []string{"table"}),
+		untrackedBytes:  factory.NewGauge(prometheus.GaugeOpts{Name: "timescale_usage_untracked_bytes", Help: "Database size in bytes not accounted to any tracked table"}),
+		skippedRuns:     factory.NewCounter(prometheus.CounterOpts{Name: "timescale_usage_skipped_runs_total", Help: "Ticks skipped because the previous run was still in progress"}),
+		purgedRows:      factory.NewCounterVec(prometheus.CounterOpts{Name: "timescale_usage_purged_rows_total", Help: "Rows of the usage schema deleted by retention"}, []string{"table"}),
+		connected:       factory.NewGauge(prometheus.GaugeOpts{Name: "timescale_usage_database_connected", Help: "1 if the last database health check succeeded, 0 otherwise"}),
+
+		quotaUsedRatio:      factory.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_usage_quota_used_ratio", Help: "Used share of the quota"}, []string{"kind", "subject"}),
+		quotaRemainingBytes: factory.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_usage_quota_remaining_bytes", Help: "Bytes left until the quota is reached, negative if exceeded"}, []string{"kind", "subject"}),
+
+		queryCalls:        factory.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_usage_query_calls", Help: "Number of statements attributed to a table or user"}, []string{"kind", "subject"}),
+		queryExecSeconds:  factory.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_usage_query_exec_seconds", Help: "Execution time of statements attributed to a table or user"}, []string{"kind", "subject"}),
+		queryReadBytes:    factory.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_usage_query_read_bytes", Help: "Bytes read by statements attributed to a table or user"}, []string{"kind", "subject"}),
+		queryWrittenBytes: factory.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_usage_query_written_bytes", Help: "Bytes written by statements attributed to a table or user"}, []string{"kind", "subject"}),
+	}
+	if topK != nil {
+		registerer.MustRegister(topK)
+	}
+	return m
+}
+
+// sizeHistogram is the distribution of table sizes of the latest run. Unlike a prometheus.Histogram, it is replaced
+// on every run instead of accumulating observations, so each bucket counts the tables currently of that size.
+type sizeHistogram struct {
+	desc    *prometheus.Desc
+	buckets []float64
+	mux     sync.Mutex
+	counts  map[float64]uint64
+	sum     float64
+	count   uint64
+}
+
+func newSizeHistogram() *sizeHistogram {
+	return &sizeHistogram{
+		desc:    prometheus.NewDesc("timescale_table_size_distribution_bytes", "Number of tables per size bucket as of the latest run", nil, nil),
+		buckets: prometheus.ExponentialBuckets(1<<20, 4, 11), // 1 MiB to 1 TiB
+		counts:  map[float64]uint64{},
+	}
+}
+
+func (h *sizeHistogram) set(sizes map[string]int64) {
+	counts := map[float64]uint64{}
+	var sum float64
+	for _, size := range sizes {
+		sum += float64(size)
+		for _, bucket := range h.buckets {
+			if float64(size) <= bucket {
+				counts[bucket]++
+			}
+		}
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.counts, h.sum, h.count = counts, sum, uint64(len(sizes))
+}
+
+func (h *sizeHistogram) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.desc
+}
+
+func (h *sizeHistogram) Collect(ch chan<- prometheus.Metric) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.count == 0 {
+		return
+	}
+	ch <- prometheus.MustNewConstHistogram(h.desc, h.count, h.sum, h.counts)
+}
+
+// otherTables labels the sum of all tables not within the top k
+const otherTables = "other"
+
+// topKFilter collects the registered per table metrics only for the allowed tables and the sum of the others,
+// limiting the cardinality for installations with many tables. Full detail stays available in the usage schema.
+type topKFilter struct {
+	mux        sync.Mutex
+	allowed    map[string]bool
+	collectors []prometheus.Collector
+}
+
+func (f *topKFilter) allow(tables []string) {
+	allowed := map[string]bool{otherTables: true}
+	for _, table := range tables {
+		allowed[table] = true
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.allowed = allowed
+}
+
+func (f *topKFilter) Register(c prometheus.Collector) error {
+	f.collectors = append(f.collectors, c)
+	return nil
+}
+
+func (f *topKFilter) MustRegister(cs ...prometheus.Collector) {
+	f.collectors = append(f.collectors, cs...)
+}
+
+func (f *topKFilter) Unregister(c prometheus.Collector) bool {
+	return false
+}
+
+func (f *topKFilter) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range f.collectors {
+		c.Describe(ch)
+	}
+}
+
+func (f *topKFilter) Collect(ch chan<- prometheus.Metric) {
+	f.mux.Lock()
+	allowed := f.allowed
+	f.mux.Unlock()
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		for _, c := range f.collectors {
+			c.Collect(metrics)
+		}
+		close(metrics)
+	}()
+	for metric := range metrics {
+		if allowed[tableLabel(metric)] {
+			ch <- metric
+		}
+	}
+}
+
+func tableLabel(metric prometheus.Metric) string {
+	m := &dto.Metric{}
+	if metric.Write(m) != nil {
+		return ""
+	}
+	for _, label := range m.GetLabel() {
+		if label.GetName() == "table" {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// limitToTopK exports per table metrics of the metrics_top_k largest tables of the run; the size of all others
+// is exported as table "other"
+func (w *Worker) limitToTopK() {
+	tables := make([]string, 0, len(w.listedSizes))
+	for table := range w.listedSizes {
+		tables = append(tables, table)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return w.listedSizes[tables[i]] > w.listedSizes[tables[j]]
+	})
+	k := min(w.config.MetricsTopK, len(tables))
+	var other int64
+	for _, table := range tables[k:] {
+		other += w.listedSizes[table]
+	}
+	w.metrics.topK.allow(tables[:k])
+	w.metrics.bytes.WithLabelValues(otherTables).Set(float64(other))
+}
@@ -17,24 +17,363 @@
 package worker
 
 import (
+	"context"
 	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
 )
 
-func (w *Worker) migrate() error {
-	_, err := w.conn.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %v;", w.config.PostgresUsageSchema))
+// Migrate creates or updates the usage schema without starting the worker
+func Migrate(config configuration.Config) error {
+	conn, err := database.Connect(config, "migrate")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	w := &Worker{conn: conn, config: config}
+	return w.migrate(context.Background())
+}
+
+func (w *Worker) migrate(ctx context.Context) error {
+	_, err := w.conn.ExecEx(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %v;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage (\"table\" varchar(63) PRIMARY KEY, bytes bigserial, updated_at timestamptz);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS bytes_per_day DOUBLE PRECISION;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS growth_r2 DOUBLE PRECISION;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_history (\"table\" varchar(63) NOT NULL, bytes bigint NOT NULL, time timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS usage_history_table_time_idx ON %v.usage_history (\"table\", time DESC);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_forecast (\"table\" varchar(63) PRIMARY KEY, alpha DOUBLE PRECISION, beta DOUBLE PRECISION, gamma DOUBLE PRECISION, level DOUBLE PRECISION, trend DOUBLE PRECISION, seasonal DOUBLE PRECISION[], last_day timestamptz, updated_at timestamptz);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage_history ADD COLUMN IF NOT EXISTS run_started_at timestamptz;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	// maintained by the platform, maps tables to the users owning them
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_mapping (\"table\" varchar(63) PRIMARY KEY, user_id text NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS bytes_local bigint, ADD COLUMN IF NOT EXISTS bytes_tiered bigint;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_tablespaces (\"table\" varchar(63) NOT NULL, tablespace name NOT NULL, bytes bigint, updated_at timestamptz, PRIMARY KEY (\"table\", tablespace));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_recommendations (\"table\" varchar(63) NOT NULL, kind text NOT NULL, message text, estimated_savings_bytes bigint, created_at timestamptz, PRIMARY KEY (\"table\", kind));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_actions (id bigserial PRIMARY KEY, \"table\" varchar(63) NOT NULL, action text NOT NULL, details text, error text, created_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_exports (day timestamptz PRIMARY KEY, exported_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS bytes_smoothed DOUBLE PRECISION;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_quotas (kind text NOT NULL, subject text NOT NULL, bytes bigint NOT NULL, updated_at timestamptz NOT NULL, PRIMARY KEY (kind, subject));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_violations (id bigserial PRIMARY KEY, kind text NOT NULL, subject text NOT NULL, state text NOT NULL, bytes bigint, quota_bytes bigint, grace_until timestamptz, created_at timestamptz NOT NULL, updated_at timestamptz NOT NULL, resolved_at timestamptz);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS usage_violations_open_idx ON %v.usage_violations (kind, subject) WHERE state <> 'resolved';", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_write_blocks (\"table\" varchar(63) PRIMARY KEY, kind text NOT NULL, subject text NOT NULL, mode text NOT NULL, blocked_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_writable (\"table\" varchar(63) PRIMARY KEY, writable boolean NOT NULL, updated_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage_violations ADD COLUMN IF NOT EXISTS acknowledged_at timestamptz, ADD COLUMN IF NOT EXISTS acknowledged_by text, ADD COLUMN IF NOT EXISTS override_until timestamptz, ADD COLUMN IF NOT EXISTS override_by text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_violation_audit (id bigserial PRIMARY KEY, violation_id bigint NOT NULL, action text NOT NULL, by text NOT NULL, until timestamptz, comment text, created_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS owner text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS kind text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS chunk_count bigint, ADD COLUMN IF NOT EXISTS avg_chunk_bytes bigint, ADD COLUMN IF NOT EXISTS tiny_chunks boolean;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_history_daily (\"table\" varchar(63) NOT NULL, day timestamptz NOT NULL, min_bytes bigint, max_bytes bigint, avg_bytes DOUBLE PRECISION, samples bigint, last_bytes bigint, last_time timestamptz, last_run_started_at timestamptz, PRIMARY KEY (\"table\", day));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	// raw history combined with the last snapshot of every downsampled day
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE OR REPLACE VIEW %[1]v.usage_history_all AS SELECT \"table\", bytes, time, run_started_at FROM %[1]v.usage_history UNION ALL SELECT \"table\", last_bytes, last_time, last_run_started_at FROM %[1]v.usage_history_daily;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_summary (id int PRIMARY KEY, database_bytes bigint, tracked_bytes bigint, untracked_bytes bigint, updated_at timestamptz);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_query_stats (kind text NOT NULL, subject text NOT NULL, calls bigint, exec_time_ms DOUBLE PRECISION, bytes_read bigint, bytes_written bigint, updated_at timestamptz, PRIMARY KEY (kind, subject));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS tup_ins bigint, ADD COLUMN IF NOT EXISTS tup_ins_at timestamptz, ADD COLUMN IF NOT EXISTS rows_per_day DOUBLE PRECISION;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS dead_tuples bigint, ADD COLUMN IF NOT EXISTS live_tuples bigint, ADD COLUMN IF NOT EXISTS last_vacuum timestamptz;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS tenant text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_jobs (id bigserial PRIMARY KEY, kind text NOT NULL, state text NOT NULL, params jsonb, result jsonb, error text, created_by text, created_at timestamptz NOT NULL, updated_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_size_comparison (\"table\" varchar(63) PRIMARY KEY, approximate_bytes bigint, exact_bytes bigint, deviation DOUBLE PRECISION, first_date timestamptz, chunk_first_date timestamptz, first_date_deviation_days DOUBLE PRECISION, updated_at timestamptz);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_retention (kind text PRIMARY KEY, interval text NOT NULL, updated_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage_actions ADD COLUMN IF NOT EXISTS by text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_annotations (id bigserial PRIMARY KEY, \"table\" varchar(63) NOT NULL, note text, tags text[], created_by text, created_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_legal_holds (\"table\" varchar(63) PRIMARY KEY, reason text, set_by text, set_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_price_lists (id bigserial PRIMARY KEY, valid_from timestamptz NOT NULL, valid_until timestamptz, tiers jsonb NOT NULL, created_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_discounts (user_id text PRIMARY KEY, factor DOUBLE PRECISION NOT NULL, updated_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_billing_exports (exporter text NOT NULL, period_start timestamptz NOT NULL, idempotency_key text NOT NULL, status text NOT NULL, attempts int NOT NULL, last_error text, updated_at timestamptz NOT NULL, PRIMARY KEY (exporter, period_start));", w.config.PostgresUsageSchema), nil)
 	if err != nil {
 		return err
 	}
 
-	_, err = w.conn.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage (\"table\" varchar(63) PRIMARY KEY, bytes bigserial, updated_at timestamptz);", w.config.PostgresUsageSchema))
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_run_cursor (shard int PRIMARY KEY, cursor text NOT NULL, updated_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
 	if err != nil {
 		return err
 	}
 
-	_, err = w.conn.Exec(fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS bytes_per_day DOUBLE PRECISION;", w.config.PostgresUsageSchema))
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_run_status (shard int PRIMARY KEY, run_started_at timestamptz NOT NULL, tables_done bigint NOT NULL, tables_total bigint NOT NULL, current_table text, finished_at timestamptz, error text, updated_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
 	if err != nil {
 		return err
 	}
 
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_shards (shard int PRIMARY KEY, shard_count int NOT NULL, host text NOT NULL, heartbeat_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS source_table text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_lifecycle (\"table\" varchar(63) PRIMARY KEY, first_seen_at timestamptz NOT NULL, last_seen_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS relid bigint;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_by_month (\"table\" varchar(63) NOT NULL, month timestamptz NOT NULL, bytes bigint NOT NULL, updated_at timestamptz NOT NULL, PRIMARY KEY (\"table\", month));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_column_sizes (\"table\" varchar(63) NOT NULL, \"column\" text NOT NULL, avg_bytes DOUBLE PRECISION NOT NULL, share DOUBLE PRECISION, estimated_bytes bigint, updated_at timestamptz NOT NULL, PRIMARY KEY (\"table\", \"column\"));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS method text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS error_margin DOUBLE PRECISION;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_runs (id bigserial PRIMARY KEY, shard int NOT NULL, started_at timestamptz NOT NULL, finished_at timestamptz NOT NULL, duration_seconds DOUBLE PRECISION NOT NULL, outcome text NOT NULL, error text, tables_done bigint NOT NULL, tables_total bigint NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS usage_runs_started_at_idx ON %v.usage_runs (started_at);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_federation (cluster text PRIMARY KEY, database_bytes bigint NOT NULL, tracked_bytes bigint NOT NULL, untracked_bytes bigint NOT NULL, updated_at timestamptz, fetched_at timestamptz NOT NULL, error text);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_outbox (id bigserial PRIMARY KEY, destination text NOT NULL, payload jsonb NOT NULL, created_at timestamptz NOT NULL, attempts int NOT NULL DEFAULT 0, next_attempt_at timestamptz NOT NULL, last_error text);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS usage_outbox_due_idx ON %v.usage_outbox (destination, next_attempt_at);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage_outbox ADD COLUMN IF NOT EXISTS idempotency_key text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS usage_outbox_idempotency_key_idx ON %v.usage_outbox (destination, idempotency_key);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_api_access (id bigserial PRIMARY KEY, subject text NOT NULL, method text NOT NULL, path text NOT NULL, query text NOT NULL, status int NOT NULL, remote_addr text NOT NULL, accessed_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS usage_api_access_accessed_at_idx ON %v.usage_api_access (accessed_at);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_query_plans (\"table\" text PRIMARY KEY, query text NOT NULL, plan text NOT NULL, duration_ms bigint NOT NULL, explained_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_by_partition (\"table\" varchar(63) NOT NULL, dimension text NOT NULL, range_start bigint NOT NULL, range_end bigint NOT NULL, bytes bigint NOT NULL, keys text[] NOT NULL, updated_at timestamptz NOT NULL, PRIMARY KEY (\"table\", dimension, range_start));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_devices (\"table\" varchar(63) NOT NULL, device text NOT NULL, rows bigint NOT NULL, avg_row_bytes DOUBLE PRECISION NOT NULL, estimated_bytes bigint NOT NULL, updated_at timestamptz NOT NULL, PRIMARY KEY (\"table\", device));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_dropped (\"table\" varchar(63) PRIMARY KEY, owner text, kind text, tenant text, dropped_at timestamptz NOT NULL);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage_write_blocks ADD COLUMN IF NOT EXISTS revoked_roles text[];", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v.usage_federation_tables (cluster text NOT NULL, \"table\" text NOT NULL, bytes bigint NOT NULL, owner text NOT NULL, kind text NOT NULL, tenant text NOT NULL, updated_at timestamptz NOT NULL, PRIMARY KEY (cluster, \"table\"));", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage_violations ADD COLUMN IF NOT EXISTS exceeded_at timestamptz;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage ADD COLUMN IF NOT EXISTS source_user text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("ALTER TABLE %v.usage_dropped ADD COLUMN IF NOT EXISTS source_user text;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
 	return nil
 }
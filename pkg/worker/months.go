@@ -0,0 +1,79 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// chunks are assigned to the month of their range_start, compressed chunks with their compressed size
+const sizeByMonthQuery = `SELECT date_trunc('month', c.range_start), sum(s.total_bytes)::bigint
+FROM chunks_detailed_size($1::regclass) s
+JOIN timescaledb_information.chunks c ON c.chunk_schema = s.chunk_schema AND c.chunk_name = s.chunk_name
+WHERE c.range_start IS NOT NULL
+GROUP BY 1;`
+
+type monthSize struct {
+	month time.Time
+	bytes int64
+}
+
+// upsertSizeByMonth replaces the monthly breakdown of a hypertable in usage_by_month
+func (w *Worker) upsertSizeByMonth(ctx context.Context, t hypertable, now time.Time) error {
+	identifier := pgx.Identifier{t.schema, t.table}.Sanitize()
+	months := []monthSize{}
+	err := w.inSavepoint(ctx, func() error {
+		rows, err := w.snapshot.QueryEx(ctx, sizeByMonthQuery, nil, identifier)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			m := monthSize{}
+			err = rows.Scan(&m.month, &m.bytes)
+			if err != nil {
+				return err
+			}
+			months = append(months, m)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_by_month WHERE \"table\" = $1;", w.config.PostgresUsageSchema), nil, t.table)
+	if err != nil {
+		return err
+	}
+	for _, m := range months {
+		_, err = tx.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_by_month (\"table\", month, bytes, updated_at) VALUES ($1, $2, $3, $4);", w.config.PostgresUsageSchema), nil, t.table, m.month, m.bytes, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
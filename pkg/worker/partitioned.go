@@ -0,0 +1,52 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// only the top of a partition hierarchy is listed, nested partitions count towards it
+const partitionedTablesQuery = `SELECT n.nspname, c.relname FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = $1 AND c.relkind = 'p' AND NOT c.relispartition;`
+
+// upsertPartitionedTables measures the declaratively partitioned tables of the source schema, e.g. of exports migrated
+// off TimescaleDB to pg_partman. Their partitions take the place of chunks.
+func (w *Worker) upsertPartitionedTables(ctx context.Context) error {
+	tables, err := listTables(ctx, w.snapshot, partitionedTablesQuery, model.KindPartitioned, w.config.PostgresSourceSchema)
+	if err != nil {
+		return err
+	}
+	return w.upsertAll(ctx, tables)
+}
+
+// a partitioned table has no storage of its own, pg_partition_tree includes it with its partitions, requires
+// PostgreSQL 12
+const partitionedSizeQuery = `SELECT coalesce(sum(pg_total_relation_size(p.relid)), 0)::bigint, count(*) FILTER (WHERE p.isleaf), pg_get_userbyid(c.relowner)::text, c.oid::bigint
+FROM pg_class c, LATERAL pg_partition_tree(c.oid) p
+WHERE c.oid = $1::regclass
+GROUP BY c.relowner, c.oid;`
+
+func measurePartitioned(ctx context.Context, snapshot *pgx.Tx, t hypertable, m *measurement) error {
+	m.method, m.margin = methodExact, pgtype.Float8{Float: 0, Status: pgtype.Present}
+	return snapshot.QueryRowEx(ctx, partitionedSizeQuery, nil, pgx.Identifier{t.schema, t.table}.Sanitize()).Scan(&m.size, &m.chunks, &m.owner, &m.relid)
+}
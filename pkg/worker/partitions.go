@@ -0,0 +1,123 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// space partitions of a hypertable are the slices of its closed dimensions, constraining the chunks to a range of
+// partition hashes. Compressed chunks count with their compressed size. The newest chunk of a slice shows which keys
+// the slice currently holds, chunk ids grow with creation.
+const sizeByPartitionQuery = `SELECT d.column_name, ds.range_start, ds.range_end, sum(s.total_bytes)::bigint,
+(array_agg(format('%I.%I', ch.schema_name, ch.table_name) ORDER BY ch.id DESC))[1]
+FROM chunks_detailed_size($1::regclass) s
+JOIN _timescaledb_catalog.chunk ch ON ch.schema_name = s.chunk_schema AND ch.table_name = s.chunk_name
+JOIN _timescaledb_catalog.chunk_constraint cc ON cc.chunk_id = ch.id
+JOIN _timescaledb_catalog.dimension_slice ds ON ds.id = cc.dimension_slice_id
+JOIN _timescaledb_catalog.dimension d ON d.id = ds.dimension_id
+WHERE d.num_slices IS NOT NULL
+GROUP BY 1, 2, 3;`
+
+type partitionSize struct {
+	dimension  string
+	rangeStart int64
+	rangeEnd   int64
+	bytes      int64
+	newest     string // identifier of the newest chunk of the partition
+	keys       []string
+}
+
+// upsertSizeByPartition replaces the breakdown of a hypertable by space partition in usage_by_partition. Hash
+// partitions may hold many keys, up to partition_keys_limit keys of the newest chunk are stored with each partition.
+// A partition with a single key attributes its size to that key, e.g. one device.
+func (w *Worker) upsertSizeByPartition(ctx context.Context, t hypertable, now time.Time) error {
+	identifier := pgx.Identifier{t.schema, t.table}.Sanitize()
+	partitions := []partitionSize{}
+	err := w.inSavepoint(ctx, func() error {
+		rows, err := w.snapshot.QueryEx(ctx, sizeByPartitionQuery, nil, identifier)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			p := partitionSize{keys: []string{}}
+			err = rows.Scan(&p.dimension, &p.rangeStart, &p.rangeEnd, &p.bytes, &p.newest)
+			if err != nil {
+				return err
+			}
+			partitions = append(partitions, p)
+		}
+		if rows.Err() != nil {
+			return rows.Err()
+		}
+		rows.Close()
+		if w.config.PartitionKeysLimit <= 0 {
+			return nil
+		}
+		for i, p := range partitions {
+			partitions[i].keys, err = w.partitionKeys(ctx, p)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_by_partition WHERE \"table\" = $1;", w.config.PostgresUsageSchema), nil, t.table)
+	if err != nil {
+		return err
+	}
+	for _, p := range partitions {
+		_, err = tx.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_by_partition (\"table\", dimension, range_start, range_end, bytes, keys, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7);", w.config.PostgresUsageSchema), nil, t.table, p.dimension, p.rangeStart, p.rangeEnd, p.bytes, p.keys, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (w *Worker) partitionKeys(ctx context.Context, p partitionSize) (keys []string, err error) {
+	column := pgx.Identifier{p.dimension}.Sanitize()
+	rows, err := w.snapshot.QueryEx(ctx, "SELECT DISTINCT "+column+"::text FROM "+p.newest+" WHERE "+column+" IS NOT NULL ORDER BY 1 LIMIT $1;", nil, w.config.PartitionKeysLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys = []string{}
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
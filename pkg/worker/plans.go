@@ -0,0 +1,68 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// explainSlowTable stores the plan of the oldest timestamp query of a table whose collection took longer than
+// slow_table_duration, as a sequential scan there usually points to a missing index on time. EXPLAIN without ANALYZE
+// only plans the query. The plan names the table, so it is only logged with log_table_names plain.
+func (w *Worker) explainSlowTable(ctx context.Context, t hypertable, took time.Duration) error {
+	if w.slowTable <= 0 || took <= w.slowTable || !hasTimeColumn(t) {
+		return nil
+	}
+	query := "SELECT time FROM " + pgx.Identifier{t.schema, t.table}.Sanitize() + " ORDER BY time ASC LIMIT 1"
+	lines := []string{}
+	err := w.inSavepoint(ctx, func() error {
+		rows, err := w.snapshot.QueryEx(ctx, "EXPLAIN "+query+";", nil)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var line string
+			err = rows.Scan(&line)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, line)
+		}
+		return rows.Err()
+	})
+	if errIsTableDoesNotExist(err) || errIsLockTimeout(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	plan := strings.Join(lines, "\n")
+	if w.logName(t.table) == t.table {
+		log.Println("WARNING: Collecting " + t.table + " took " + took.String() + ", plan of its oldest timestamp:\n" + plan)
+	} else {
+		log.Println("WARNING: Collecting " + w.logName(t.table) + " took " + took.String() + ", see usage_query_plans for its plan")
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_query_plans (\"table\", query, plan, duration_ms, explained_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (\"table\") DO UPDATE SET query = $2, plan = $3, duration_ms = $4, explained_at = $5;", w.config.PostgresUsageSchema), nil, t.table, query, plan, took.Milliseconds(), time.Now())
+	return err
+}
@@ -0,0 +1,70 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// postgresDialect measures the plain tables of the source schema, for deployments without TimescaleDB
+type postgresDialect struct{}
+
+func (d postgresDialect) name() string {
+	return dialectPostgres
+}
+
+func (d postgresDialect) timescale() bool {
+	return false
+}
+
+// partitions are measured with their parent with partitioned_tables, see upsertPartitionedTables
+func (d postgresDialect) list(ctx context.Context, snapshot *pgx.Tx, config configuration.Config) ([]hypertable, error) {
+	if config.PartitionedTables {
+		return listTables(ctx, snapshot, "SELECT n.nspname, c.relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = $1 AND c.relkind = 'r' AND NOT c.relispartition;", model.KindTable, config.PostgresSourceSchema)
+	}
+	return listTables(ctx, snapshot, "SELECT schemaname, tablename FROM pg_tables WHERE schemaname = $1;", model.KindTable, config.PostgresSourceSchema)
+}
+
+func (d postgresDialect) informationViews() []string {
+	return nil
+}
+
+func (d postgresDialect) unreadableTablesQuery() string {
+	return "SELECT format('%I.%I', schemaname, tablename) FROM pg_tables WHERE schemaname = $1 AND NOT has_table_privilege(format('%I.%I', schemaname, tablename), 'SELECT');"
+}
+
+func (d postgresDialect) measureSize(ctx context.Context, snapshot *pgx.Tx, t hypertable, sampleChunks int, m *measurement) error {
+	m.method, m.margin = methodExact, pgtype.Float8{Float: 0, Status: pgtype.Present}
+	return relationSize(ctx, snapshot, "pg_total_relation_size", t, m)
+}
+
+// a tenant is the sum of all tables and materialized views of its schema
+const postgresTenantSizeQuery = `SELECT coalesce(sum(pg_total_relation_size(c.oid)), 0)::bigint, pg_get_userbyid(n.nspowner)::text
+FROM pg_namespace n
+LEFT JOIN pg_class c ON c.relnamespace = n.oid AND c.relkind IN ('r', 'm')
+WHERE n.nspname = $1
+GROUP BY n.oid, n.nspowner;`
+
+func (d postgresDialect) measureTenant(ctx context.Context, snapshot *pgx.Tx, schema string, m *measurement) error {
+	m.method, m.margin = methodExact, pgtype.Float8{Float: 0, Status: pgtype.Present}
+	return snapshot.QueryRowEx(ctx, postgresTenantSizeQuery, nil, schema).Scan(&m.size, &m.owner)
+}
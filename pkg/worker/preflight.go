@@ -0,0 +1,101 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// missingPrivileges lists all grants the roles of this service lack to maintain the usage schema and to read the
+// sources. The sources are read by the role of the source connection, postgres_source_user if set.
+func (w *Worker) missingPrivileges(ctx context.Context) (missing []string, err error) {
+	var role, sourceRole string
+	err = w.conn.QueryRowEx(ctx, "SELECT current_user;", nil).Scan(&role)
+	if err != nil {
+		return nil, err
+	}
+	err = w.source.QueryRowEx(ctx, "SELECT current_user;", nil).Scan(&sourceRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var schemaExists, schemaPrivileged, databasePrivileged bool
+	err = w.conn.QueryRowEx(ctx, "SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1), has_database_privilege(current_database(), 'CREATE');", nil, w.config.PostgresUsageSchema).Scan(&schemaExists, &databasePrivileged)
+	if err != nil {
+		return nil, err
+	}
+	if schemaExists {
+		err = w.conn.QueryRowEx(ctx, "SELECT has_schema_privilege($1, 'USAGE, CREATE');", nil, w.config.PostgresUsageSchema).Scan(&schemaPrivileged)
+		if err != nil {
+			return nil, err
+		}
+		if !schemaPrivileged {
+			missing = append(missing, fmt.Sprintf("GRANT USAGE, CREATE ON SCHEMA %v TO %v;", w.config.PostgresUsageSchema, role))
+		}
+	} else if !databasePrivileged {
+		missing = append(missing, fmt.Sprintf("GRANT CREATE ON DATABASE %v TO %v;", w.config.PostgresDb, role))
+	}
+
+	var sourceSchemaPrivileged bool
+	err = w.source.QueryRowEx(ctx, "SELECT NOT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1) OR has_schema_privilege($1, 'USAGE');", nil, w.config.PostgresSourceSchema).Scan(&sourceSchemaPrivileged)
+	if err != nil {
+		return nil, err
+	}
+	if !sourceSchemaPrivileged {
+		missing = append(missing, fmt.Sprintf("GRANT USAGE ON SCHEMA %v TO %v;", w.config.PostgresSourceSchema, sourceRole))
+	}
+
+	for _, view := range w.dialect.informationViews() {
+		var privileged bool
+		err = w.source.QueryRowEx(ctx, "SELECT has_table_privilege($1, 'SELECT');", nil, view).Scan(&privileged)
+		if err != nil {
+			return nil, err
+		}
+		if !privileged {
+			missing = append(missing, fmt.Sprintf("GRANT SELECT ON %v TO %v;", view, sourceRole))
+		}
+	}
+
+	rows, err := w.source.QueryEx(ctx, w.dialect.unreadableTablesQuery(), nil, w.config.PostgresSourceSchema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		missing = append(missing, fmt.Sprintf("GRANT SELECT ON %v TO %v;", table, sourceRole))
+	}
+	return missing, rows.Err()
+}
+
+func (w *Worker) preflight(ctx context.Context) error {
+	missing, err := w.missingPrivileges(ctx)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return errors.New("missing privileges:\n" + strings.Join(missing, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// pg_stat_statements does not know which tables a statement touched, statements are attributed to every tracked
+// table named in their text, with the regex metacharacters of the name escaped. Counters are cumulative since the
+// last pg_stat_statements_reset().
+const queryStatsByTableQuery = `SELECT t.name, sum(s.calls)::bigint, sum(s.total_exec_time), (sum(s.shared_blks_read + s.local_blks_read) * current_setting('block_size')::bigint)::bigint,
+(sum(s.shared_blks_written + s.local_blks_written) * current_setting('block_size')::bigint)::bigint
+FROM pg_stat_statements s
+JOIN unnest($1::text[]) t(name) ON s.query ~* ('\m' || regexp_replace(t.name, '([.^$*+?()\[\]{}|\\])', '\\\1', 'g') || '\M')
+WHERE s.dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+GROUP BY 1;`
+
+const queryStatsByUserQuery = `SELECT r.rolname, sum(s.calls)::bigint, sum(s.total_exec_time), (sum(s.shared_blks_read + s.local_blks_read) * current_setting('block_size')::bigint)::bigint,
+(sum(s.shared_blks_written + s.local_blks_written) * current_setting('block_size')::bigint)::bigint
+FROM pg_stat_statements s
+JOIN pg_roles r ON r.oid = s.userid
+WHERE s.dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+GROUP BY 1;`
+
+type queryStats struct {
+	subject      string
+	calls        int64
+	execTimeMs   float64
+	bytesRead    int64
+	bytesWritten int64
+}
+
+// updateQueryStats attributes the query load recorded by pg_stat_statements to tracked tables and users
+func (w *Worker) updateQueryStats(ctx context.Context) error {
+	log.Println("Query stats")
+	var available bool
+	err := w.source.QueryRowEx(ctx, "SELECT to_regclass('pg_stat_statements') IS NOT NULL;", nil).Scan(&available)
+	if err != nil {
+		return err
+	}
+	if !available {
+		log.Println("WARNING: query_stats enabled, but extension pg_stat_statements is not installed")
+		return nil
+	}
+	now := time.Now()
+	err = w.upsertQueryStats(ctx, "table", queryStatsByTableQuery, now, w.listedTables)
+	if err != nil {
+		return err
+	}
+	err = w.upsertQueryStats(ctx, "user", queryStatsByUserQuery, now)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_query_stats WHERE updated_at < $1;", w.config.PostgresUsageSchema), nil, now)
+	return err
+}
+
+func (w *Worker) upsertQueryStats(ctx context.Context, kind string, query string, now time.Time, args ...interface{}) error {
+	rows, err := w.source.QueryEx(ctx, query, nil, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	entries := []queryStats{}
+	for rows.Next() {
+		e := queryStats{}
+		err = rows.Scan(&e.subject, &e.calls, &e.execTimeMs, &e.bytesRead, &e.bytesWritten)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	for _, e := range entries {
+		_, err = w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_query_stats (kind, subject, calls, exec_time_ms, bytes_read, bytes_written, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (kind, subject) DO UPDATE SET calls = $3, exec_time_ms = $4, bytes_read = $5, bytes_written = $6, updated_at = $7;", w.config.PostgresUsageSchema), nil, kind, e.subject, e.calls, e.execTimeMs, e.bytesRead, e.bytesWritten, now)
+		if err != nil {
+			return err
+		}
+		w.metrics.queryCalls.WithLabelValues(kind, e.subject).Set(float64(e.calls))
+		w.metrics.queryExecSeconds.WithLabelValues(kind, e.subject).Set(e.execTimeMs / 1000)
+		w.metrics.queryReadBytes.WithLabelValues(kind, e.subject).Set(float64(e.bytesRead))
+		w.metrics.queryWrittenBytes.WithLabelValues(kind, e.subject).Set(float64(e.bytesWritten))
+	}
+	return nil
+}
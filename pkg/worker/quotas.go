@@ -0,0 +1,90 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+type quotaUsage struct {
+	kind    string
+	subject string
+	limit   int64
+	used    int64
+}
+
+func (q quotaUsage) ratio() float64 {
+	if q.limit == 0 {
+		if q.used == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return float64(q.used) / float64(q.limit)
+}
+
+// user quotas apply to the sum of all tables mapped to the user, or owned by the role of the same name if unmapped.
+// Tenants are totals of tables counted on their own already, continuous aggregates count unless cagg_totals is separate.
+const quotaUsageQuery = `SELECT q.kind, q.subject, q.bytes, coalesce(CASE WHEN q.kind = 'table'
+THEN (SELECT u.bytes FROM %[1]v.usage u WHERE u."table" = q.subject)
+ELSE (SELECT sum(u.bytes) FROM %[1]v.usage u LEFT JOIN %[1]v.usage_mapping m ON m."table" = u."table" WHERE coalesce(m.user_id, u.source_user, u.owner) = q.subject AND u.kind IS DISTINCT FROM '` + model.KindTenant + `'
+	AND ($1 OR u.kind IS DISTINCT FROM '` + model.KindContinuousAggregate + `')) END, 0)::bigint
+FROM %[1]v.usage_quotas q;`
+
+func (w *Worker) getQuotaUsage(ctx context.Context) (quotas []quotaUsage, err error) {
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf(quotaUsageQuery, w.config.PostgresUsageSchema), nil, w.derivedIncluded())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		q := quotaUsage{}
+		err = rows.Scan(&q.kind, &q.subject, &q.limit, &q.used)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, rows.Err()
+}
+
+func (w *Worker) updateQuotaMetrics(quotas []quotaUsage) {
+	w.metrics.quotaUsedRatio.Reset()
+	w.metrics.quotaRemainingBytes.Reset()
+	for _, q := range quotas {
+		w.metrics.quotaUsedRatio.WithLabelValues(q.kind, q.subject).Set(q.ratio())
+		w.metrics.quotaRemainingBytes.WithLabelValues(q.kind, q.subject).Set(float64(q.limit - q.used))
+	}
+}
+
+func (w *Worker) checkQuotas(ctx context.Context) error {
+	quotas, err := w.getQuotaUsage(ctx)
+	if err != nil {
+		return err
+	}
+	w.updateQuotaMetrics(quotas)
+	return w.updateViolations(ctx, quotas)
+}
+
+// derivedIncluded reports whether continuous aggregates count towards the totals of a user, see cagg_totals
+func (w *Worker) derivedIncluded() bool {
+	return w.config.CaggTotals != model.CaggTotalsSeparate
+}
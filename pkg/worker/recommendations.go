@@ -0,0 +1,269 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	recommendationKindCompression = "compression"
+	recommendationKindReorder     = "reorder"
+	recommendationKindChunkSize   = "chunk_interval"
+	recommendationKindWideTable   = "wide_table"
+)
+
+type recommendation struct {
+	table                 string
+	message               string
+	estimatedSavingsBytes int64
+}
+
+// replaceRecommendations replaces all recommendations of the given kind
+func (w *Worker) replaceRecommendations(ctx context.Context, kind string, recommendations []recommendation) error {
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_recommendations WHERE kind = $1;", w.config.PostgresUsageSchema), nil, kind)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, r := range recommendations {
+		_, err = tx.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_recommendations (\"table\", kind, message, estimated_savings_bytes, created_at) VALUES ($1, $2, $3, $4, $5);", w.config.PostgresUsageSchema), nil, r.table, kind, r.message, r.estimatedSavingsBytes, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const compressionCandidatesQuery = `SELECT h.hypertable_name, h.compression_enabled, u.bytes, count(c.chunk_name), count(c.chunk_name) FILTER (WHERE c.is_compressed)
+FROM timescaledb_information.hypertables h
+JOIN %[1]v.usage u ON u."table" = h.hypertable_name
+LEFT JOIN timescaledb_information.chunks c ON c.hypertable_schema = h.hypertable_schema AND c.hypertable_name = h.hypertable_name
+WHERE h.hypertable_schema = $1 AND u.bytes >= $2
+GROUP BY 1, 2, 3;`
+
+func (w *Worker) suggestCompression(ctx context.Context) error {
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf(compressionCandidatesQuery, w.config.PostgresUsageSchema), nil, w.config.PostgresSourceSchema, w.config.CompressionSuggestionMinBytes)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	recommendations := []recommendation{}
+	var totalSavings int64
+	for rows.Next() {
+		var table string
+		var enabled bool
+		var bytes, chunks, compressedChunks int64
+		err = rows.Scan(&table, &enabled, &bytes, &chunks, &compressedChunks)
+		if err != nil {
+			return err
+		}
+		var compressedFraction float64 = 0
+		if chunks > 0 {
+			compressedFraction = float64(compressedChunks) / float64(chunks)
+		}
+		if enabled && compressedFraction >= w.config.CompressionSuggestionMinFraction {
+			continue
+		}
+		savings := int64(float64(bytes) * (1 - compressedFraction) * w.config.CompressionTypicalSavings)
+		message := "enable compression"
+		if enabled {
+			message = fmt.Sprintf("only %.0f%% of chunks are compressed, consider a shorter compress_after", compressedFraction*100)
+		}
+		recommendations = append(recommendations, recommendation{table: table, message: message, estimatedSavingsBytes: savings})
+		totalSavings += savings
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	log.Printf("Compression candidates: %v tables, estimated savings %v bytes\n", len(recommendations), totalSavings)
+	return w.replaceRecommendations(ctx, recommendationKindCompression, recommendations)
+}
+
+// chunks with a low correlation between physical order and time are considered unsorted
+const reorderCandidatesQuery = `SELECT c.hypertable_name, sum(s.seq_scan + coalesce(s.idx_scan, 0))::bigint, coalesce(avg(abs(st.correlation)), 0)::double precision
+FROM timescaledb_information.chunks c
+JOIN pg_stat_user_tables s ON s.schemaname = c.chunk_schema AND s.relname = c.chunk_name
+LEFT JOIN pg_stats st ON st.schemaname = c.chunk_schema AND st.tablename = c.chunk_name AND st.attname = 'time'
+WHERE c.hypertable_schema = $1 AND NOT c.is_compressed
+AND NOT EXISTS (SELECT 1 FROM timescaledb_information.jobs j WHERE j.proc_name = 'policy_reorder' AND j.hypertable_schema = c.hypertable_schema AND j.hypertable_name = c.hypertable_name)
+GROUP BY 1
+HAVING sum(s.seq_scan + coalesce(s.idx_scan, 0)) >= $2 AND coalesce(avg(abs(st.correlation)), 0) < $3;`
+
+func (w *Worker) suggestReorder(ctx context.Context) error {
+	rows, err := w.source.QueryEx(ctx, reorderCandidatesQuery, nil, w.config.PostgresSourceSchema, w.config.ReorderSuggestionMinScans, w.config.ReorderSuggestionMaxCorrelation)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	recommendations := []recommendation{}
+	for rows.Next() {
+		var table string
+		var scans int64
+		var correlation float64
+		err = rows.Scan(&table, &scans, &correlation)
+		if err != nil {
+			return err
+		}
+		recommendations = append(recommendations, recommendation{
+			table:   table,
+			message: fmt.Sprintf("chunks were scanned %v times with a time correlation of %.2f, consider add_reorder_policy", scans, correlation),
+		})
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	log.Printf("Reorder candidates: %v tables\n", len(recommendations))
+	return w.replaceRecommendations(ctx, recommendationKindReorder, recommendations)
+}
+
+// pg_stats of hypertables are gathered for the whole hierarchy (inherited) as well as per chunk, the hierarchy is
+// preferred. Columns that are NULL in every sampled row have a null_frac of 1.
+const wideTableCandidatesQuery = `SELECT st.tablename, sum(st.avg_width)::bigint, count(*) FILTER (WHERE st.null_frac >= 1),
+coalesce(string_agg(st.attname, ', ' ORDER BY st.attname) FILTER (WHERE st.null_frac >= 1), '')
+FROM (SELECT DISTINCT ON (tablename, attname) tablename, attname, avg_width, null_frac FROM pg_stats WHERE schemaname = $1 ORDER BY tablename, attname, inherited DESC) st
+GROUP BY 1
+HAVING ($2 > 0 AND sum(st.avg_width) >= $2) OR ($3 > 0 AND count(*) FILTER (WHERE st.null_frac >= 1) >= $3);`
+
+// suggestWideTables advises to reconfigure the exports of tables with very wide rows or many unused columns, which
+// usually carry fields nobody queries
+func (w *Worker) suggestWideTables(ctx context.Context) error {
+	rows, err := w.source.QueryEx(ctx, wideTableCandidatesQuery, nil, w.config.PostgresSourceSchema, w.config.WideTableMinRowBytes, w.config.WideTableMinNullColumns)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	recommendations := []recommendation{}
+	for rows.Next() {
+		var table, nullColumns string
+		var rowBytes, nullCount int64
+		err = rows.Scan(&table, &rowBytes, &nullCount, &nullColumns)
+		if err != nil {
+			return err
+		}
+		message := fmt.Sprintf("rows are %v bytes wide on average, consider exporting fewer fields", rowBytes)
+		if w.config.WideTableMinNullColumns > 0 && nullCount >= w.config.WideTableMinNullColumns {
+			message = fmt.Sprintf("%v columns are always NULL (%v), consider removing them from the export", nullCount, nullColumns)
+		}
+		recommendations = append(recommendations, recommendation{table: table, message: message})
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	log.Printf("Wide table candidates: %v tables\n", len(recommendations))
+	return w.replaceRecommendations(ctx, recommendationKindWideTable, recommendations)
+}
+
+type chunkIntervalCandidate struct {
+	table       string
+	current     time.Duration
+	recommended time.Duration
+}
+
+const chunkIntervalQuery = `SELECT d.hypertable_name, extract(epoch FROM d.time_interval)::double precision, u.bytes_per_day
+FROM timescaledb_information.dimensions d
+JOIN %[1]v.usage u ON u."table" = d.hypertable_name
+WHERE d.hypertable_schema = $1 AND d.dimension_number = 1 AND d.time_interval IS NOT NULL AND u.bytes_per_day > 0;`
+
+// chunkTargetBytes follows the rule of thumb, that a chunk should not exceed 25% of the memory
+func (w *Worker) chunkTargetBytes() int64 {
+	if w.config.ChunkTargetBytes > 0 {
+		return w.config.ChunkTargetBytes
+	}
+	return w.config.ChunkMemoryBytes / 4
+}
+
+// getChunkIntervalCandidates lists hypertables whose chunk interval deviates by more than factor 2 from the
+// interval producing chunks of the target size at the current growth rate.
+func (w *Worker) getChunkIntervalCandidates(ctx context.Context) (candidates []chunkIntervalCandidate, err error) {
+	target := w.chunkTargetBytes()
+	if target <= 0 {
+		return nil, nil
+	}
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf(chunkIntervalQuery, w.config.PostgresUsageSchema), nil, w.config.PostgresSourceSchema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var currentSeconds, bytesPerDay float64
+		err = rows.Scan(&table, &currentSeconds, &bytesPerDay)
+		if err != nil {
+			return nil, err
+		}
+		current := time.Duration(currentSeconds * float64(time.Second))
+		recommended := time.Duration(float64(target) / bytesPerDay * float64(24*time.Hour)).Truncate(time.Hour)
+		recommended = max(recommended, time.Hour)
+		recommended = min(recommended, 365*24*time.Hour)
+		if recommended > 2*current || 2*recommended < current {
+			candidates = append(candidates, chunkIntervalCandidate{table: table, current: current, recommended: recommended})
+		}
+	}
+	return candidates, rows.Err()
+}
+
+func (w *Worker) suggestChunkIntervals(ctx context.Context) error {
+	candidates, err := w.getChunkIntervalCandidates(ctx)
+	if err != nil {
+		return err
+	}
+	recommendations := []recommendation{}
+	for _, c := range candidates {
+		recommendations = append(recommendations, recommendation{
+			table:   c.table,
+			message: fmt.Sprintf("chunk_time_interval is %v, consider set_chunk_time_interval of %v", c.current, c.recommended),
+		})
+	}
+	log.Printf("Chunk interval candidates: %v tables\n", len(recommendations))
+	err = w.replaceRecommendations(ctx, recommendationKindChunkSize, recommendations)
+	if err != nil {
+		return err
+	}
+	if !w.config.ChunkIntervalEnforce {
+		return nil
+	}
+	for _, c := range candidates {
+		details := fmt.Sprintf("%v -> %v", c.current, c.recommended)
+		tables, err := w.withoutProtected(ctx, []string{c.table}, actionSetChunkInterval, details)
+		if err != nil {
+			return err
+		}
+		if len(tables) == 0 {
+			continue
+		}
+		err = w.recordAction(ctx, c.table, actionSetChunkInterval, details, w.setChunkInterval(ctx, c.table, c.recommended))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// log_table_names modes, table names may contain personal data through export names
+const (
+	logTableNamesPlain  = "plain"
+	logTableNamesRedact = "redact"
+	logTableNamesHash   = "hash" // stable within the logs, so a table can still be followed across runs
+)
+
+func checkLogTableNames(mode string) error {
+	switch mode {
+	case "", logTableNamesPlain, logTableNamesRedact, logTableNamesHash:
+		return nil
+	default:
+		return fmt.Errorf("unknown log_table_names %v", mode)
+	}
+}
+
+// logName returns the table name, or the cursor key containing it, as it may be logged. The database always keeps the
+// full name.
+func (w *Worker) logName(name string) string {
+	switch w.config.LogTableNames {
+	case logTableNamesRedact:
+		return "<redacted>"
+	case logTableNamesHash:
+		sum := sha256.Sum256([]byte(name))
+		return "table-" + hex.EncodeToString(sum[:6])
+	default:
+		return name
+	}
+}
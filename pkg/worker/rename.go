@@ -0,0 +1,94 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// tables keyed by the table name, rows of the new name take precedence over the carried over ones
+var renamedKeyedTables = []string{"usage", "usage_forecast", "usage_mapping", "usage_legal_holds", "usage_lifecycle", "usage_writable", "usage_size_comparison", "usage_write_blocks", "usage_tablespaces", "usage_recommendations", "usage_query_plans"}
+
+// tables keyed by kind and subject, with the table name as subject of kind table. Quotas, violations and write blocks
+// of a table keep applying to it after a rename.
+var renamedSubjectTables = []string{"usage_quotas", "usage_query_stats", "usage_write_blocks"}
+
+// tables with many rows per table name
+var renamedHistoryTables = []string{"usage_history", "usage_history_daily", "usage_annotations", "usage_actions", "usage_by_month", "usage_by_partition", "usage_column_sizes", "usage_devices"}
+
+// carryOverRename moves the usage of a renamed table to its new name, instead of starting over with an empty history.
+// Tables are identified by their OID. Since OIDs of dropped tables may be reused, the old name must not exist anymore.
+// Prefetched tables come with the old name already.
+func (w *Worker) carryOverRename(ctx context.Context, t hypertable, m measurement, p prefetchedUsage) error {
+	if m.relid == 0 || (p.fetched && p.renamedFrom.Status != pgtype.Present) {
+		return nil
+	}
+	var old string
+	var err error
+	if p.fetched {
+		old = p.renamedFrom.String
+	} else {
+		err = w.conn.QueryRowEx(ctx, w.statement(stmtRenamedFrom), nil, m.relid, t.table).Scan(&old)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var exists bool
+	err = w.snapshot.QueryRowEx(ctx, "SELECT to_regclass(format('%I.%I', $1::text, $2::text)) IS NOT NULL;", nil, t.schema, old).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	log.Println("Table", w.logName(old), "was renamed to", w.logName(t.table)+", carrying over its usage")
+	tx, err := w.conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range renamedKeyedTables {
+		_, err = tx.ExecEx(ctx, fmt.Sprintf("UPDATE %[1]v.%[2]v SET \"table\" = $2 WHERE \"table\" = $1 AND NOT EXISTS (SELECT 1 FROM %[1]v.%[2]v WHERE \"table\" = $2);", w.config.PostgresUsageSchema, table), nil, old, t.table)
+		if err != nil {
+			return err
+		}
+	}
+	for _, table := range renamedSubjectTables {
+		_, err = tx.ExecEx(ctx, fmt.Sprintf("UPDATE %[1]v.%[2]v SET subject = $2 WHERE kind = $3 AND subject = $1 AND NOT EXISTS (SELECT 1 FROM %[1]v.%[2]v WHERE kind = $3 AND subject = $2);", w.config.PostgresUsageSchema, table), nil, old, t.table, model.QuotaKindTable)
+		if err != nil {
+			return err
+		}
+	}
+	// resolved violations are history, open ones are moved unless the new name has an open violation already
+	_, err = tx.ExecEx(ctx, fmt.Sprintf("UPDATE %[1]v.usage_violations SET subject = $2 WHERE kind = $3 AND subject = $1 AND (state = $4 OR NOT EXISTS (SELECT 1 FROM %[1]v.usage_violations o WHERE o.kind = $3 AND o.subject = $2 AND o.state <> $4));", w.config.PostgresUsageSchema), nil, old, t.table, model.QuotaKindTable, violationStateResolved)
+	if err != nil {
+		return err
+	}
+	for _, table := range renamedHistoryTables {
+		_, err = tx.ExecEx(ctx, fmt.Sprintf("UPDATE %v.%v SET \"table\" = $2 WHERE \"table\" = $1;", w.config.PostgresUsageSchema, table), nil, old, t.table)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
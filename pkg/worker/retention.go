@@ -0,0 +1,79 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// purgedTables are the tables and time columns purged per retention kind. usage_by_month is not purged by age: it is
+// the breakdown of the data currently stored in a table, replaced on every measurement and removed with the table or
+// without size_by_month during cleanup, so it shrinks with the retention of the source tables themselves.
+var purgedTables = map[string][][2]string{
+	model.RetentionKindHistory:    {{"usage_history", "time"}},
+	model.RetentionKindAggregates: {{"usage_history_daily", "day"}, {"usage_dropped", "dropped_at"}},
+	model.RetentionKindAudit:      {{"usage_actions", "created_at"}, {"usage_violation_audit", "created_at"}, {"usage_runs", "started_at"}, {"usage_api_access", "accessed_at"}},
+}
+
+// purge deletes records older than their retention, retentions set by the api take precedence over the config
+func (w *Worker) purge(ctx context.Context) error {
+	retentions := database.RetentionDefaults(w.config)
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT kind, interval FROM %v.usage_retention;", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, interval string
+		err = rows.Scan(&kind, &interval)
+		if err != nil {
+			return err
+		}
+		retentions[kind] = interval
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	for _, kind := range model.RetentionKinds {
+		if retentions[kind] == "" {
+			continue
+		}
+		for _, table := range purgedTables[kind] {
+			query := fmt.Sprintf("DELETE FROM %v.%v WHERE %v < now() - $1::interval", w.config.PostgresUsageSchema, table[0], table[1])
+			if kind != model.RetentionKindAudit {
+				// the history of tables under legal hold is evidence as well
+				query += fmt.Sprintf(" AND \"table\" NOT IN (SELECT \"table\" FROM %v.usage_legal_holds)", w.config.PostgresUsageSchema)
+			}
+			tag, err := w.conn.ExecEx(ctx, query+";", nil, retentions[kind])
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() > 0 {
+				log.Printf("Retention: deleted %v rows of %v older than %v\n", tag.RowsAffected(), table[0], retentions[kind])
+			}
+			w.metrics.purgedRows.WithLabelValues(table[0]).Add(float64(tag.RowsAffected()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+var seasonalForecastHorizons = map[string]int{"7d": 7, "30d": 30, "90d": 90}
+
+func (w *Worker) updateSeasonalForecast(ctx context.Context, table string) error {
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT date_trunc('day', time, 'UTC') AS day, (array_agg(bytes ORDER BY time DESC))[1] FROM %v.usage_history_all WHERE \"table\" = $1 AND time > now() - make_interval(days => $2) GROUP BY day ORDER BY day;", w.config.PostgresUsageSchema), nil, table, w.config.SeasonalForecastDays)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var daily []float64
+	var lastDay time.Time
+	for rows.Next() {
+		var day pgtype.Timestamptz
+		var bytes int64
+		err = rows.Scan(&day, &bytes)
+		if err != nil {
+			return err
+		}
+		// carry the last known size over days without snapshots
+		if !lastDay.IsZero() {
+			for d := lastDay.AddDate(0, 0, 1); d.Before(day.Time); d = d.AddDate(0, 0, 1) {
+				daily = append(daily, daily[len(daily)-1])
+			}
+		}
+		daily = append(daily, float64(bytes))
+		lastDay = day.Time
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	m, ok := model.FitSeasonalModel(daily, lastDay, w.config.SeasonalAlpha, w.config.SeasonalBeta, w.config.SeasonalGamma)
+	if !ok {
+		return nil
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_forecast (\"table\", alpha, beta, gamma, level, trend, seasonal, last_day, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now()) ON CONFLICT (\"table\") DO UPDATE SET alpha = $2, beta = $3, gamma = $4, level = $5, trend = $6, seasonal = $7, last_day = $8, updated_at = now();", w.config.PostgresUsageSchema), nil, table, m.Alpha, m.Beta, m.Gamma, m.Level, m.Trend, m.Seasonal[:], m.LastDay)
+	if err != nil {
+		return err
+	}
+
+	for horizon, days := range seasonalForecastHorizons {
+		w.metrics.forecast.WithLabelValues(table, horizon).Set(m.Forecast(lastDay.AddDate(0, 0, days)))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"log"
+)
+
+// monitorSelf exports the size of the tables of this service, which grow with every run as well
+func (w *Worker) monitorSelf(ctx context.Context) error {
+	rows, err := w.conn.QueryEx(ctx, "SELECT tablename, pg_total_relation_size(format('%I.%I', schemaname, tablename)::regclass) FROM pg_tables WHERE schemaname = $1;", nil, w.config.PostgresUsageSchema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var total int64
+	for rows.Next() {
+		var table string
+		var bytes int64
+		err = rows.Scan(&table, &bytes)
+		if err != nil {
+			return err
+		}
+		w.metrics.selfBytes.WithLabelValues(table).Set(float64(bytes))
+		total += bytes
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	log.Printf("Usage schema size: %v bytes\n", total)
+	return nil
+}
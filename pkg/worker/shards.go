@@ -0,0 +1,127 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/jackc/pgx"
+)
+
+// shardIndex is shard_index, or with shard_index_from_hostname the ordinal of a statefulset pod named <name>-<ordinal>
+func shardIndex(shardIndex int, fromHostname bool) (int, error) {
+	if !fromHostname {
+		return shardIndex, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+	ordinal, err := strconv.Atoi(hostname[strings.LastIndex(hostname, "-")+1:])
+	if err != nil {
+		return 0, fmt.Errorf("hostname %v has no statefulset ordinal", hostname)
+	}
+	return ordinal, nil
+}
+
+func (w *Worker) sharded() bool {
+	return w.config.ShardCount > 1
+}
+
+// Singleton reports whether this replica runs the services that must only run once per cluster: the outbox relay,
+// the billing pusher, the parquet export and the federation poller. With sharding, these run on shard 0.
+func Singleton(config configuration.Config) (bool, error) {
+	if config.ShardCount <= 1 {
+		return true, nil
+	}
+	shard, err := shardIndex(config.ShardIndex, config.ShardIndexFromHostname)
+	if err != nil {
+		return false, err
+	}
+	return shard == 0, nil
+}
+
+// leader is the shard running the steps that are not per table, like cleanup, quotas and retention
+func (w *Worker) leader() bool {
+	return w.shard == 0
+}
+
+// inShard reports whether the measurement of t is the responsibility of this replica
+func (w *Worker) inShard(t hypertable) bool {
+	if !w.sharded() {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(t.schema + "." + t.table))
+	return int(h.Sum32()%uint32(w.config.ShardCount)) == w.shard
+}
+
+// registerShard claims the shard in usage_shards, failing if another host sent a heartbeat for it within the
+// last shard_timeout. Replicas with a different shard_count are logged, since they split tables differently.
+func (w *Worker) registerShard(ctx context.Context) (err error) {
+	if !w.sharded() {
+		return nil
+	}
+	if w.shard < 0 || w.shard >= w.config.ShardCount {
+		return fmt.Errorf("shard %v is not within shard_count %v", w.shard, w.config.ShardCount)
+	}
+	w.shardTimeout, err = time.ParseDuration(w.config.ShardTimeout)
+	if err != nil {
+		return err
+	}
+	w.host, err = os.Hostname()
+	if err != nil {
+		return err
+	}
+	return w.heartbeat(ctx)
+}
+
+// heartbeat renews the claim on the shard. The claim is taken over in the same statement only if it is held by this
+// host or its heartbeat is older than shard_timeout, so two replicas starting at once can not both hold the shard.
+func (w *Worker) heartbeat(ctx context.Context) error {
+	if !w.sharded() {
+		return nil
+	}
+	err := w.conn.QueryRowEx(ctx, fmt.Sprintf(`INSERT INTO %[1]v.usage_shards (shard, shard_count, host, heartbeat_at) VALUES ($1, $2, $3, now())
+ON CONFLICT (shard) DO UPDATE SET shard_count = $2, host = $3, heartbeat_at = now()
+WHERE %[1]v.usage_shards.host = $3 OR %[1]v.usage_shards.heartbeat_at < $4
+RETURNING shard;`, w.config.PostgresUsageSchema), nil, w.shard, w.config.ShardCount, w.host, time.Now().Add(-w.shardTimeout)).Scan(new(int))
+	if err == pgx.ErrNoRows {
+		return errors.New("shard " + strconv.Itoa(w.shard) + " is held by another host")
+	}
+	if err != nil {
+		return err
+	}
+	var otherCounts int
+	err = w.conn.QueryRowEx(ctx, fmt.Sprintf("SELECT count(*) FROM %v.usage_shards WHERE shard_count <> $1;", w.config.PostgresUsageSchema), nil, w.config.ShardCount).Scan(&otherCounts)
+	if err != nil {
+		return err
+	}
+	if otherCounts > 0 {
+		log.Println("WARNING:", otherCounts, "shards registered with a shard_count other than", w.config.ShardCount)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/notifier"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+type previousUsage struct {
+	bytes    int64
+	smoothed pgtype.Float8
+}
+
+func (w *Worker) getPreviousUsage(ctx context.Context, table string) (previous previousUsage, err error) {
+	err = w.conn.QueryRowEx(ctx, w.statement(stmtPreviousUsage), nil, table).Scan(&previous.bytes, &previous.smoothed)
+	if err == pgx.ErrNoRows {
+		return previousUsage{smoothed: pgtype.Float8{Status: pgtype.Null}}, nil
+	}
+	return previous, err
+}
+
+// smooth computes the exponentially weighted moving average of the table size, hiding the jitter of
+// hypertable_approximate_size. Returns null if smoothing is disabled.
+func (w *Worker) smooth(bytes int64, previous previousUsage) pgtype.Float8 {
+	alpha := w.config.SmoothingFactor
+	if alpha <= 0 {
+		return pgtype.Float8{Status: pgtype.Null}
+	}
+	if previous.smoothed.Status != pgtype.Present {
+		return pgtype.Float8{Float: float64(bytes), Status: pgtype.Present}
+	}
+	return pgtype.Float8{Float: alpha*float64(bytes) + (1-alpha)*previous.smoothed.Float, Status: pgtype.Present}
+}
+
+// alertingBytes prefers the smoothed size, so that thresholds are not crossed by estimation jitter
+func alertingBytes(bytes int64, smoothed pgtype.Float8) int64 {
+	if smoothed.Status == pgtype.Present {
+		return int64(smoothed.Float)
+	}
+	return bytes
+}
+
+func (w *Worker) checkThreshold(table string, previousBytes int64, bytes int64, now time.Time) {
+	if w.config.ThresholdBytes <= 0 {
+		return
+	}
+	if bytes >= w.config.ThresholdBytes && previousBytes < w.config.ThresholdBytes {
+		w.notify(notifier.Event{Kind: notifier.EventKindThresholdExceeded, Table: table, Bytes: bytes, Threshold: w.config.ThresholdBytes, Time: now})
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+)
+
+// names of the statements run for every table, prepared once per connection with prepare_statements
+const (
+	stmtUpsertUsage          = "upsert_usage"
+	stmtPreviousUsage        = "previous_usage"
+	stmtApproximateMargin    = "approximate_margin"
+	stmtGrowthSnapshots      = "growth_snapshots"
+	stmtRenamedFrom          = "renamed_from"
+	stmtUpdateStatus         = "update_status"
+	stmtUpsertSizeComparison = "upsert_size_comparison"
+)
+
+// statementFormats are formatted with the usage schema
+var statementFormats = map[string]string{
+	stmtUpsertUsage:          "INSERT INTO %v.usage (\"table\", bytes, updated_at, bytes_per_day, growth_r2, bytes_local, bytes_tiered, bytes_smoothed, owner, kind, chunk_count, avg_chunk_bytes, tiny_chunks, tenant, source_table, relid, method, error_margin, source_user) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) ON CONFLICT (\"table\") DO UPDATE SET bytes = $2, updated_at = $3, bytes_per_day = $4, growth_r2 = $5, bytes_local = $6, bytes_tiered = $7, bytes_smoothed = $8, owner = $9, kind = $10, chunk_count = $11, avg_chunk_bytes = $12, tiny_chunks = $13, tenant = $14, source_table = $15, relid = $16, method = $17, error_margin = $18, source_user = $19;",
+	stmtPreviousUsage:        "SELECT bytes, bytes_smoothed FROM %v.usage WHERE \"table\" = $1;",
+	stmtApproximateMargin:    "SELECT abs(deviation) FROM %v.usage_size_comparison WHERE \"table\" = $1;",
+	stmtGrowthSnapshots:      "SELECT bytes, time FROM %v.usage_history WHERE \"table\" = $1 ORDER BY time DESC LIMIT $2;",
+	stmtRenamedFrom:          "SELECT \"table\" FROM %v.usage WHERE relid = $1 AND \"table\" <> $2 LIMIT 1;",
+	stmtUpdateStatus:         "UPDATE %v.usage_run_status SET tables_done = $1, tables_total = $2, current_table = $3, updated_at = now() WHERE shard = $4;",
+	stmtUpsertSizeComparison: "INSERT INTO %v.usage_size_comparison (\"table\", approximate_bytes, exact_bytes, deviation, first_date, chunk_first_date, first_date_deviation_days, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (\"table\") DO UPDATE SET approximate_bytes = $2, exact_bytes = $3, deviation = $4, first_date = $5, chunk_first_date = $6, first_date_deviation_days = $7, updated_at = $8;",
+}
+
+// prepare builds the recurring statements for the usage schema and, with prepare_statements, prepares them on all
+// connections of the pool, connections opened later included. Behind a connection pooler in transaction mode,
+// prepared statements are not usable.
+func (w *Worker) prepare(ctx context.Context) error {
+	w.statements = map[string]string{}
+	for name, format := range statementFormats {
+		w.statements[name] = fmt.Sprintf(format, w.config.PostgresUsageSchema)
+		if !w.config.PrepareStatements {
+			continue
+		}
+		_, err := w.conn.PrepareEx(ctx, name, w.statements[name], nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statement returns the name of a prepared statement, which pgx resolves on execution, or its sql
+func (w *Worker) statement(name string) string {
+	if w.config.PrepareStatements {
+		return name
+	}
+	return w.statements[name]
+}
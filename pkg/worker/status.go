@@ -0,0 +1,81 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// startStatus reserves the id of the run in usage_runs and resets the progress in usage_run_status for a new run
+func (w *Worker) startStatus(ctx context.Context) error {
+	w.tablesDone, w.tablesTotal = 0, 0
+	err := w.conn.QueryRowEx(ctx, fmt.Sprintf("SELECT nextval(pg_get_serial_sequence('%v.usage_runs', 'id'));", w.config.PostgresUsageSchema), nil).Scan(&w.runId)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_run_status (shard, run_started_at, tables_done, tables_total, current_table, finished_at, error, updated_at) VALUES ($2, $1, 0, 0, NULL, NULL, NULL, now()) ON CONFLICT (shard) DO UPDATE SET run_started_at = $1, tables_done = 0, tables_total = 0, current_table = NULL, finished_at = NULL, error = NULL, updated_at = now();", w.config.PostgresUsageSchema), nil, w.runStartedAt, w.shard)
+	return err
+}
+
+// updateStatus records the table currently measured, "" once all listed tables are done
+func (w *Worker) updateStatus(ctx context.Context, current string) error {
+	currentTable := pgtype.Text{String: current, Status: pgtype.Present}
+	if current == "" {
+		currentTable.Status = pgtype.Null
+	}
+	_, err := w.conn.ExecEx(ctx, w.statement(stmtUpdateStatus), nil, w.tablesDone, w.tablesTotal, &currentTable, w.shard)
+	return err
+}
+
+// errors are summarized to their beginning in usage_runs
+const runErrorMaxLength = 1000
+
+// recordRun appends the outcome of the run to usage_runs
+func (w *Worker) recordRun(ctx context.Context, runErr error) error {
+	outcome := model.RunOutcomeSucceeded
+	errText := pgtype.Text{Status: pgtype.Null}
+	if runErr != nil {
+		outcome = model.RunOutcomeFailed
+		if errors.Is(runErr, errRunInterrupted) {
+			outcome = model.RunOutcomeInterrupted
+		}
+		summary := runErr.Error()
+		if len(summary) > runErrorMaxLength {
+			summary = summary[:runErrorMaxLength]
+		}
+		errText = pgtype.Text{String: summary, Status: pgtype.Present}
+	}
+	finishedAt := time.Now()
+	_, err := w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_runs (id, shard, started_at, finished_at, duration_seconds, outcome, error, tables_done, tables_total) VALUES ($9, $1, $2, $3, $4, $5, $6, $7, $8);", w.config.PostgresUsageSchema), nil, w.shard, w.runStartedAt, finishedAt, finishedAt.Sub(w.runStartedAt).Seconds(), outcome, &errText, w.tablesDone, w.tablesTotal, w.runId)
+	return err
+}
+
+// finishStatus marks the run as finished, with the error if it failed
+func (w *Worker) finishStatus(ctx context.Context, runErr error) error {
+	errText := pgtype.Text{Status: pgtype.Null}
+	if runErr != nil {
+		errText = pgtype.Text{String: runErr.Error(), Status: pgtype.Present}
+	}
+	_, err := w.conn.ExecEx(ctx, fmt.Sprintf("UPDATE %v.usage_run_status SET tables_done = $1, tables_total = $2, current_table = NULL, finished_at = $3, error = $4, updated_at = now() WHERE shard = $5;", w.config.PostgresUsageSchema), nil, w.tablesDone, w.tablesTotal, time.Now(), &errText, w.shard)
+	return err
+}
@@ -0,0 +1,76 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// chunks without explicit tablespace are stored in the default tablespace of the database,
+// the data of compressed chunks lives in their internal compressed chunk, which is counted in its own tablespace
+const tablespaceSizesQuery = `SELECT c.hypertable_name, coalesce(ts.spcname, (SELECT spcname FROM pg_tablespace WHERE oid = (SELECT dattablespace FROM pg_database WHERE datname = current_database()))),
+sum(pg_total_relation_size(cl.oid))::bigint
+FROM timescaledb_information.chunks c
+JOIN _timescaledb_catalog.chunk ch ON ch.schema_name = c.chunk_schema AND ch.table_name = c.chunk_name
+LEFT JOIN _timescaledb_catalog.chunk cc ON cc.id = ch.compressed_chunk_id
+CROSS JOIN LATERAL (VALUES (format('%I.%I', c.chunk_schema, c.chunk_name)), (CASE WHEN cc.id IS NOT NULL THEN format('%I.%I', cc.schema_name, cc.table_name) END)) r(name)
+JOIN pg_class cl ON cl.oid = to_regclass(r.name)
+LEFT JOIN pg_tablespace ts ON ts.oid = cl.reltablespace
+WHERE c.hypertable_schema = $1
+GROUP BY 1, 2;`
+
+func (w *Worker) upsertTablespaces(ctx context.Context) error {
+	log.Println("Tablespaces")
+	now := time.Now()
+	rows, err := w.source.QueryEx(ctx, tablespaceSizesQuery, nil, w.config.PostgresSourceSchema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type entry struct {
+		table, tablespace string
+		bytes             int64
+	}
+	entries := []entry{}
+	for rows.Next() {
+		e := entry{}
+		err = rows.Scan(&e.table, &e.tablespace, &e.bytes)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	for _, e := range entries {
+		_, err = w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_tablespaces (\"table\", tablespace, bytes, updated_at) VALUES ($1, $2, $3, $4) ON CONFLICT (\"table\", tablespace) DO UPDATE SET bytes = $3, updated_at = $4;", w.config.PostgresUsageSchema), nil, e.table, e.tablespace, e.bytes, now)
+		if err != nil {
+			return err
+		}
+		w.metrics.tablespaceBytes.WithLabelValues(e.table, e.tablespace).Set(float64(e.bytes))
+	}
+
+	// tables may have moved away from a tablespace or been dropped
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_tablespaces WHERE updated_at < $1;", w.config.PostgresUsageSchema), nil, now)
+	return err
+}
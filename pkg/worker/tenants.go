@@ -0,0 +1,46 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"log"
+	"regexp"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// upsertTenants treats every schema matching tenant_schema_pattern as a tenant and tracks its total as a usage row
+// named after the schema, which must therefore not collide with a table name of the source schema.
+func (w *Worker) upsertTenants(ctx context.Context) error {
+	log.Println("Tenants")
+	pattern, err := regexp.Compile(w.config.TenantSchemaPattern)
+	if err != nil {
+		return err
+	}
+	schemas, err := listTables(ctx, w.snapshot, "SELECT nspname, nspname FROM pg_namespace WHERE nspname NOT IN ('pg_catalog', 'information_schema', 'pg_toast') AND nspname NOT LIKE '\\_timescaledb%' AND nspname NOT LIKE 'pg\\_temp\\_%' AND nspname NOT LIKE 'pg\\_toast\\_temp\\_%';", model.KindTenant)
+	if err != nil {
+		return err
+	}
+	tenants := []hypertable{}
+	for _, schema := range schemas {
+		if schema.schema != w.config.PostgresUsageSchema && pattern.MatchString(schema.schema) {
+			tenants = append(tenants, schema)
+		}
+	}
+	return w.upsertAll(ctx, tenants)
+}
@@ -0,0 +1,81 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+)
+
+// tieredAvailable checks for the object storage tiering extension (OSM) of TimescaleDB.
+func (w *Worker) tieredAvailable(ctx context.Context) (bool, error) {
+	if w.config.TieredSizeQuery == "" {
+		return false, nil
+	}
+	err := validateTieredSizeQuery(w.config.TieredSizeQuery)
+	if err != nil {
+		return false, err
+	}
+	var available bool
+	err = w.source.QueryRowEx(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb_osm');", nil).Scan(&available)
+	if err != nil {
+		return false, err
+	}
+	if !available {
+		log.Println("WARNING: tiered_size_query configured, but extension timescaledb_osm is not installed")
+	}
+	return available, nil
+}
+
+// validateTieredSizeQuery only accepts a single SELECT, optionally starting with WITH
+func validateTieredSizeQuery(query string) error {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	if strings.Contains(query, ";") {
+		return errors.New("tiered_size_query must be a single statement")
+	}
+	fields := strings.Fields(strings.ToUpper(query))
+	if len(fields) == 0 || (fields[0] != "SELECT" && fields[0] != "WITH") {
+		return errors.New("tiered_size_query must be a SELECT")
+	}
+	return nil
+}
+
+// loadTieredSizes runs the configured tiered_size_query, which has to return schema, table and bytes. It runs in the
+// read-only snapshot, so that it can not modify the source.
+func (w *Worker) loadTieredSizes(ctx context.Context) error {
+	w.tieredBytes = map[string]int64{}
+	if !w.tiered {
+		return nil
+	}
+	rows, err := w.snapshot.QueryEx(ctx, w.config.TieredSizeQuery, nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schema, table string
+		var bytes int64
+		err = rows.Scan(&schema, &table, &bytes)
+		if err != nil {
+			return err
+		}
+		w.tieredBytes[schema+"."+table] = bytes
+	}
+	return rows.Err()
+}
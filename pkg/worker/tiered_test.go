@@ -0,0 +1,42 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import "testing"
+
+func TestValidateTieredSizeQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		valid bool
+	}{
+		{"SELECT hypertable_schema, hypertable_name, 0 FROM timescaledb_osm.tiered_chunks", true},
+		{"  select 'a', 'b', 1;  ", true},
+		{"WITH t AS (SELECT 1) SELECT 'a', 'b', 1 FROM t", true},
+		{"SELECT\n'a', 'b', 1", true},
+		{"", false},
+		{";", false},
+		{"DELETE FROM usage.usage", false},
+		{"SELECT 1; DROP TABLE usage.usage", false},
+		{"SELECTX 1", false},
+	}
+	for _, test := range tests {
+		err := validateTieredSizeQuery(test.query)
+		if (err == nil) != test.valid {
+			t.Errorf("validateTieredSizeQuery(%q) = %v, expected valid %v", test.query, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// timescaleVersion is the TimescaleDB version of the source database, selecting the functions available in it
+type timescaleVersion struct {
+	major int
+	minor int
+}
+
+// the information views of TimescaleDB 1.x have a different layout and lack the chunks view
+var minTimescaleVersion = timescaleVersion{major: 2, minor: 0}
+
+func parseTimescaleVersion(version string) (v timescaleVersion, err error) {
+	parts := strings.SplitN(strings.SplitN(version, "-", 2)[0], ".", 3)
+	if len(parts) < 2 {
+		return v, fmt.Errorf("unable to parse TimescaleDB version %v", version)
+	}
+	v.major, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return v, fmt.Errorf("unable to parse TimescaleDB version %v", version)
+	}
+	v.minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return v, fmt.Errorf("unable to parse TimescaleDB version %v", version)
+	}
+	return v, nil
+}
+
+func (v timescaleVersion) atLeast(other timescaleVersion) bool {
+	return v.major > other.major || (v.major == other.major && v.minor >= other.minor)
+}
+
+func (v timescaleVersion) String() string {
+	return strconv.Itoa(v.major) + "." + strconv.Itoa(v.minor)
+}
+
+// timescaleDialect measures hypertables and continuous aggregates
+type timescaleDialect struct {
+	version timescaleVersion
+}
+
+func newTimescaleDialect(version string) (d timescaleDialect, err error) {
+	d.version, err = parseTimescaleVersion(version)
+	if err != nil {
+		return d, err
+	}
+	if !d.version.atLeast(minTimescaleVersion) {
+		return d, fmt.Errorf("TimescaleDB %v is not supported, at least %v is required", version, minTimescaleVersion)
+	}
+	return d, nil
+}
+
+func (d timescaleDialect) name() string {
+	return dialectTimescale
+}
+
+func (d timescaleDialect) timescale() bool {
+	return true
+}
+
+// sizeFunction is hypertable_approximate_size since 2.13, older versions only have the slower hypertable_size
+func (d timescaleDialect) sizeFunction() (function string, method string) {
+	if d.version.atLeast(timescaleVersion{major: 2, minor: 13}) {
+		return "hypertable_approximate_size", methodApproximate
+	}
+	return "hypertable_size", methodExact
+}
+
+func (d timescaleDialect) list(ctx context.Context, snapshot *pgx.Tx, config configuration.Config) (tables []hypertable, err error) {
+	tables, err = listTables(ctx, snapshot, "SELECT hypertable_schema, hypertable_name FROM timescaledb_information.hypertables;", model.KindHypertable)
+	if err != nil {
+		return nil, err
+	}
+	views, err := listTables(ctx, snapshot, "SELECT view_schema, view_name, hypertable_name FROM timescaledb_information.continuous_aggregates;", model.KindContinuousAggregate)
+	return append(tables, views...), err
+}
+
+var timescaleInformationViews = []string{
+	"timescaledb_information.hypertables",
+	"timescaledb_information.continuous_aggregates",
+	"timescaledb_information.chunks",
+	"timescaledb_information.dimensions",
+}
+
+func (d timescaleDialect) informationViews() []string {
+	return timescaleInformationViews
+}
+
+func (d timescaleDialect) unreadableTablesQuery() string {
+	return "SELECT format('%I.%I', hypertable_schema, hypertable_name) FROM timescaledb_information.hypertables WHERE hypertable_schema = $1 AND NOT has_table_privilege(format('%I.%I', hypertable_schema, hypertable_name), 'SELECT');"
+}
+
+// hypertables known to be larger than sampling_min_bytes are estimated as chunk count times the average size of
+// sampling_chunks random chunks. The size of a compressed chunk includes its compressed counterpart in the internal
+// compression schema, which show_chunks doesn't list.
+const sampledSizeQuery = `SELECT n.chunks, s.avg, s.stddev, s.samples, pg_get_userbyid(c.relowner)::text, c.oid::bigint
+FROM pg_class c,
+LATERAL (SELECT count(*) AS chunks FROM show_chunks(c.oid::regclass)) n,
+LATERAL (SELECT avg(sized.size)::DOUBLE PRECISION AS avg, coalesce(stddev_samp(sized.size), 0)::DOUBLE PRECISION AS stddev, count(*) AS samples
+	FROM (SELECT pg_total_relation_size(x) + coalesce((SELECT pg_total_relation_size(to_regclass(format('%I.%I', cc.schema_name, cc.table_name)))
+			FROM pg_class xc
+			JOIN pg_namespace xn ON xn.oid = xc.relnamespace
+			JOIN _timescaledb_catalog.chunk ch ON ch.schema_name = xn.nspname AND ch.table_name = xc.relname
+			JOIN _timescaledb_catalog.chunk cc ON cc.id = ch.compressed_chunk_id
+			WHERE xc.oid = x), 0) AS size
+		FROM (SELECT x FROM show_chunks(c.oid::regclass) x ORDER BY random() LIMIT $2) x) sized) s
+WHERE c.oid = $1::regclass;`
+
+func (d timescaleDialect) measureSize(ctx context.Context, snapshot *pgx.Tx, t hypertable, sampleChunks int, m *measurement) (err error) {
+	if t.kind == model.KindMaterializedView {
+		m.method, m.margin = methodExact, pgtype.Float8{Float: 0, Status: pgtype.Present}
+		return relationSize(ctx, snapshot, "pg_total_relation_size", t, m)
+	}
+	identifier := pgx.Identifier{t.schema, t.table}.Sanitize()
+	if sampleChunks > 0 && t.kind == model.KindHypertable {
+		m.method = methodSampled
+		var chunks, samples int64
+		var avg, stddev pgtype.Float8
+		err = snapshot.QueryRowEx(ctx, sampledSizeQuery, nil, identifier, sampleChunks).Scan(&chunks, &avg, &stddev, &samples, &m.owner, &m.relid)
+		if err != nil {
+			return err
+		}
+		if avg.Status == pgtype.Present {
+			m.size = pgtype.Int8{Int: int64(float64(chunks) * avg.Float), Status: pgtype.Present}
+			m.margin = sampleMargin(chunks, samples, avg.Float, stddev.Float)
+		}
+	} else {
+		var sizeFunction string
+		sizeFunction, m.method = d.sizeFunction()
+		if m.method == methodExact {
+			m.margin = pgtype.Float8{Float: 0, Status: pgtype.Present}
+		}
+		err = relationSize(ctx, snapshot, sizeFunction, t, m)
+		if err != nil {
+			return err
+		}
+	}
+	return snapshot.QueryRowEx(ctx, "SELECT count(*) FROM show_chunks($1::regclass);", nil, identifier).Scan(&m.chunks)
+}
+
+// sampleMargin is the relative 95% confidence interval of a size estimated from samples of all chunks. Without
+// the finite population correction, sampling every chunk would still leave a margin.
+func sampleMargin(chunks int64, samples int64, avg float64, stddev float64) pgtype.Float8 {
+	if samples >= chunks || avg == 0 {
+		return pgtype.Float8{Float: 0, Status: pgtype.Present}
+	}
+	correction := math.Sqrt(float64(chunks-samples) / float64(chunks-1))
+	return pgtype.Float8{Float: 1.96 * stddev / math.Sqrt(float64(samples)) * correction / avg, Status: pgtype.Present}
+}
+
+// a tenant is the sum of all hypertables, materialization hypertables of continuous aggregates and plain tables of its
+// schema. Chunks are stored in the internal schemas and are only counted through their hypertable.
+// hypertable_approximate_size is replaced by the size function of the TimescaleDB version.
+const tenantSizeQuery = `SELECT (coalesce(sum(CASE WHEN h.hypertable_name IS NULL THEN pg_total_relation_size(c.oid) ELSE hypertable_approximate_size(c.oid) END), 0)
++ coalesce((SELECT sum(hypertable_approximate_size(format('%I.%I', a.materialization_hypertable_schema, a.materialization_hypertable_name)::regclass)) FROM timescaledb_information.continuous_aggregates a WHERE a.view_schema = n.nspname), 0))::bigint,
+pg_get_userbyid(n.nspowner)::text
+FROM pg_namespace n
+LEFT JOIN pg_class c ON c.relnamespace = n.oid AND c.relkind IN ('r', 'm')
+LEFT JOIN timescaledb_information.hypertables h ON h.hypertable_schema = n.nspname AND h.hypertable_name = c.relname
+WHERE n.nspname = $1
+GROUP BY n.oid, n.nspname, n.nspowner;`
+
+func (d timescaleDialect) measureTenant(ctx context.Context, snapshot *pgx.Tx, schema string, m *measurement) error {
+	sizeFunction, method := d.sizeFunction()
+	m.method = method
+	return snapshot.QueryRowEx(ctx, strings.ReplaceAll(tenantSizeQuery, "hypertable_approximate_size", sizeFunction), nil, schema).Scan(&m.size, &m.owner)
+}
@@ -0,0 +1,97 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jackc/pgx/pgtype"
+)
+
+func TestParseTimescaleVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected timescaleVersion
+		err      bool
+	}{
+		{"2.14.2", timescaleVersion{major: 2, minor: 14}, false},
+		{"2.9", timescaleVersion{major: 2, minor: 9}, false},
+		{"2.15.0-dev", timescaleVersion{major: 2, minor: 15}, false},
+		{"1.7.5", timescaleVersion{major: 1, minor: 7}, false},
+		{"2", timescaleVersion{}, true},
+		{"", timescaleVersion{}, true},
+		{"two.one", timescaleVersion{}, true},
+		{"2.x", timescaleVersion{}, true},
+	}
+	for _, test := range tests {
+		actual, err := parseTimescaleVersion(test.version)
+		if (err != nil) != test.err {
+			t.Errorf("parseTimescaleVersion(%q) error = %v, expected error %v", test.version, err, test.err)
+			continue
+		}
+		if !test.err && actual != test.expected {
+			t.Errorf("parseTimescaleVersion(%q) = %v, expected %v", test.version, actual, test.expected)
+		}
+	}
+}
+
+func TestTimescaleVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		v        timescaleVersion
+		other    timescaleVersion
+		expected bool
+	}{
+		{timescaleVersion{2, 14}, timescaleVersion{2, 14}, true},
+		{timescaleVersion{2, 14}, timescaleVersion{2, 9}, true},
+		{timescaleVersion{2, 9}, timescaleVersion{2, 14}, false},
+		{timescaleVersion{3, 0}, timescaleVersion{2, 14}, true},
+		{timescaleVersion{1, 7}, minTimescaleVersion, false},
+	}
+	for _, test := range tests {
+		if actual := test.v.atLeast(test.other); actual != test.expected {
+			t.Errorf("%v.atLeast(%v) = %v, expected %v", test.v, test.other, actual, test.expected)
+		}
+	}
+}
+
+func TestSampleMargin(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   int64
+		samples  int64
+		avg      float64
+		stddev   float64
+		expected float64
+	}{
+		{"all chunks sampled", 10, 10, 100, 20, 0},
+		{"more samples than chunks", 5, 10, 100, 20, 0},
+		{"empty chunks", 100, 10, 0, 0, 0},
+		{"equal chunks", 100, 10, 100, 0, 0},
+		{"sampled", 101, 25, 100, 20, 1.96 * 20 / 5 * math.Sqrt(76.0/100.0) / 100},
+	}
+	for _, test := range tests {
+		actual := sampleMargin(test.chunks, test.samples, test.avg, test.stddev)
+		if actual.Status != pgtype.Present {
+			t.Errorf("%v: margin not present", test.name)
+			continue
+		}
+		if math.Abs(actual.Float-test.expected) > 1e-12 {
+			t.Errorf("%v: sampleMargin = %v, expected %v", test.name, actual.Float, test.expected)
+		}
+	}
+}
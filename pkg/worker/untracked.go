@@ -0,0 +1,43 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+)
+
+// updateSummary compares the database size with the local size of all tracked tables. Tiered bytes are excluded,
+// since they are not part of the database size, and so are tenants, whose tables are tracked on their own.
+func (w *Worker) updateSummary(ctx context.Context) error {
+	var databaseBytes, trackedBytes int64
+	err := w.conn.QueryRowEx(ctx, fmt.Sprintf("SELECT pg_database_size(current_database()), coalesce(sum(coalesce(bytes_local, bytes)), 0)::bigint FROM %v.usage WHERE kind IS DISTINCT FROM $1;", w.config.PostgresUsageSchema), nil, model.KindTenant).Scan(&databaseBytes, &trackedBytes)
+	if err != nil {
+		return err
+	}
+	untrackedBytes := databaseBytes - trackedBytes
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_summary (id, database_bytes, tracked_bytes, untracked_bytes, updated_at) VALUES (1, $1, $2, $3, now()) ON CONFLICT (id) DO UPDATE SET database_bytes = $1, tracked_bytes = $2, untracked_bytes = $3, updated_at = now();", w.config.PostgresUsageSchema), nil, databaseBytes, trackedBytes, untrackedBytes)
+	if err != nil {
+		return err
+	}
+	w.metrics.untrackedBytes.Set(float64(untrackedBytes))
+	log.Printf("Database size: %v bytes, untracked: %v bytes\n", databaseBytes, untrackedBytes)
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/pgtype"
+)
+
+// the vacuum lag of a hypertable is the oldest (auto)vacuum of any chunk still holding dead tuples
+const deadTuplesQuery = `SELECT c.hypertable_name, coalesce(sum(s.n_dead_tup), 0)::bigint, coalesce(sum(s.n_live_tup), 0)::bigint,
+min(greatest(s.last_autovacuum, s.last_vacuum)) FILTER (WHERE s.n_dead_tup > 0)
+FROM timescaledb_information.chunks c
+JOIN pg_stat_user_tables s ON s.relid = format('%I.%I', c.chunk_schema, c.chunk_name)::regclass
+WHERE c.hypertable_schema = $1
+GROUP BY 1;`
+
+// updateDeadTuples reports dead tuples not yet reclaimed by autovacuum, which are billed without holding data
+func (w *Worker) updateDeadTuples(ctx context.Context) error {
+	log.Println("Dead tuples")
+	rows, err := w.snapshot.QueryEx(ctx, deadTuplesQuery, nil, w.config.PostgresSourceSchema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type entry struct {
+		table                  string
+		deadTuples, liveTuples int64
+		lastVacuum             pgtype.Timestamptz
+	}
+	entries := []entry{}
+	for rows.Next() {
+		e := entry{}
+		err = rows.Scan(&e.table, &e.deadTuples, &e.liveTuples, &e.lastVacuum)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	for _, e := range entries {
+		var lastVacuum *time.Time
+		if e.lastVacuum.Status == pgtype.Present {
+			lastVacuum = &e.lastVacuum.Time
+			w.metrics.lastVacuum.WithLabelValues(e.table).Set(float64(e.lastVacuum.Time.Unix()))
+		} else {
+			w.metrics.lastVacuum.DeleteLabelValues(e.table)
+		}
+		_, err = w.conn.ExecEx(ctx, fmt.Sprintf("UPDATE %v.usage SET dead_tuples = $2, live_tuples = $3, last_vacuum = $4 WHERE \"table\" = $1;", w.config.PostgresUsageSchema), nil, e.table, e.deadTuples, e.liveTuples, lastVacuum)
+		if err != nil {
+			return err
+		}
+		w.metrics.deadTuples.WithLabelValues(e.table).Set(float64(e.deadTuples))
+	}
+	return nil
+}
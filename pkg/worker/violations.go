@@ -0,0 +1,184 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/notifier"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// Quota violations escalate from warning (usage above quota_warning_ratio) to grace (quota exceeded, grace period
+// running) to enforced (grace period expired). Violations are resolved once usage drops below the warning ratio.
+// The grace period starts when the quota is first exceeded and is not restarted by dropping back to warning.
+// A quota of 0 bytes is exceeded by any usage.
+const (
+	violationStateWarning  = "warning"
+	violationStateGrace    = "grace"
+	violationStateEnforced = "enforced"
+	violationStateResolved = "resolved"
+)
+
+var violationEvents = map[string]string{
+	violationStateWarning:  notifier.EventKindQuotaWarning,
+	violationStateGrace:    notifier.EventKindQuotaGrace,
+	violationStateEnforced: notifier.EventKindQuotaEnforced,
+	violationStateResolved: notifier.EventKindQuotaResolved,
+}
+
+type violation struct {
+	id            int64
+	state         string
+	graceUntil    time.Time
+	overrideUntil time.Time
+	exceededAt    time.Time
+}
+
+// overridden violations are not enforced until the override expires
+func (v violation) overridden(now time.Time) bool {
+	return now.Before(v.overrideUntil)
+}
+
+func (w *Worker) getOpenViolation(ctx context.Context, kind string, subject string) (v violation, ok bool, err error) {
+	var graceUntil, overrideUntil, exceededAt pgtype.Timestamptz
+	err = w.conn.QueryRowEx(ctx, fmt.Sprintf("SELECT id, state, grace_until, override_until, exceeded_at FROM %v.usage_violations WHERE kind = $1 AND subject = $2 AND state <> $3;", w.config.PostgresUsageSchema), nil, kind, subject, violationStateResolved).Scan(&v.id, &v.state, &graceUntil, &overrideUntil, &exceededAt)
+	if err == pgx.ErrNoRows {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, err
+	}
+	v.graceUntil = graceUntil.Time
+	v.overrideUntil = overrideUntil.Time
+	v.exceededAt = exceededAt.Time
+	return v, true, nil
+}
+
+func (w *Worker) nextViolationState(q quotaUsage, current violation, open bool, now time.Time) string {
+	if q.used > q.limit {
+		switch {
+		case open && current.state == violationStateEnforced:
+			return violationStateEnforced
+		case open && !current.graceUntil.IsZero() && !now.Before(current.graceUntil):
+			return violationStateEnforced
+		default:
+			return violationStateGrace
+		}
+	}
+	if q.limit > 0 && float64(q.used) >= w.config.QuotaWarningRatio*float64(q.limit) {
+		return violationStateWarning
+	}
+	return violationStateResolved
+}
+
+func (w *Worker) updateViolation(ctx context.Context, q quotaUsage, now time.Time) error {
+	current, open, err := w.getOpenViolation(ctx, q.kind, q.subject)
+	if err != nil {
+		return err
+	}
+	next := w.nextViolationState(q, current, open, now)
+	err = w.applyWriteBlock(ctx, q, next == violationStateEnforced && !(open && current.overridden(now)))
+	if err != nil {
+		return err
+	}
+	if !open && next == violationStateResolved {
+		return nil
+	}
+	if open && next == current.state {
+		_, err = w.conn.ExecEx(ctx, fmt.Sprintf("UPDATE %v.usage_violations SET bytes = $2, quota_bytes = $3, updated_at = $4 WHERE id = $1;", w.config.PostgresUsageSchema), nil, current.id, q.used, q.limit, now)
+		if err != nil {
+			return err
+		}
+		w.notify(notifier.Event{Kind: violationEvents[next], QuotaKind: q.kind, Subject: q.subject, Bytes: q.used, Threshold: q.limit, GraceUntil: current.graceUntil, Time: now, Repeat: true})
+		return nil
+	}
+
+	graceUntil, exceededAt := current.graceUntil, current.exceededAt
+	// violations opened before exceeded_at was recorded keep their grace period
+	if next == violationStateGrace && exceededAt.IsZero() && graceUntil.IsZero() {
+		gracePeriod, err := time.ParseDuration(w.config.QuotaGracePeriod)
+		if err != nil {
+			return err
+		}
+		exceededAt = now
+		graceUntil = now.Add(gracePeriod)
+	}
+	graceUntilValue := pgtype.Timestamptz{Status: pgtype.Null}
+	if !graceUntil.IsZero() {
+		graceUntilValue = pgtype.Timestamptz{Time: graceUntil, Status: pgtype.Present}
+	}
+	exceededAtValue := pgtype.Timestamptz{Status: pgtype.Null}
+	if !exceededAt.IsZero() {
+		exceededAtValue = pgtype.Timestamptz{Time: exceededAt, Status: pgtype.Present}
+	}
+
+	if open {
+		resolvedAt := pgtype.Timestamptz{Status: pgtype.Null}
+		if next == violationStateResolved {
+			resolvedAt = pgtype.Timestamptz{Time: now, Status: pgtype.Present}
+		}
+		_, err = w.conn.ExecEx(ctx, fmt.Sprintf("UPDATE %v.usage_violations SET state = $2, bytes = $3, quota_bytes = $4, grace_until = $5, updated_at = $6, resolved_at = $7, exceeded_at = $8 WHERE id = $1;", w.config.PostgresUsageSchema), nil, current.id, next, q.used, q.limit, &graceUntilValue, now, &resolvedAt, &exceededAtValue)
+	} else {
+		_, err = w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_violations (kind, subject, state, bytes, quota_bytes, grace_until, created_at, updated_at, exceeded_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8);", w.config.PostgresUsageSchema), nil, q.kind, q.subject, next, q.used, q.limit, &graceUntilValue, now, &exceededAtValue)
+	}
+	if err != nil {
+		return err
+	}
+	w.notify(notifier.Event{Kind: violationEvents[next], QuotaKind: q.kind, Subject: q.subject, Bytes: q.used, Threshold: q.limit, GraceUntil: graceUntil, Time: now})
+	return nil
+}
+
+func (w *Worker) updateViolations(ctx context.Context, quotas []quotaUsage) error {
+	now := time.Now()
+	for _, q := range quotas {
+		err := w.updateViolation(ctx, q, now)
+		if err != nil {
+			return err
+		}
+	}
+	// quotas may have been deleted
+	err := w.unblockOrphans(ctx)
+	if err != nil {
+		return err
+	}
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("UPDATE %[1]v.usage_violations v SET state = $1, resolved_at = $2, updated_at = $2 WHERE state <> $1 AND NOT EXISTS (SELECT 1 FROM %[1]v.usage_quotas q WHERE q.kind = v.kind AND q.subject = v.subject) RETURNING kind, subject, coalesce(bytes, 0);", w.config.PostgresUsageSchema), nil, violationStateResolved, now)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	events := []notifier.Event{}
+	for rows.Next() {
+		event := notifier.Event{Kind: notifier.EventKindQuotaResolved, Time: now}
+		err = rows.Scan(&event.QuotaKind, &event.Subject, &event.Bytes)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+	for _, event := range events {
+		w.notify(event)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+)
+
+func TestNextViolationState(t *testing.T) {
+	w := &Worker{config: &configuration.ConfigStruct{QuotaWarningRatio: 0.8}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	grace := violation{state: violationStateGrace, graceUntil: now.Add(time.Hour), exceededAt: now.Add(-time.Hour)}
+	expired := violation{state: violationStateGrace, graceUntil: now, exceededAt: now.Add(-time.Hour)}
+	warningAfterGrace := violation{state: violationStateWarning, graceUntil: now.Add(-time.Minute), exceededAt: now.Add(-time.Hour)}
+	tests := []struct {
+		name     string
+		used     int64
+		limit    int64
+		current  violation
+		open     bool
+		expected string
+	}{
+		{"below warning", 70, 100, violation{}, false, violationStateResolved},
+		{"warning", 80, 100, violation{}, false, violationStateWarning},
+		{"at quota", 100, 100, violation{}, false, violationStateWarning},
+		{"exceeded", 101, 100, violation{}, false, violationStateGrace},
+		{"grace running", 101, 100, grace, true, violationStateGrace},
+		{"grace expired", 101, 100, expired, true, violationStateEnforced},
+		{"enforced stays", 101, 100, violation{state: violationStateEnforced}, true, violationStateEnforced},
+		{"enforced drops to warning", 90, 100, violation{state: violationStateEnforced}, true, violationStateWarning},
+		{"grace not restarted by warning", 101, 100, warningAfterGrace, true, violationStateEnforced},
+		{"zero quota unused", 0, 0, violation{}, false, violationStateResolved},
+		{"zero quota used", 1, 0, violation{}, false, violationStateGrace},
+	}
+	for _, test := range tests {
+		actual := w.nextViolationState(quotaUsage{used: test.used, limit: test.limit}, test.current, test.open, now)
+		if actual != test.expected {
+			t.Errorf("%v: nextViolationState = %v, expected %v", test.name, actual, test.expected)
+		}
+	}
+}
+
+func TestQuotaUsageRatio(t *testing.T) {
+	tests := []struct {
+		used     int64
+		limit    int64
+		expected float64
+	}{
+		{50, 100, 0.5},
+		{150, 100, 1.5},
+		{0, 0, 0},
+	}
+	for _, test := range tests {
+		if actual := (quotaUsage{used: test.used, limit: test.limit}).ratio(); actual != test.expected {
+			t.Errorf("ratio of %v/%v = %v, expected %v", test.used, test.limit, actual, test.expected)
+		}
+	}
+	if ratio := (quotaUsage{used: 1, limit: 0}).ratio(); ratio <= 1 {
+		t.Error("exceeded zero quota has ratio", ratio)
+	}
+}
@@ -18,50 +18,113 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/SENERGY-Platform/timescale-usage/pkg/configuration"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/database"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/debug"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/SENERGY-Platform/timescale-usage/pkg/notifier"
 	"github.com/jackc/pgx"
 	"github.com/jackc/pgx/pgtype"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 type Worker struct {
-	conn         *pgx.ConnPool
-	config       configuration.Config
-	bytesMetrics *prometheus.GaugeVec
+	conn           *pgx.ConnPool
+	source         *pgx.ConnPool // read-only with source_read_only
+	config         configuration.Config
+	metrics        *metrics
+	runStartedAt   time.Time
+	runId          int64 // id in usage_runs, reserved at the start of the run, 0 if that failed
+	running        sync.Mutex
+	snapshot       *pgx.Tx
+	snapshotTables int // tables measured in the current snapshot, see renewSnapshot
+	listedTables   []string
+	listedSizes    map[string]int64
+
+	// resuming aborted runs with max_run_duration
+	deadline       time.Time
+	cursor         string // last table processed by the aborted run, see cursorKey
+	lastProcessed  string
+	cachedTables   []string
+	aborted        bool
+	stop           context.Context // cancelled on shutdown, the run then stops like with max_run_duration
+	previousSizes  map[string]int64
+	dates          map[string]tableDates      // prefetched by prefetchDates, by cursor key
+	prefetched     map[string]prefetchedUsage // prefetched by prefetchUsage, by cursor key
+	statements     map[string]string          // recurring statements by name, see prepare
+	historyRows    [][]interface{}            // buffered for flushHistory
+	forecastTables []string                   // tables to update the seasonal forecast of after flushHistory
+
+	shard        int // 0 without sharding
+	host         string
+	shardTimeout time.Duration
+
+	tablesDone    int64
+	tablesTotal   int64
+	tiered        bool
+	dialect       dialect
+	tieredBytes   map[string]int64
+	notifier      notifier.Notifier
+	exportId      *regexp.Regexp // first submatch of a table name is the export id
+	shutdownGrace time.Duration  // time the current table gets to finish after shutdown, 0 waits for it
+	slowTable     time.Duration  // collection time above which the plan of a table is explained, 0 disables, see explainSlowTable
+	benchmark     bool           // measures the generated tables only, see Benchmark
 }
 
 func Start(ctx context.Context, config configuration.Config) error {
-	conn, err := pgx.NewConnPool(pgx.ConnPoolConfig{
-		ConnConfig: pgx.ConnConfig{
-			Host:     config.PostgresHost,
-			Port:     config.PostgresPort,
-			Database: config.PostgresDb,
-			User:     config.PostgresUser,
-			Password: config.PostgresPw,
-		},
-		MaxConnections: 10,
-		AcquireTimeout: 0})
+	err := validateSourceReadOnly(config)
+	if err != nil {
+		return err
+	}
+
+	conn, err := database.Connect(config, "worker")
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	bytesMetrics := promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "timescale_table_size_bytes", Help: "Table size in bytes"}, []string{"table"})
+	source, err := database.ConnectSource(config, "worker")
+	if err != nil {
+		return err
+	}
+	defer source.Close()
 
-	w := &Worker{conn: conn, config: config, bytesMetrics: bytesMetrics}
-	err = w.migrate()
+	n, err := notifier.New(config)
 	if err != nil {
 		return err
 	}
 
+	w := &Worker{conn: conn, source: source, config: config, metrics: newMetrics(config), notifier: n}
+	err = w.init(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.metrics.connected.Set(1)
+	if config.HealthCheckInterval != "" {
+		err = w.startHealthCheck(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	if len(config.Duration) == 0 {
-		return w.run()
+		err = w.run(ctx)
+		if errors.Is(err, errRunInterrupted) {
+			return nil
+		}
+		return err
 	}
 
 	d, err := time.ParseDuration(config.Duration)
@@ -71,39 +134,388 @@ func Start(ctx context.Context, config configuration.Config) error {
 
 	ticker := time.NewTicker(d) // start ticker early, since run() takes some time
 
-	err = w.run() // run once at startup
+	err = w.run(ctx) // run once at startup
+	if errors.Is(err, errRunInterrupted) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	w.skipOverlappingTick(ticker)
 
 	for {
 		select {
 		case <-ticker.C:
-			err = w.run()
+			err = w.run(ctx)
+			if errors.Is(err, errRunInterrupted) {
+				return nil
+			}
 			if err != nil {
+				// lost connections are reestablished by the health check, the next tick will retry
+				if !w.checkHealth(ctx) {
+					log.Println("ERROR: run failed due to database connection:", err)
+					continue
+				}
 				return err
 			}
+			w.skipOverlappingTick(ticker)
 		case <-ctx.Done():
 			return nil
 		}
 	}
 }
 
-func (w *Worker) run() (err error) {
+// init validates the configuration, selects the dialect and migrates the usage schema
+func (w *Worker) init(ctx context.Context) (err error) {
+	if w.sharded() {
+		w.shard, err = shardIndex(w.config.ShardIndex, w.config.ShardIndexFromHostname)
+		if err != nil {
+			return err
+		}
+	}
+	err = checkLogTableNames(w.config.LogTableNames)
+	if err != nil {
+		return err
+	}
+	if w.config.ExportIdPattern != "" {
+		w.exportId, err = regexp.Compile(w.config.ExportIdPattern)
+		if err != nil {
+			return err
+		}
+	}
+	if w.config.ShutdownGracePeriod != "" {
+		w.shutdownGrace, err = time.ParseDuration(w.config.ShutdownGracePeriod)
+		if err != nil {
+			return err
+		}
+	}
+	if w.config.SlowTableDuration != "" {
+		w.slowTable, err = time.ParseDuration(w.config.SlowTableDuration)
+		if err != nil {
+			return err
+		}
+	}
+	description, err := w.selectDialect(ctx)
+	if err != nil {
+		return err
+	}
+	log.Println("Dialect", description)
+	if !w.dialect.timescale() {
+		log.Println("WARNING: tracking plain tables of", w.config.PostgresSourceSchema, "without TimescaleDB")
+	}
+
+	err = w.preflight(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.migrate(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.prepare(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.registerShard(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.tiered, err = w.tieredAvailable(ctx)
+	return err
+}
+
+const runOverlapQueue = "queue"
+
+// skipOverlappingTick drops a tick that arrived while the last run was still going, unless run_overlap is queue,
+// in which case the next run starts right away
+func (w *Worker) skipOverlappingTick(ticker *time.Ticker) {
+	if w.config.RunOverlap == runOverlapQueue {
+		return
+	}
+	select {
+	case <-ticker.C:
+		w.metrics.skippedRuns.Inc()
+		log.Println("WARNING: run took longer than duration, skipped tick")
+	default:
+	}
+}
+
+// graceContext is not cancelled with stop, but shutdown_grace_period after it, so that a run can finish its table
+// without hanging on a query for ever
+func (w *Worker) graceContext(stop context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(stop))
+	if w.shutdownGrace <= 0 {
+		return ctx, cancel
+	}
+	unregister := context.AfterFunc(stop, func() {
+		select {
+		case <-time.After(w.shutdownGrace):
+			log.Println("WARNING: shutdown_grace_period exceeded, cancelling run")
+			cancel()
+		case <-ctx.Done():
+		}
+	})
+	return ctx, func() {
+		unregister()
+		cancel()
+	}
+}
+
+var errRunInterrupted = errors.New("run interrupted")
+
+// run measures all tables. On shutdown, the table currently measured is finished and the progress is flushed. Queries
+// still running after shutdown_grace_period are cancelled.
+func (w *Worker) run(ctx context.Context) (err error) {
+	// guards the shared run state from concurrent triggers
+	if !w.running.TryLock() {
+		w.metrics.skippedRuns.Inc()
+		log.Println("WARNING: run still in progress, skipped")
+		return nil
+	}
+	defer w.running.Unlock()
+	defer func() {
+		if err != nil && !errors.Is(err, errRunInterrupted) {
+			w.notify(notifier.Event{Kind: notifier.EventKindRunFailed, Error: err.Error(), Time: time.Now()})
+		}
+	}()
+	w.stop = ctx
+	ctx, cancel := w.graceContext(ctx)
+	defer cancel()
 	log.Println("Starting Update..")
-	err = w.upsertTables()
+	w.runStartedAt = time.Now()
+	w.runId = 0
+	w.listedTables = []string{}
+	w.listedSizes = map[string]int64{}
+	err = w.heartbeat(ctx)
+	if err != nil {
+		return err
+	}
+	err = w.startStatus(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the run status is recorded even if the grace period cancelled the run
+		ctx := context.WithoutCancel(ctx)
+		statusErr := w.finishStatus(ctx, err)
+		if statusErr != nil {
+			log.Println("WARNING: unable to update run status", statusErr)
+		}
+		statusErr = w.recordRun(ctx, err)
+		if statusErr != nil {
+			log.Println("WARNING: unable to record run", statusErr)
+		}
+	}()
+	err = w.startCursor(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = w.upsertViews()
+	// information views and source tables are read from a snapshot, which is renewed every snapshot_tables tables,
+	// so that the run doesn't hold locks on measured tables and doesn't hold back vacuum until it is done
+	err = w.beginSnapshot(ctx)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		w.snapshot.Rollback()
+	}()
 
-	// Cleanup outdated
+	err = w.loadTieredSizes(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.upsertSources(ctx)
+	if err != nil {
+		return err
+	}
+
+	if w.config.PartitionedTables {
+		err = w.upsertPartitionedTables(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.MaterializedViews {
+		err = w.upsertMaterializedViews(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.TenantSchemaPattern != "" {
+		err = w.upsertTenants(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.markCached(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.saveCursor(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.metrics.sizes.set(w.listedSizes)
+	if w.metrics.topK != nil {
+		w.limitToTopK()
+	}
+
+	if w.stop.Err() != nil {
+		log.Println("Interrupted after", w.logName(w.lastProcessed))
+		return errRunInterrupted
+	}
+
+	if !w.leader() {
+		log.Println("Done with shard", w.shard)
+		return nil
+	}
+
+	if w.dialect.timescale() {
+		err = w.updateIngestRates(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = w.updateDeadTuples(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.ColumnSizesTables > 0 {
+		err = w.estimateColumnSizes(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.DeviceUsageTables > 0 && w.config.DeviceColumn != "" {
+		err = w.estimateDeviceUsage(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.TablespaceSizes && w.dialect.timescale() {
+		err = w.upsertTablespaces(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.CompressionSuggestionMinBytes > 0 && w.dialect.timescale() {
+		err = w.suggestCompression(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.ReorderSuggestionMinScans > 0 && w.dialect.timescale() {
+		err = w.suggestReorder(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.WideTableMinRowBytes > 0 || w.config.WideTableMinNullColumns > 0 {
+		err = w.suggestWideTables(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.chunkTargetBytes() > 0 && w.dialect.timescale() {
+		err = w.suggestChunkIntervals(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.CompressionEnforce && w.dialect.timescale() {
+		err = w.enforceCompression(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.trackLifecycle(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Cleanup outdated, the owners of dropped tables are kept for billing their history
 	log.Println("Cleanup")
-	_, err = w.conn.Exec(fmt.Sprintf("DELETE FROM %v.usage where \"table\" NOT IN (SELECT hypertable_name FROM timescaledb_information.hypertables  WHERE hypertable_schema = '%v') AND \"table\" NOT IN (SELECT view_name FROM timescaledb_information.continuous_aggregates WHERE view_schema = '%v');", w.config.PostgresUsageSchema, w.config.PostgresSourceSchema, w.config.PostgresSourceSchema))
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf(keepDroppedOwnersQuery, w.config.PostgresUsageSchema), nil, w.listedTables)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage where NOT (\"table\" = ANY($1));", w.config.PostgresUsageSchema), nil, w.listedTables)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_size_comparison where NOT (\"table\" = ANY($1));", w.config.PostgresUsageSchema), nil, w.listedTables)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_by_month where NOT (\"table\" = ANY($1)) OR NOT $2;", w.config.PostgresUsageSchema), nil, w.listedTables, w.config.SizeByMonth)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_by_partition where NOT (\"table\" = ANY($1));", w.config.PostgresUsageSchema), nil, w.listedTables)
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_query_plans where NOT (\"table\" = ANY($1));", w.config.PostgresUsageSchema), nil, w.listedTables)
+	if err != nil {
+		return err
+	}
+
+	if w.config.QueryStats {
+		err = w.updateQueryStats(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.checkQuotas(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.updateSummary(ctx)
+	if err != nil {
+		return err
+	}
+
+	if w.config.AccountingUrl != "" {
+		err = w.enqueueAccounting(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.purge(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.downsample(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.monitorSelf(ctx)
 	if err != nil {
 		return err
 	}
@@ -112,30 +524,136 @@ func (w *Worker) run() (err error) {
 	return nil
 }
 
-func (w *Worker) upsertTables() error {
-	return w.upsertWithQuery("SELECT hypertable_schema, hypertable_name, hypertable_approximate_size(format('%I.%I', hypertable_schema, hypertable_name)::regclass)  FROM timescaledb_information.hypertables;")
+const keepDroppedOwnersQuery = `INSERT INTO %[1]v.usage_dropped ("table", owner, kind, tenant, dropped_at, source_user)
+SELECT "table", owner, kind, tenant, now(), source_user FROM %[1]v.usage WHERE NOT ("table" = ANY($1))
+ON CONFLICT ("table") DO UPDATE SET owner = EXCLUDED.owner, kind = EXCLUDED.kind, tenant = EXCLUDED.tenant, dropped_at = EXCLUDED.dropped_at, source_user = EXCLUDED.source_user;`
+
+type hypertable struct {
+	schema string
+	table  string
+	kind   string
+	source string // hypertable of a continuous aggregate
 }
 
-func (w *Worker) upsertViews() error {
-	return w.upsertWithQuery("SELECT view_schema, view_name, hypertable_approximate_size(format('%I.%I', view_schema, view_name)::regclass) FROM timescaledb_information.continuous_aggregates;")
+// upsertSources measures the tables and views listed by the dialect
+func (w *Worker) upsertSources(ctx context.Context) error {
+	tables, err := w.dialect.list(ctx, w.snapshot, w.config)
+	if err != nil {
+		return err
+	}
+	if w.benchmark {
+		tables = slices.DeleteFunc(tables, func(t hypertable) bool {
+			return t.schema != w.config.PostgresSourceSchema
+		})
+	}
+	return w.upsertAll(ctx, tables)
 }
 
-func (w *Worker) upsertWithQuery(query string) error {
-	rows, err := w.conn.Query(query)
+func (w *Worker) upsertMaterializedViews(ctx context.Context) error {
+	return w.upsertWithQuery(ctx, "SELECT schemaname, matviewname FROM pg_matviews WHERE schemaname NOT IN ('pg_catalog', 'information_schema') AND schemaname NOT LIKE '\\_timescaledb%';", model.KindMaterializedView)
+}
+
+func (w *Worker) upsertWithQuery(ctx context.Context, query string, kind string) error {
+	tables, err := listTables(ctx, w.snapshot, query, kind)
 	if err != nil {
 		return err
 	}
-	for rows.Next() {
-		var size pgtype.Int8
-		var schema, table string
-		err = rows.Scan(&schema, &table, &size)
+	return w.upsertAll(ctx, tables)
+}
+
+// beginSnapshot starts the read-only transaction on source all measurements are read from
+func (w *Worker) beginSnapshot(ctx context.Context) (err error) {
+	w.snapshot, err = w.source.BeginEx(ctx, &pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	w.snapshotTables = 0
+	if w.config.LockTimeout != "" {
+		_, err = w.snapshot.ExecEx(ctx, "SELECT set_config('lock_timeout', $1, true);", nil, w.config.LockTimeout)
 		if err != nil {
 			return err
 		}
-		err = w.upsert(schema, table, size)
+	}
+	return nil
+}
+
+// renewSnapshot replaces the snapshot with a new transaction once snapshot_tables tables have been measured in it,
+// which releases the locks taken on those tables. Tables dropped in between are handled like tables dropped mid-run.
+func (w *Worker) renewSnapshot(ctx context.Context) error {
+	w.snapshotTables++
+	if w.config.SnapshotTables <= 0 || w.snapshotTables <= w.config.SnapshotTables {
+		return nil
+	}
+	err := w.snapshot.Rollback()
+	if err != nil {
+		return err
+	}
+	err = w.beginSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	w.snapshotTables = 1
+	return nil
+}
+
+func (w *Worker) upsertAll(ctx context.Context, tables []hypertable) (err error) {
+	defer func() {
+		flushErr := w.flushHistory(ctx)
+		if err == nil {
+			err = flushErr
+		}
+	}()
+	sortTables(tables)
+	for _, t := range tables {
+		if t.schema == w.config.PostgresSourceSchema || t.kind == model.KindTenant {
+			w.listedTables = append(w.listedTables, t.table)
+		}
+		if w.inShard(t) {
+			w.tablesTotal++
+		}
+	}
+	w.dates = map[string]tableDates{}
+	w.prefetched = map[string]prefetchedUsage{}
+	for i, t := range tables {
+		if !w.inShard(t) {
+			continue
+		}
+		w.tablesDone++
+		if w.skipTable(t) {
+			w.keepTable(t)
+			continue
+		}
+		err = w.prefetchDates(ctx, tables[i:])
+		if err != nil {
+			return err
+		}
+		err = w.prefetchUsage(ctx, tables[i:])
+		if err != nil {
+			return err
+		}
+		err = w.renewSnapshot(ctx)
+		if err != nil {
+			return err
+		}
+		w.lastProcessed = cursorKey(t)
+		err = w.updateStatus(ctx, t.table)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		err = w.upsert(ctx, t)
+		took := time.Since(start)
+		debug.Printf("measured %v %v in %v", t.kind, w.logName(t.table), took)
+		if err == nil {
+			err = w.explainSlowTable(ctx, t, took)
+		}
 		if err != nil {
 			if errIsTableDoesNotExist(err) {
-				log.Println("WARNING: Table " + table + " seems to no longer exist")
+				log.Println("WARNING: Table " + w.logName(t.table) + " seems to no longer exist")
+				continue
+			}
+			if errIsLockTimeout(err) {
+				log.Println("WARNING: Table " + w.logName(t.table) + " is locked, skipped this run")
 				continue
 			}
 			return err
@@ -144,44 +662,251 @@ func (w *Worker) upsertWithQuery(query string) error {
 	return nil
 }
 
-func (w *Worker) upsert(schema string, table string, size pgtype.Int8) (err error) {
+// listTables lists schema and name of tables of one kind, a third column is the source of continuous aggregates
+func listTables(ctx context.Context, snapshot *pgx.Tx, query string, kind string, args ...interface{}) (tables []hypertable, err error) {
+	rows, err := snapshot.QueryEx(ctx, query, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := hypertable{kind: kind}
+		dest := []interface{}{&t.schema, &t.table}
+		if len(rows.FieldDescriptions()) > 2 {
+			dest = append(dest, &t.source)
+		}
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func (w *Worker) upsert(ctx context.Context, t hypertable) (err error) {
 	now := time.Now()
+	schema, table := t.schema, t.table
 
-	var tableSizeBytes int64 = 0
-	if size.Get() != nil {
-		tableSizeBytes = size.Get().(int64)
-	}
+	p := w.prefetched[cursorKey(t)]
+	defer delete(w.prefetched, cursorKey(t))
 
-	firstDate := now
-	pgdate := pgtype.Timestamptz{}
-	err = w.conn.QueryRow("SELECT time from \"" + schema + "\".\"" + table + "\" ORDER BY time ASC LIMIT 1;").Scan(&pgdate)
-	if err != nil && err != pgx.ErrNoRows {
+	m, err := w.measure(ctx, t, now)
+	if err != nil {
 		return err
 	}
-	if err == nil {
-		firstDate = pgdate.Get().(time.Time)
+	err = w.attributeToSource(ctx, t, &m)
+	if err != nil {
+		return err
+	}
+	err = w.carryOverRename(ctx, t, m, p)
+	if err != nil {
+		return err
+	}
+
+	if w.config.SizeComparison && t.kind == model.KindHypertable {
+		err = w.compareSizes(ctx, t, m, now)
+		if err != nil {
+			return err
+		}
+	}
+	if m.method == methodApproximate && t.kind != model.KindTenant && !p.fetched {
+		m.margin, err = w.approximateMargin(ctx, table)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.config.SizeByMonth && t.kind == model.KindHypertable {
+		err = w.upsertSizeByMonth(ctx, t, now)
+		if err != nil {
+			return err
+		}
+	}
+	if w.config.SizeByPartition && t.kind == model.KindHypertable {
+		err = w.upsertSizeByPartition(ctx, t, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	var localBytes int64 = 0
+	if m.size.Get() != nil {
+		localBytes = m.size.Get().(int64)
 	}
-	days := now.Sub(firstDate).Hours() / 24
+	tieredBytes := w.tieredBytes[schema+"."+table]
+	tableSizeBytes := localBytes + tieredBytes
+
+	days := now.Sub(m.firstDate).Hours() / 24
 
 	var bytesPerDay float64 = 0
 	if days != 0 {
 		bytesPerDay = float64(tableSizeBytes) / days
 	}
 
-	log.Printf("%v %v %v\n", table, tableSizeBytes, bytesPerDay)
+	w.bufferHistory(table, tableSizeBytes, now)
 
-	nowStr := now.Format(time.RFC3339)
-	query := fmt.Sprintf("INSERT INTO %v.usage (\"table\", bytes, updated_at, bytes_per_day) VALUES ('%v', %v, '%v', %v) ON CONFLICT (\"table\") DO UPDATE SET bytes = %v, updated_at = '%v', bytes_per_day = %v;", w.config.PostgresUsageSchema, table, tableSizeBytes, nowStr, bytesPerDay, tableSizeBytes, nowStr, bytesPerDay)
-	_, err = w.conn.Exec(query)
+	// prefer the fitted growth over the naive bytes/age, which overestimates bulk-loaded tables
+	growthR2 := pgtype.Float8{Status: pgtype.Null}
+	growth, ok, err := w.fitGrowth(ctx, table, tableSizeBytes, now)
 	if err != nil {
 		return err
 	}
+	if ok {
+		bytesPerDay = growth.bytesPerDay
+		growthR2 = pgtype.Float8{Float: growth.r2, Status: pgtype.Present}
+	}
+
+	log.Printf("%v %v %v\n", w.logName(table), tableSizeBytes, bytesPerDay)
 
-	w.bytesMetrics.WithLabelValues(table).Set(float64(tableSizeBytes))
+	var avgChunkBytes int64 = 0
+	if m.chunks > 0 {
+		avgChunkBytes = localBytes / m.chunks
+	}
+	tinyChunks := w.config.TinyChunkMinCount > 0 && m.chunks >= w.config.TinyChunkMinCount && avgChunkBytes < w.config.TinyChunkBytes
+	if tinyChunks {
+		log.Printf("WARNING: Table %v has %v chunks of %v bytes on average, consider a larger chunk_time_interval\n", w.logName(table), m.chunks, avgChunkBytes)
+	}
 
+	// the previous usage of a renamed table is only known after carrying it over
+	previous := p.previous
+	if !p.fetched || p.renamedFrom.Status == pgtype.Present {
+		previous, err = w.getPreviousUsage(ctx, table)
+		if err != nil {
+			return err
+		}
+	}
+	smoothed := w.smooth(tableSizeBytes, previous)
+	w.checkThreshold(table, alertingBytes(previous.bytes, previous.smoothed), alertingBytes(tableSizeBytes, smoothed), now)
+
+	tenant := pgtype.Text{Status: pgtype.Null}
+	if t.kind == model.KindTenant {
+		tenant = pgtype.Text{String: schema, Status: pgtype.Present}
+	}
+	source := pgtype.Text{String: t.source, Status: pgtype.Present}
+	if t.source == "" {
+		source.Status = pgtype.Null
+	}
+	relid := pgtype.Int8{Int: m.relid, Status: pgtype.Present}
+	if m.relid == 0 {
+		relid.Status = pgtype.Null
+	}
+	user := pgtype.Text{String: m.user, Status: pgtype.Present}
+	if m.user == "" {
+		user.Status = pgtype.Null
+	}
+
+	query := w.statement(stmtUpsertUsage)
+	_, err = w.conn.ExecEx(ctx, query, nil, table, tableSizeBytes, now, bytesPerDay, &growthR2, localBytes, tieredBytes, &smoothed, m.owner, t.kind, m.chunks, avgChunkBytes, tinyChunks, &tenant, &source, &relid, m.method, &m.margin, &user)
+	if err != nil {
+		return err
+	}
+
+	w.metrics.bytes.WithLabelValues(table).Set(float64(tableSizeBytes))
+	if t.kind != model.KindTenant {
+		w.listedSizes[table] = tableSizeBytes
+	}
+	w.metrics.info.DeletePartialMatch(prometheus.Labels{"table": table})
+	w.metrics.info.WithLabelValues(table, schema, t.kind, m.owner, w.exportIdOf(table)).Set(1)
+	w.metrics.localBytes.WithLabelValues(table).Set(float64(localBytes))
+	if w.tiered {
+		w.metrics.tieredBytes.WithLabelValues(table).Set(float64(tieredBytes))
+	}
+	if t.kind == model.KindTenant {
+		w.metrics.tenantBytes.WithLabelValues(table).Set(float64(tableSizeBytes))
+	} else if t.kind != model.KindMaterializedView {
+		w.metrics.chunks.WithLabelValues(table).Set(float64(m.chunks))
+		w.metrics.avgChunkBytes.WithLabelValues(table).Set(float64(avgChunkBytes))
+	}
+	if !m.lastDate.IsZero() {
+		w.metrics.oldestData.WithLabelValues(table).Set(float64(m.firstDate.Unix()))
+		w.metrics.newestData.WithLabelValues(table).Set(float64(m.lastDate.Unix()))
+	}
+	if smoothed.Status == pgtype.Present {
+		w.metrics.smoothedBytes.WithLabelValues(table).Set(smoothed.Float)
+	}
+
+	if w.config.SeasonalForecast {
+		w.forecastTables = append(w.forecastTables, table)
+	}
+	if len(w.historyRows) >= historyFlushRows {
+		return w.flushHistory(ctx)
+	}
+	return nil
+}
+
+func (w *Worker) exportIdOf(table string) string {
+	if w.exportId == nil {
+		return ""
+	}
+	match := w.exportId.FindStringSubmatch(table)
+	if len(match) < 2 {
+		return ""
+	}
+	return match[1]
+}
+
+// actions modifying source tables are not possible with a read-only source, which needs its own user since
+// default_transaction_read_only can be turned off by the session
+func validateSourceReadOnly(config configuration.Config) error {
+	if !config.SourceReadOnly {
+		return nil
+	}
+	if config.PostgresSourceUser == "" || config.PostgresSourceUser == config.PostgresUser {
+		return errors.New("source_read_only requires a postgres_source_user other than postgres_user")
+	}
+	if config.CompressionEnforce || config.ChunkIntervalEnforce || config.QuotaEnforcement == writeBlockModeRevoke {
+		return errors.New("source_read_only can not be combined with compression_enforce, chunk_interval_enforce or quota_enforcement revoke")
+	}
 	return nil
 }
 
 func errIsTableDoesNotExist(err error) bool {
 	return strings.Contains(err.Error(), "SQLSTATE 42P01")
 }
+
+func errIsLockTimeout(err error) bool {
+	return strings.Contains(err.Error(), "SQLSTATE 55P03")
+}
+
+// notify puts the event into the outbox of every configured notifier. If the outbox isn't writable, the event is sent
+// directly instead. Failures are logged only, notifications never fail a run.
+func (w *Worker) notify(event notifier.Event) {
+	if len(w.config.Notifiers) == 0 {
+		return
+	}
+	event.RunId = w.runId
+	err := w.enqueueNotification(context.Background(), event)
+	if err == nil {
+		return
+	}
+	log.Println("WARNING: unable to put notification into outbox, sending directly", err)
+	err = w.notifier.Notify(context.Background(), event)
+	if err != nil {
+		log.Println("ERROR: unable to send notification", err)
+	}
+}
+
+func (w *Worker) enqueueNotification(ctx context.Context, event notifier.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	destinations := []string{}
+	for _, channel := range w.config.Notifiers {
+		if event.Repeat && !notifier.ReceivesRepeats(channel) {
+			continue
+		}
+		destinations = append(destinations, model.NotifierDestination(channel))
+	}
+	_, err = w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_outbox (destination, payload, created_at, next_attempt_at, idempotency_key) SELECT DISTINCT unnest($1::text[]), $2::jsonb, now(), now(), $3 ON CONFLICT DO NOTHING;", w.config.PostgresUsageSchema), nil, destinations, payload, outboxKey(event.RunId, event.IdempotencyKey()))
+	return err
+}
+
+// outboxKey qualifies the key with the run, events of runs without id have no key
+func outboxKey(runId int64, key string) *pgtype.Text {
+	if runId == 0 {
+		return &pgtype.Text{Status: pgtype.Null}
+	}
+	return &pgtype.Text{String: strconv.FormatInt(runId, 10) + "/" + key, Status: pgtype.Present}
+}
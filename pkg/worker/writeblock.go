@@ -0,0 +1,225 @@
+/*
+ *    Copyright 2023 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-usage/pkg/model"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+const (
+	writeBlockModeRevoke = "revoke"
+	writeBlockModeFlag   = "flag"
+
+	actionBlockWrites   = "block_writes"
+	actionUnblockWrites = "unblock_writes"
+)
+
+// applyWriteBlock blocks writes to all tables of an enforced quota violation and lifts the blocks
+// once the violation is no longer enforced.
+func (w *Worker) applyWriteBlock(ctx context.Context, q quotaUsage, enforce bool) error {
+	if w.config.QuotaEnforcement == "" {
+		return nil
+	}
+	if !enforce {
+		return w.unblockWrites(ctx, q.kind, q.subject)
+	}
+	tables, err := w.unblockedTablesOf(ctx, q.kind, q.subject)
+	if err != nil {
+		return err
+	}
+	tables, err = w.withoutProtected(ctx, tables, actionBlockWrites, w.config.QuotaEnforcement+" for "+q.kind+" "+q.subject)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		err = w.recordAction(ctx, table, actionBlockWrites, w.config.QuotaEnforcement+" for "+q.kind+" "+q.subject, w.blockWrites(ctx, table, q.kind, q.subject))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tables mapped to a user may change while the violation is enforced, so the list is checked on every run
+func (w *Worker) unblockedTablesOf(ctx context.Context, kind string, subject string) (tables []string, err error) {
+	query := fmt.Sprintf("SELECT u.\"table\" FROM %[1]v.usage u LEFT JOIN %[1]v.usage_mapping m ON m.\"table\" = u.\"table\" WHERE coalesce(m.user_id, u.source_user, u.owner) = $1 AND u.kind IS DISTINCT FROM '"+model.KindTenant+"' AND u.\"table\" NOT IN (SELECT \"table\" FROM %[1]v.usage_write_blocks);", w.config.PostgresUsageSchema)
+	if kind == model.QuotaKindTable {
+		query = fmt.Sprintf("SELECT $1::text WHERE $1 NOT IN (SELECT \"table\" FROM %v.usage_write_blocks);", w.config.PostgresUsageSchema)
+	}
+	rows, err := w.conn.QueryEx(ctx, query, nil, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// insertGrantsQuery lists the writer roles granted INSERT on the table directly, including its owner if the table
+// still has the default privileges
+const insertGrantsQuery = `SELECT coalesce(array_agg(DISTINCT r.rolname::text), '{}')
+FROM pg_class c, aclexplode(coalesce(c.relacl, acldefault('r', c.relowner))) a
+JOIN pg_roles r ON r.oid = a.grantee
+WHERE c.oid = $1::regclass AND a.privilege_type = 'INSERT' AND r.rolname = ANY($2);`
+
+func (w *Worker) blockWrites(ctx context.Context, table string, kind string, subject string) error {
+	var revoked pgtype.TextArray
+	switch w.config.QuotaEnforcement {
+	case writeBlockModeRevoke:
+		identifier := pgx.Identifier{w.config.PostgresSourceSchema, table}.Sanitize()
+		err := w.conn.QueryRowEx(ctx, insertGrantsQuery, nil, identifier, w.config.QuotaWriterRoles).Scan(&revoked)
+		if err != nil {
+			return err
+		}
+		roles := []string{}
+		err = revoked.AssignTo(&roles)
+		if err != nil {
+			return err
+		}
+		for _, role := range roles {
+			_, err = w.conn.ExecEx(ctx, fmt.Sprintf("REVOKE INSERT ON %v FROM %v;", identifier, pgx.Identifier{role}.Sanitize()), nil)
+			if err != nil {
+				return err
+			}
+		}
+	case writeBlockModeFlag:
+		revoked.Status = pgtype.Null
+		err := w.setWritable(ctx, table, false)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown quota_enforcement %v", w.config.QuotaEnforcement)
+	}
+	_, err := w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_write_blocks (\"table\", kind, subject, mode, blocked_at, revoked_roles) VALUES ($1, $2, $3, $4, $5, $6);", w.config.PostgresUsageSchema), nil, table, kind, subject, w.config.QuotaEnforcement, time.Now(), &revoked)
+	return err
+}
+
+type writeBlock struct {
+	table        string
+	mode         string
+	revokedRoles pgtype.TextArray // NULL for blocks recorded before the revoked roles were
+}
+
+func (w *Worker) unblockWrites(ctx context.Context, kind string, subject string) error {
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT \"table\", mode, revoked_roles FROM %v.usage_write_blocks WHERE kind = $1 AND subject = $2;", w.config.PostgresUsageSchema), nil, kind, subject)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	blocks := []writeBlock{}
+	for rows.Next() {
+		b := writeBlock{}
+		err = rows.Scan(&b.table, &b.mode, &b.revokedRoles)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, b)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	for _, b := range blocks {
+		err = w.recordAction(ctx, b.table, actionUnblockWrites, b.mode+" for "+kind+" "+subject, w.unblock(ctx, b))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Worker) unblock(ctx context.Context, b writeBlock) error {
+	switch b.mode {
+	case writeBlockModeRevoke:
+		// only the grants revoked by the block are restored
+		roles := w.config.QuotaWriterRoles
+		if b.revokedRoles.Status == pgtype.Present {
+			roles = []string{}
+			err := b.revokedRoles.AssignTo(&roles)
+			if err != nil {
+				return err
+			}
+		}
+		identifier := pgx.Identifier{w.config.PostgresSourceSchema, b.table}.Sanitize()
+		for _, role := range roles {
+			_, err := w.conn.ExecEx(ctx, fmt.Sprintf("GRANT INSERT ON %v TO %v;", identifier, pgx.Identifier{role}.Sanitize()), nil)
+			if err != nil && !errIsTableDoesNotExist(err) {
+				return err
+			}
+		}
+	case writeBlockModeFlag:
+		err := w.setWritable(ctx, b.table, true)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.conn.ExecEx(ctx, fmt.Sprintf("DELETE FROM %v.usage_write_blocks WHERE \"table\" = $1;", w.config.PostgresUsageSchema), nil, b.table)
+	return err
+}
+
+// setWritable maintains the writable flag honored by the services writing to the tables
+func (w *Worker) setWritable(ctx context.Context, table string, writable bool) error {
+	_, err := w.conn.ExecEx(ctx, fmt.Sprintf("INSERT INTO %v.usage_writable (\"table\", writable, updated_at) VALUES ($1, $2, now()) ON CONFLICT (\"table\") DO UPDATE SET writable = $2, updated_at = now();", w.config.PostgresUsageSchema), nil, table, writable)
+	return err
+}
+
+// unblockOrphans lifts blocks of quotas that have been deleted
+func (w *Worker) unblockOrphans(ctx context.Context) error {
+	if w.config.QuotaEnforcement == "" {
+		return nil
+	}
+	rows, err := w.conn.QueryEx(ctx, fmt.Sprintf("SELECT DISTINCT b.kind, b.subject FROM %[1]v.usage_write_blocks b WHERE NOT EXISTS (SELECT 1 FROM %[1]v.usage_quotas q WHERE q.kind = b.kind AND q.subject = b.subject);", w.config.PostgresUsageSchema), nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	orphans := []quotaUsage{}
+	for rows.Next() {
+		q := quotaUsage{}
+		err = rows.Scan(&q.kind, &q.subject)
+		if err != nil {
+			return err
+		}
+		orphans = append(orphans, q)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+	for _, q := range orphans {
+		err = w.unblockWrites(ctx, q.kind, q.subject)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}